@@ -0,0 +1,307 @@
+package igcapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+The roles of API keys, every role has the access of the roles before it
+*/
+const (
+	RoleReader   = "reader"
+	RoleUploader = "uploader"
+	RoleAdmin    = "admin"
+)
+
+var (
+	roleLevels = map[string]int{RoleReader: 1, RoleUploader: 2, RoleAdmin: 3}
+
+	adminKeyHash string // The hash of ADMIN_API_KEY, always accepted as an admin key
+
+	// ErrInvalidRole is returned when creating a key with a role that doesn't exist
+	ErrInvalidRole = errors.New("invalid role, has to be reader, uploader or admin")
+)
+
+/*
+APIKey is a stored API key. Only the hash of the key is stored, the key itself is only shown when it's created
+*/
+type APIKey struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	Hash      string `json:"-"`
+	Created   int64  `json:"created"`
+	RevokedAt int64  `json:"revoked_at,omitempty"`
+}
+
+/*
+APIKeyRequest is the body of requests creating a key
+*/
+type APIKeyRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+/*
+CreatedAPIKey is a key that was just created, with the key itself which is only shown once
+*/
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+/*
+APIKeyStorage stores API keys
+*/
+type APIKeyStorage interface {
+	Add(key APIKey) bool
+	GetByHash(hash string) (APIKey, bool)
+	GetAll() ([]APIKey, error)
+	Revoke(ID string, revokedAt int64) bool
+}
+
+/*
+MethodRoles maps request methods to the role needed to use them, "*" is used for the methods that aren't
+in the map. Without "*" the methods that aren't in the map are public
+*/
+type MethodRoles map[string]string
+
+/*
+Required returns the role needed to use the method, false if the method is public
+*/
+func (roles MethodRoles) Required(method string) (string, bool) {
+	required, ok := roles[method]
+	if !ok {
+		required, ok = roles["*"]
+	}
+	return required, ok
+}
+
+/*
+NewAPIKey creates a key with the given name and role, and returns it along with the key to give to the client ("<id>.<secret>")
+*/
+func NewAPIKey(name, role string) (APIKey, string, error) {
+	if _, ok := roleLevels[role]; !ok {
+		return APIKey{}, "", ErrInvalidRole
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	key := id + "." + secret
+	return APIKey{ID: id, Name: name, Role: role, Hash: HashAPIKey(key), Created: time.Now().Unix()}, key, nil
+}
+
+/*
+HashAPIKey returns the hash a key is stored with. The keys are random, so an unsalted hash is enough
+*/
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+HasRole returns if the role has the access of the required role
+*/
+func HasRole(role, required string) bool {
+	return roleLevels[role] >= roleLevels[required] && roleLevels[role] > 0
+}
+
+/*
+RequestKey returns the API key given in the request, as "Authorization: Bearer <key>" or "X-API-Key: <key>"
+*/
+func RequestKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+/*
+Authenticate returns the API key of the request, and if a valid key was given. Revoked keys aren't valid
+*/
+func Authenticate(r *http.Request) (APIKey, bool) {
+	key := RequestKey(r)
+	if key == "" {
+		return APIKey{}, false
+	}
+
+	hash := HashAPIKey(key)
+	if adminKeyHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(adminKeyHash)) == 1 {
+		return APIKey{ID: "admin", Name: "ADMIN_API_KEY", Role: RoleAdmin}, true
+	}
+
+	apiKey, found := keyDB.GetByHash(hash)
+	if !found || apiKey.RevokedAt != 0 {
+		return APIKey{}, false
+	}
+
+	return apiKey, true
+}
+
+// apiKeyKey is the context key of the authenticated API key of a request
+type apiKeyKey struct{}
+
+// authentication is the result of authenticating a request
+type authentication struct {
+	Key   APIKey
+	Valid bool
+}
+
+/*
+WithAPIKey authenticates the request and keeps the result in its context, so the key is only looked up once
+*/
+func WithAPIKey(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(apiKeyKey{}).(authentication); ok {
+		return r
+	}
+
+	key, valid := Authenticate(r)
+	return r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, authentication{Key: key, Valid: valid}))
+}
+
+/*
+RequestAPIKey returns the API key of the request, and if a valid key was given. The key kept by WithAPIKey
+is used if there is one
+*/
+func RequestAPIKey(r *http.Request) (APIKey, bool) {
+	if auth, ok := r.Context().Value(apiKeyKey{}).(authentication); ok {
+		return auth.Key, auth.Valid
+	}
+
+	return Authenticate(r)
+}
+
+/*
+RequireRoles wraps a handler so requests with the methods in roles need an API key with the role.
+Requests without a valid key get 401, and keys without the role get 403
+*/
+func RequireRoles(roles MethodRoles, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		required, ok := roles.Required(r.Method)
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		key, ok := RequestAPIKey(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="paragliding"`)
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "A valid API key is needed")
+			return
+		}
+		if !HasRole(key.Role, required) {
+			writeError(w, r, http.StatusForbidden, CodeForbidden, "The API key needs the role "+required)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+/*
+SetAdminKey sets the key that's always accepted as an admin key, used to create the first keys
+*/
+func SetAdminKey(key string) {
+	adminKeyHash = ""
+	if key != "" {
+		adminKeyHash = HashAPIKey(key)
+	}
+}
+
+/*
+APIKeyMemoryDB stores API keys in memory, used when running without a database and in tests
+*/
+type APIKeyMemoryDB struct {
+	mutex sync.RWMutex
+	keys  []APIKey
+}
+
+/*
+Add adds a key, returns false if a key with the same ID already exists
+*/
+func (db *APIKeyMemoryDB) Add(key APIKey) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, k := range db.keys {
+		if k.ID == key.ID {
+			return false
+		}
+	}
+	db.keys = append(db.keys, key)
+
+	return true
+}
+
+/*
+GetByHash returns the key with the hash, and if it was found
+*/
+func (db *APIKeyMemoryDB) GetByHash(hash string) (APIKey, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	for _, key := range db.keys {
+		if key.Hash == hash {
+			return key, true
+		}
+	}
+
+	return APIKey{}, false
+}
+
+/*
+GetAll returns all the keys, revoked keys included
+*/
+func (db *APIKeyMemoryDB) GetAll() ([]APIKey, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	keys := make([]APIKey, len(db.keys))
+	copy(keys, db.keys)
+
+	return keys, nil
+}
+
+/*
+Revoke revokes the key with the ID, returns false if no key that isn't revoked has the ID
+*/
+func (db *APIKeyMemoryDB) Revoke(ID string, revokedAt int64) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for i, key := range db.keys {
+		if key.ID == ID && key.RevokedAt == 0 {
+			db.keys[i].RevokedAt = revokedAt
+			return true
+		}
+	}
+
+	return false
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
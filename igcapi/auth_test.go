@@ -0,0 +1,159 @@
+package igcapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// authTestKeys returns a key store with a key of every role, and the keys by role
+func authTestKeys(t *testing.T) (*APIKeyMemoryDB, map[string]string) {
+	memoryDB := &APIKeyMemoryDB{}
+	keys := make(map[string]string)
+
+	for _, role := range []string{RoleReader, RoleUploader, RoleAdmin} {
+		apiKey, key, err := NewAPIKey(role+" key", role)
+		if err != nil {
+			t.Fatalf("Couldn't create a key: %s", err)
+		}
+		memoryDB.Add(apiKey)
+		keys[role] = key
+	}
+
+	return memoryDB, keys
+}
+
+// Tests that only keys with the required role are let through
+func Test_requireRoles(t *testing.T) {
+	defer func(storage APIKeyStorage) { keyDB = storage }(keyDB)
+	memoryDB, keys := authTestKeys(t)
+	keyDB = memoryDB
+
+	handler := RequireRoles(MethodRoles{http.MethodGet: RoleReader, "*": RoleAdmin}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		method string
+		key    string
+		status int
+	}{
+		{http.MethodGet, "", http.StatusUnauthorized},
+		{http.MethodGet, "invalid.key", http.StatusUnauthorized},
+		{http.MethodGet, keys[RoleReader], http.StatusOK},
+		{http.MethodGet, keys[RoleAdmin], http.StatusOK},
+		{http.MethodDelete, keys[RoleUploader], http.StatusForbidden},
+		{http.MethodDelete, keys[RoleAdmin], http.StatusOK},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/paragliding/admin/api/tracks/", nil)
+		if test.key != "" {
+			r.Header.Set("Authorization", "Bearer "+test.key)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s with key '%s': expected %d, got %d", test.method, test.key, test.status, w.Code)
+		}
+	}
+
+	// Revoked keys aren't accepted, and keys can be given in X-API-Key as well
+	memoryDB.Revoke(strings.Split(keys[RoleAdmin], ".")[0], 1000)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-API-Key", keys[RoleAdmin])
+	if _, ok := Authenticate(r); ok {
+		t.Error("A revoked key was accepted")
+	}
+}
+
+// Tests that methods without a role are public
+func Test_requireRoles_public(t *testing.T) {
+	handler := RequireRoles(MethodRoles{http.MethodDelete: RoleAdmin}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a public GET, got %d", w.Code)
+	}
+}
+
+// Tests that the key from ADMIN_API_KEY is an admin key
+func Test_adminKey(t *testing.T) {
+	defer SetAdminKey("")
+	SetAdminKey("bootstrap-key")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer bootstrap-key")
+	if key, ok := Authenticate(r); !ok || key.Role != RoleAdmin {
+		t.Errorf("Expected the admin key to be accepted as an admin, got %+v (%v)", key, ok)
+	}
+
+	if _, _, err := NewAPIKey("name", "superuser"); err != ErrInvalidRole {
+		t.Errorf("Expected an invalid role to give ErrInvalidRole, got %v", err)
+	}
+}
+
+// Tests that the key kept by WithAPIKey is used instead of authenticating again
+func Test_withAPIKey(t *testing.T) {
+	defer SetAdminKey("")
+	SetAdminKey("bootstrap-key")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer bootstrap-key")
+	r = WithAPIKey(r)
+
+	SetAdminKey("") // The key would no longer be valid if it was looked up again
+	if key, ok := RequestAPIKey(r); !ok || key.Role != RoleAdmin {
+		t.Errorf("Expected the kept admin key, got %+v (%v)", key, ok)
+	}
+	if _, ok := RequestAPIKey(httptest.NewRequest(http.MethodGet, "/", nil)); ok {
+		t.Error("A request without a key was authenticated")
+	}
+}
+
+// Tests the roles needed to add tracks and sites and to register gliders, where only admins can change the class
+func Test_requireRoles_routes(t *testing.T) {
+	defer func(storage APIKeyStorage) { keyDB = storage }(keyDB)
+	defer func(storage GliderStorage) { gliderDB = storage }(gliderDB)
+	memoryDB, keys := authTestKeys(t)
+	keyDB = memoryDB
+	gliderDB = &GliderMemoryDB{}
+
+	tests := []struct {
+		method string
+		path   string
+		key    string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/paragliding/api/track", "", `{"url": "http://example.com/track.igc"}`, http.StatusUnauthorized},
+		{http.MethodPost, "/paragliding/api/track", keys[RoleReader], `{"url": "http://example.com/track.igc"}`, http.StatusForbidden},
+		{http.MethodPost, "/paragliding/api/sites", "", `{"name": "Site", "lat": 61, "lng": 10}`, http.StatusUnauthorized},
+		{http.MethodPost, "/paragliding/api/sites/import", keys[RoleReader], "", http.StatusForbidden},
+		{http.MethodPut, "/paragliding/api/gliders/D-1234", "", `{"model": "Glider"}`, http.StatusUnauthorized},
+		{http.MethodPut, "/paragliding/api/gliders/D-1234", keys[RoleUploader], `{"model": "Glider"}`, http.StatusOK},
+		{http.MethodPut, "/paragliding/api/gliders/D-1234", keys[RoleUploader], `{"model": "Glider", "class": "EN-B"}`, http.StatusForbidden},
+		{http.MethodPut, "/paragliding/api/gliders/D-1234", keys[RoleAdmin], `{"model": "Glider", "class": "EN-B"}`, http.StatusOK},
+		{http.MethodPut, "/paragliding/api/gliders/D-1234", keys[RoleUploader], `{"model": "Renamed", "class": "EN-B"}`, http.StatusOK}, // Same class
+		{http.MethodPut, "/paragliding/api/gliders/D-1234", keys[RoleUploader], `{"model": "Renamed"}`, http.StatusForbidden},           // Removes the class
+	}
+
+	router := NewRouter()
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.key != "" {
+			r.Header.Set("Authorization", "Bearer "+test.key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s %s %s: expected %d, got %d (%s)", test.method, test.path, test.body, test.status, w.Code, w.Body.String())
+		}
+	}
+}
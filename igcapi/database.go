@@ -2,11 +2,116 @@ package igcapi
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
+// The collection with the last ID of every track collection, by the name of the collection
+const trackCounters = "counters"
+
+/*
+TrackStorage is implemented by the storage backends for tracks
+*/
+type TrackStorage interface {
+	Add(t TrackInfo) bool
+	Update(t TrackInfo) bool
+	Count() int
+	Get(key int) (TrackInfo, bool)
+	GetAll() ([]TrackInfo, error)
+	GetAllIDs() ([]int, error)
+	Find(filter TrackFilter) ([]TrackInfo, error)
+	FindIDs(filter TrackFilter) ([]int, error)
+	FindPage(filter TrackFilter, page PageRequest) ([]TrackInfo, string, error)
+	GetLast() (TrackInfo, error)
+	GetLastID() int
+	Delete(ID int, deletedAt int64) bool
+	DeleteAll(deletedAt int64) int
+	Restore(ID int) bool
+	Purge(deletedBefore int64) ([]TrackInfo, error)
+}
+
+/*
+WebhookStorage is implemented by the storage backends for webhooks
+*/
+type WebhookStorage interface {
+	Add(wh Webhook) bool
+	GetLastID() int
+	GetAll() ([]Webhook, error)
+	Get(ID int) (Webhook, bool)
+	Delete(ID int) (Webhook, bool)
+}
+
+/*
+RevisionStorage is implemented by the storage backends for track revisions
+*/
+type RevisionStorage interface {
+	Add(rev TrackRevision) bool
+	GetAll(trackID int) ([]TrackRevision, error)
+	DeleteAll(trackID int) bool
+}
+
+/*
+PointsStorage is implemented by the storage backends for the points of the tracks
+*/
+type PointsStorage interface {
+	Set(trackID int, points []TrackPoint) bool
+	Get(trackID int) ([]TrackPoint, bool)
+	Delete(trackID int) bool
+}
+
+/*
+SiteStorage is implemented by the storage backends for launch sites
+*/
+type SiteStorage interface {
+	Add(site Site) bool
+	Update(site Site) bool
+	Get(ID int) (Site, bool)
+	GetAll() ([]Site, error)
+	GetLastID() int
+}
+
+/*
+PilotStorage is implemented by the storage backends for pilot profiles
+*/
+type PilotStorage interface {
+	AddTrack(t TrackInfo) bool
+	Set(p Pilot) bool
+	Get(ID string) (Pilot, bool)
+	GetAll() ([]Pilot, error)
+	Delete(ID string) bool
+}
+
+/*
+GliderStorage is implemented by the storage backends for the glider registry
+*/
+type GliderStorage interface {
+	AddTrack(t TrackInfo) bool
+	Register(id string, registration GliderRegistration) bool
+	SetTotals(g Glider) bool
+	Get(ID string) (Glider, bool)
+	GetAll(class string) ([]Glider, error)
+}
+
+/*
+AuditStorage is implemented by the storage backends for the audit trail
+*/
+type AuditStorage interface {
+	Add(entry AuditEntry) bool
+	GetAll(trackID int) ([]AuditEntry, error)
+}
+
+/*
+JobStorage is implemented by the storage backends for the fetch jobs of added tracks
+*/
+type JobStorage interface {
+	Add(job FetchJob) bool
+	Update(job FetchJob) bool
+	Get(ID string) (FetchJob, bool)
+}
+
 /*
 TrackDB stores information used to connect to a database storing track information
 */
@@ -25,6 +130,87 @@ type WebhookDB struct {
 	CollectionName string `json:"collectionname"`
 }
 
+/*
+RevisionDB stores information used to connect to a database storing track revisions
+*/
+type RevisionDB struct {
+	DatabaseURL    string `json:"databaseurl"`
+	DatabaseName   string `json:"databasename"`
+	CollectionName string `json:"collectionname"`
+}
+
+/*
+PointsDB stores information used to connect to a database storing the points of the tracks
+*/
+type PointsDB struct {
+	DatabaseURL    string `json:"databaseurl"`
+	DatabaseName   string `json:"databasename"`
+	CollectionName string `json:"collectionname"`
+}
+
+/*
+SiteDB stores information used to connect to a database storing launch sites
+*/
+type SiteDB struct {
+	DatabaseURL    string `json:"databaseurl"`
+	DatabaseName   string `json:"databasename"`
+	CollectionName string `json:"collectionname"`
+}
+
+/*
+PilotDB stores information used to connect to a database storing pilot profiles
+*/
+type PilotDB struct {
+	DatabaseURL    string `json:"databaseurl"`
+	DatabaseName   string `json:"databasename"`
+	CollectionName string `json:"collectionname"`
+}
+
+/*
+GliderDB stores information used to connect to a database storing the glider registry
+*/
+type GliderDB struct {
+	DatabaseURL    string `json:"databaseurl"`
+	DatabaseName   string `json:"databasename"`
+	CollectionName string `json:"collectionname"`
+}
+
+/*
+AuditDB stores information used to connect to a database storing the audit trail of track edits
+*/
+type AuditDB struct {
+	DatabaseURL    string `json:"databaseurl"`
+	DatabaseName   string `json:"databasename"`
+	CollectionName string `json:"collectionname"`
+}
+
+/*
+JobDB stores information used to connect to a database storing the fetch jobs of added tracks
+*/
+type JobDB struct {
+	DatabaseURL    string `json:"databaseurl"`
+	DatabaseName   string `json:"databasename"`
+	CollectionName string `json:"collectionname"`
+}
+
+/*
+APIKeyDB stores information used to connect to a database storing API keys
+*/
+type APIKeyDB struct {
+	DatabaseURL    string `json:"databaseurl"`
+	DatabaseName   string `json:"databasename"`
+	CollectionName string `json:"collectionname"`
+}
+
+/*
+RateLimitDB stores the token buckets of the rate limiter in a database, so they are shared between servers
+*/
+type RateLimitDB struct {
+	DatabaseURL    string `json:"databaseurl"`
+	DatabaseName   string `json:"databasename"`
+	CollectionName string `json:"collectionname"`
+}
+
 /*
 Init initializes the mongo database
 */
@@ -47,6 +233,15 @@ func (db *TrackDB) Init() {
 	if err != nil {
 		panic(err)
 	}
+
+	// Indexes used when searching for tracks
+	for _, key := range []string{"id", "timestamp", "pilot", "glider", "gliderid", "hdate", "tracklength", "signaturestatus", "siteid", "pilotid", "gliderkey", "deletedat",
+		"$2dsphere:start", "$2dsphere:end", "$2dsphere:path"} {
+		err = session.DB(db.DatabaseName).C(db.CollectionName).EnsureIndex(mgo.Index{Key: []string{key}, Background: true})
+		if err != nil {
+			panic(err)
+		}
+	}
 }
 
 /*
@@ -65,11 +260,44 @@ func (db *TrackDB) Add(t TrackInfo) bool {
 		return false
 	}
 
+	// The last ID is kept apart from the tracks, so the IDs of purged tracks aren't used again
+	_, err = session.DB(db.DatabaseName).C(trackCounters).UpsertId(db.CollectionName, bson.M{"$max": bson.M{"lastid": t.ID}})
+	if err != nil {
+		fmt.Printf("Error updating the last ID of track %d in the DB: %s", t.ID, err.Error())
+	}
+
+	return true
+}
+
+/*
+Update replaces the stored track with the same ID, returns if the update was successful. The track is only
+replaced if it's still deleted or not as when it was read, so a track deleted in the meantime isn't restored
+*/
+func (db *TrackDB) Update(t TrackInfo) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	query := TrackFilter{ID: &t.ID}.Query()
+	if t.DeletedAt > 0 {
+		query["deletedat"] = t.DeletedAt
+	}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Update(query, t)
+	if err == mgo.ErrNotFound {
+		return false
+	} else if err != nil {
+		fmt.Printf("Error updating track %d in the DB: %s", t.ID, err.Error())
+		return false
+	}
+
 	return true
 }
 
 /*
-Count returns the amount of tracks in the database
+Count returns the amount of tracks in the database, deleted tracks are not counted
 */
 func (db *TrackDB) Count() int {
 	session, err := mgo.Dial(db.DatabaseURL)
@@ -78,7 +306,7 @@ func (db *TrackDB) Count() int {
 	}
 	defer session.Close()
 
-	count, err := session.DB(db.DatabaseName).C(db.CollectionName).Count()
+	count, err := session.DB(db.DatabaseName).C(db.CollectionName).Find(TrackFilter{}.Query()).Count()
 	if err != nil {
 		fmt.Printf("Error retrieving the count from the database: %s", err.Error())
 		return -1
@@ -88,7 +316,7 @@ func (db *TrackDB) Count() int {
 }
 
 /*
-Get returns the track with a given ID, and if the track was found
+Get returns the track with a given ID, and if the track was found. Deleted tracks are not found
 */
 func (db *TrackDB) Get(key int) (TrackInfo, bool) {
 	session, err := mgo.Dial(db.DatabaseURL)
@@ -100,7 +328,7 @@ func (db *TrackDB) Get(key int) (TrackInfo, bool) {
 	trackFound := true
 	track := TrackInfo{}
 
-	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{"id": key}).One(&track)
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(TrackFilter{ID: &key}.Query()).One(&track)
 	if err != nil {
 		trackFound = false
 	}
@@ -109,7 +337,7 @@ func (db *TrackDB) Get(key int) (TrackInfo, bool) {
 }
 
 /*
-GetAll returns all the tracks in the database, or a potential error
+GetAll returns all the tracks in the database that aren't deleted, or a potential error
 */
 func (db *TrackDB) GetAll() ([]TrackInfo, error) {
 	session, err := mgo.Dial(db.DatabaseURL)
@@ -120,7 +348,7 @@ func (db *TrackDB) GetAll() ([]TrackInfo, error) {
 
 	tracks := []TrackInfo{}
 
-	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{}).All(&tracks)
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(TrackFilter{}.Query()).All(&tracks)
 	if err != nil {
 		return []TrackInfo{}, err
 	}
@@ -129,7 +357,7 @@ func (db *TrackDB) GetAll() ([]TrackInfo, error) {
 }
 
 /*
-GetAllIDs returns a slice of all the IDs used in the DB
+GetAllIDs returns a slice of the IDs of the tracks that aren't deleted
 */
 func (db *TrackDB) GetAllIDs() ([]int, error) {
 	session, err := mgo.Dial(db.DatabaseURL)
@@ -140,7 +368,7 @@ func (db *TrackDB) GetAllIDs() ([]int, error) {
 
 	var tracks []TrackInfo
 
-	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(nil).All(&tracks)
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(TrackFilter{}.Query()).All(&tracks)
 	if err != nil {
 		return []int{}, nil
 	}
@@ -154,7 +382,80 @@ func (db *TrackDB) GetAllIDs() ([]int, error) {
 }
 
 /*
-GetLast returns the last in the DB
+Find returns the tracks matching the filter, sorted by ID
+*/
+func (db *TrackDB) Find(filter TrackFilter) ([]TrackInfo, error) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	tracks := []TrackInfo{}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(filter.Query()).Sort("id").All(&tracks)
+	if err != nil {
+		return []TrackInfo{}, err
+	}
+
+	return tracks, nil
+}
+
+/*
+FindIDs returns the IDs of the tracks matching the filter, sorted by ID
+*/
+func (db *TrackDB) FindIDs(filter TrackFilter) ([]int, error) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	var tracks []TrackInfo
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(filter.Query()).Select(bson.M{"id": 1}).Sort("id").All(&tracks)
+	if err != nil {
+		return []int{}, err
+	}
+
+	IDs := []int{}
+	for _, val := range tracks {
+		IDs = append(IDs, val.ID)
+	}
+
+	return IDs, nil
+}
+
+/*
+FindPage returns a page of the tracks matching the filter, and the cursor of the next page
+(an empty string if it's the last page)
+*/
+func (db *TrackDB) FindPage(filter TrackFilter, page PageRequest) ([]TrackInfo, string, error) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	query, order, err := page.Query(filter)
+	if err != nil {
+		return []TrackInfo{}, "", err
+	}
+
+	tracks := []TrackInfo{}
+
+	// One more than the limit is retrieved to know if there is a next page
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(query).Sort(order...).Limit(page.Limit + 1).All(&tracks)
+	if err != nil {
+		return []TrackInfo{}, "", err
+	}
+
+	tracks, next := page.cut(tracks)
+	return tracks, next, nil
+}
+
+/*
+GetLast returns the last added track that isn't deleted
 */
 func (db *TrackDB) GetLast() (TrackInfo, error) {
 	session, err := mgo.Dial(db.DatabaseURL)
@@ -163,15 +464,17 @@ func (db *TrackDB) GetLast() (TrackInfo, error) {
 	}
 	defer session.Close()
 
-	tracks, err := db.GetAll()
+	var track TrackInfo
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(TrackFilter{}.Query()).Sort("-id").One(&track)
 	if err != nil {
 		fmt.Println("Error retrieving from DB:", err.Error())
 		return TrackInfo{}, err
 	}
-	return tracks[len(tracks)-1], nil
+
+	return track, nil
 }
 
-// GetLastID returns the last used track ID
+// GetLastID returns the last used track ID, deleted and purged tracks included so IDs aren't reused
 func (db *TrackDB) GetLastID() int {
 	session, err := mgo.Dial(db.DatabaseURL)
 	if err != nil {
@@ -179,31 +482,105 @@ func (db *TrackDB) GetLastID() int {
 	}
 	defer session.Close()
 
-	lastTrack, err := db.GetLast()
-	if err != nil {
+	lastID := -1
+	var counter struct {
+		LastID int `bson:"lastid"`
+	}
+	if err = session.DB(db.DatabaseName).C(trackCounters).FindId(db.CollectionName).One(&counter); err == nil {
+		lastID = counter.LastID
+	} else if err != mgo.ErrNotFound {
 		fmt.Println("Couldn't retrieve the last ID from the database:", err.Error())
-		return -1
 	}
 
-	return lastTrack.ID
+	// Tracks added before the counter was kept
+	var lastTrack TrackInfo
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(nil).Sort("-id").One(&lastTrack)
+	if err == nil {
+		lastID = Max(lastID, lastTrack.ID)
+	} else if err != mgo.ErrNotFound {
+		fmt.Println("Couldn't retrieve the last ID from the database:", err.Error())
+	}
+
+	return lastID
+}
+
+/*
+Delete marks the track with the given ID as deleted, returns if a track was deleted
+*/
+func (db *TrackDB) Delete(ID int, deletedAt int64) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Update(TrackFilter{ID: &ID}.Query(), bson.M{"$set": bson.M{"deletedat": deletedAt}})
+	if err != nil {
+		fmt.Printf("Error deleting track %d in the DB: %s\n", ID, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+DeleteAll marks all tracks as deleted, and returns how many tracks were deleted
+*/
+func (db *TrackDB) DeleteAll(deletedAt int64) int {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	info, err := session.DB(db.DatabaseName).C(db.CollectionName).UpdateAll(TrackFilter{}.Query(), bson.M{"$set": bson.M{"deletedat": deletedAt}})
+	if err != nil {
+		fmt.Println("Error deleting in the database:", err.Error())
+		return 0
+	}
+
+	return info.Updated
+}
+
+/*
+Restore restores a deleted track, returns if a track was restored
+*/
+func (db *TrackDB) Restore(ID int) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Update(TrackFilter{ID: &ID, Deleted: true}.Query(), bson.M{"$unset": bson.M{"deletedat": ""}})
+	return err == nil
 }
 
 /*
-DeleteAll deletes all tracks from the database, and returns how many tracks were deleted
+Purge permanently removes the tracks deleted at or before the given time, and returns the removed tracks
 */
-func (db *TrackDB) DeleteAll() int {
+func (db *TrackDB) Purge(deletedBefore int64) ([]TrackInfo, error) {
 	session, err := mgo.Dial(db.DatabaseURL)
 	if err != nil {
 		panic(err)
 	}
 	defer session.Close()
 
-	info, err := session.DB(db.DatabaseName).C(db.CollectionName).RemoveAll(bson.M{})
+	query := TrackFilter{Deleted: true}.Query()
+	query["deletedat"] = bson.M{"$gt": 0, "$lte": deletedBefore}
+
+	tracks := []TrackInfo{}
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(query).All(&tracks)
+	if err != nil {
+		return []TrackInfo{}, err
+	}
+
+	_, err = session.DB(db.DatabaseName).C(db.CollectionName).RemoveAll(query)
 	if err != nil {
-		fmt.Println("Error removing from database:", err.Error())
+		return []TrackInfo{}, err
 	}
 
-	return info.Removed
+	return tracks, nil
 }
 
 //
@@ -273,9 +650,29 @@ func (db *WebhookDB) GetLastID() int {
 }
 
 /*
-Get retrieves the webhook with a given ID
+GetAll returns all the webhooks
+*/
+func (db *WebhookDB) GetAll() ([]Webhook, error) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	webhooks := []Webhook{}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(nil).All(&webhooks)
+	if err != nil {
+		return []Webhook{}, err
+	}
+
+	return webhooks, nil
+}
+
+/*
+Get retrieves the webhook with a given ID, and if it was found
 */
-func (db *WebhookDB) Get(ID int) Webhook {
+func (db *WebhookDB) Get(ID int) (Webhook, bool) {
 	session, err := mgo.Dial(db.DatabaseURL)
 	if err != nil {
 		panic(err)
@@ -285,16 +682,16 @@ func (db *WebhookDB) Get(ID int) Webhook {
 	var wh Webhook
 	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{"id": ID}).One(&wh)
 	if err != nil {
-		fmt.Println("Couldn't find any Webhook with that ID")
+		return wh, false
 	}
 
-	return wh
+	return wh, true
 }
 
 /*
-Delete deletes a webhook with the given ID and returns it
+Delete deletes a webhook with the given ID and returns it, and if it was found
 */
-func (db *WebhookDB) Delete(ID int) Webhook {
+func (db *WebhookDB) Delete(ID int) (Webhook, bool) {
 	session, err := mgo.Dial(db.DatabaseURL)
 	if err != nil {
 		panic(err)
@@ -304,10 +701,913 @@ func (db *WebhookDB) Delete(ID int) Webhook {
 	var wh Webhook
 	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{"id": ID}).One(&wh)
 	if err != nil {
-		fmt.Println("Couldn't find any Webhook with that ID")
-	} else {
-		err = session.DB(db.DatabaseName).C(db.CollectionName).Remove(bson.M{"id": ID})
+		return wh, false
+	}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Remove(bson.M{"id": ID})
+	if err != nil {
+		return wh, false
+	}
+
+	return wh, true
+}
+
+//
+/* ------------ RevisionDB ------------ */
+//
+
+/*
+Init initialises the revision DB
+*/
+func (db *RevisionDB) Init() {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	index := mgo.Index{
+		Key:        []string{"trackid", "revision"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+	}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).EnsureIndex(index)
+	if err != nil {
+		panic(err)
+	}
+}
+
+/*
+Add adds a revision of a track to the database
+*/
+func (db *RevisionDB) Add(rev TrackRevision) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Insert(rev)
+	if err != nil {
+		fmt.Printf("Error inserting revision into the DB: %s", err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+GetAll returns all the revisions of a track, oldest first
+*/
+func (db *RevisionDB) GetAll(trackID int) ([]TrackRevision, error) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	revisions := []TrackRevision{}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{"trackid": trackID}).Sort("revision").All(&revisions)
+	if err != nil {
+		return []TrackRevision{}, err
+	}
+
+	return revisions, nil
+}
+
+//
+/* ------------ PointsDB ------------ */
+//
+
+/*
+Init initialises the points DB
+*/
+func (db *PointsDB) Init() {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	index := mgo.Index{
+		Key:        []string{"trackid"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+	}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).EnsureIndex(index)
+	if err != nil {
+		panic(err)
+	}
+}
+
+/*
+Set stores the points of a track, replacing the points already stored for it
+*/
+func (db *PointsDB) Set(trackID int, points []TrackPoint) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	_, err = session.DB(db.DatabaseName).C(db.CollectionName).Upsert(bson.M{"trackid": trackID}, TrackPoints{TrackID: trackID, Points: points})
+	if err != nil {
+		fmt.Printf("Error storing the points of track %d: %s", trackID, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+Get returns the points of a track, and if they were found
+*/
+func (db *PointsDB) Get(trackID int) ([]TrackPoint, bool) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	var points TrackPoints
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{"trackid": trackID}).One(&points)
+	if err != nil {
+		return []TrackPoint{}, false
+	}
+
+	return points.Points, true
+}
+
+/*
+DeleteAll deletes every revision of a track
+*/
+func (db *RevisionDB) DeleteAll(trackID int) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	_, err = session.DB(db.DatabaseName).C(db.CollectionName).RemoveAll(bson.M{"trackid": trackID})
+	return err == nil
+}
+
+/*
+Delete deletes the points of a track
+*/
+func (db *PointsDB) Delete(trackID int) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Remove(bson.M{"trackid": trackID})
+	return err == nil
+}
+
+//
+/* ------------ SiteDB ------------ */
+//
+
+/*
+Init initialises the site DB
+*/
+func (db *SiteDB) Init() {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	index := mgo.Index{
+		Key:        []string{"id"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+	}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).EnsureIndex(index)
+	if err != nil {
+		panic(err)
+	}
+}
+
+/*
+Add adds a site to the database
+*/
+func (db *SiteDB) Add(site Site) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Insert(site)
+	if err != nil {
+		fmt.Printf("Error inserting site into the DB: %s", err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+Update replaces the stored site with the same ID
+*/
+func (db *SiteDB) Update(site Site) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Update(bson.M{"id": site.ID}, site)
+	if err != nil {
+		fmt.Printf("Error updating site %d in the DB: %s", site.ID, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+Get returns the site with the given ID, and if it was found
+*/
+func (db *SiteDB) Get(ID int) (Site, bool) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	var site Site
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{"id": ID}).One(&site)
+	if err != nil {
+		return Site{}, false
+	}
+
+	return site, true
+}
+
+/*
+GetAll returns all the sites, sorted by ID
+*/
+func (db *SiteDB) GetAll() ([]Site, error) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	sites := []Site{}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(nil).Sort("id").All(&sites)
+	if err != nil {
+		return []Site{}, err
+	}
+
+	return sites, nil
+}
+
+/*
+GetLastID returns the last site ID used, or -1 if there are no sites
+*/
+func (db *SiteDB) GetLastID() int {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	var site Site
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(nil).Sort("-id").One(&site)
+	if err != nil {
+		return -1
+	}
+
+	return site.ID
+}
+
+//
+/* ------------ PilotDB ------------ */
+//
+
+/*
+Init initialises the pilot DB
+*/
+func (db *PilotDB) Init() {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	index := mgo.Index{
+		Key:        []string{"id"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+	}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).EnsureIndex(index)
+	if err != nil {
+		panic(err)
+	}
+}
+
+/*
+AddTrack adds a track to the totals of its pilot, creating the pilot if it's the pilot's first track.
+The update is done in one operation, so concurrent ingestions don't overwrite each other
+*/
+func (db *PilotDB) AddTrack(t TrackInfo) bool {
+	if t.PilotID == "" {
+		return false
+	}
+
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	update := bson.M{
+		"$setOnInsert": bson.M{"name": strings.Join(strings.Fields(t.Pilot), " ")},
+		"$inc":         bson.M{"flights": 1, "airtime": t.Airtime, "distance": t.TrackLength},
+		"$max":         bson.M{"bestscore": t.Score},
+	}
+	if t.Glider != "" {
+		update["$addToSet"] = bson.M{"gliders": t.Glider}
+	}
+
+	_, err = session.DB(db.DatabaseName).C(db.CollectionName).Upsert(bson.M{"id": t.PilotID}, update)
+	if err != nil {
+		fmt.Printf("Error updating pilot %s in the DB: %s", t.PilotID, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+Set stores the pilot, replacing the stored profile
+*/
+func (db *PilotDB) Set(p Pilot) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	_, err = session.DB(db.DatabaseName).C(db.CollectionName).Upsert(bson.M{"id": p.ID}, p)
+	if err != nil {
+		fmt.Printf("Error storing pilot %s in the DB: %s", p.ID, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+Get returns the pilot with the given ID, and if it was found
+*/
+func (db *PilotDB) Get(ID string) (Pilot, bool) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	var pilot Pilot
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{"id": ID}).One(&pilot)
+	if err != nil {
+		return Pilot{}, false
+	}
+
+	return pilot, true
+}
+
+/*
+GetAll returns all the pilots, sorted by ID
+*/
+func (db *PilotDB) GetAll() ([]Pilot, error) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	pilots := []Pilot{}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(nil).Sort("id").All(&pilots)
+	if err != nil {
+		return []Pilot{}, err
+	}
+
+	return pilots, nil
+}
+
+/*
+Delete deletes the pilot with the given ID
+*/
+func (db *PilotDB) Delete(ID string) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Remove(bson.M{"id": ID})
+	return err == nil
+}
+
+//
+/* ------------ GliderDB ------------ */
+//
+
+/*
+Init initialises the glider DB
+*/
+func (db *GliderDB) Init() {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	for _, key := range []string{"id", "class"} {
+		index := mgo.Index{
+			Key:        []string{key},
+			Unique:     key == "id",
+			DropDups:   key == "id",
+			Background: true,
+		}
+
+		err = session.DB(db.DatabaseName).C(db.CollectionName).EnsureIndex(index)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+/*
+AddTrack adds a track to the totals of its glider, creating the glider if it's the glider's first track
+*/
+func (db *GliderDB) AddTrack(t TrackInfo) bool {
+	id := NormalizeGliderID(t.GliderID)
+	if id == "" {
+		return false
+	}
+
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	update := bson.M{
+		"$setOnInsert": bson.M{"model": strings.TrimSpace(t.Glider), "class": "", "owner": ""},
+		"$inc":         bson.M{"flights": 1, "airtime": t.Airtime, "distance": t.TrackLength},
+	}
+
+	_, err = session.DB(db.DatabaseName).C(db.CollectionName).Upsert(bson.M{"id": id}, update)
+	if err != nil {
+		fmt.Printf("Error updating glider %s in the DB: %s", id, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+Register sets the model, class and owner of a glider, creating the glider if it doesn't exist
+*/
+func (db *GliderDB) Register(id string, registration GliderRegistration) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	update := bson.M{
+		"$set":         bson.M{"model": registration.Model, "class": registration.Class, "owner": registration.Owner},
+		"$setOnInsert": bson.M{"flights": 0, "airtime": 0, "distance": 0},
+	}
+
+	_, err = session.DB(db.DatabaseName).C(db.CollectionName).Upsert(bson.M{"id": id}, update)
+	if err != nil {
+		fmt.Printf("Error registering glider %s in the DB: %s", id, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+SetTotals replaces the totals of a glider, the registered fields are only set if the glider doesn't exist
+*/
+func (db *GliderDB) SetTotals(g Glider) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	update := bson.M{
+		"$set":         bson.M{"flights": g.Flights, "airtime": g.Airtime, "distance": g.Distance},
+		"$setOnInsert": bson.M{"model": g.Model, "class": g.Class, "owner": g.Owner},
+	}
+
+	_, err = session.DB(db.DatabaseName).C(db.CollectionName).Upsert(bson.M{"id": g.ID}, update)
+	if err != nil {
+		fmt.Printf("Error storing glider %s in the DB: %s", g.ID, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+Get returns the glider with the given ID, and if it was found
+*/
+func (db *GliderDB) Get(ID string) (Glider, bool) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	var glider Glider
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{"id": ID}).One(&glider)
+	if err != nil {
+		return Glider{}, false
+	}
+
+	return glider, true
+}
+
+/*
+GetAll returns all the gliders, sorted by ID. If a class is given only gliders of that class are returned
+*/
+func (db *GliderDB) GetAll(class string) ([]Glider, error) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	query := bson.M{}
+	if class != "" {
+		query["class"] = class
+	}
+
+	gliders := []Glider{}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(query).Sort("id").All(&gliders)
+	if err != nil {
+		return []Glider{}, err
+	}
+
+	return gliders, nil
+}
+
+//
+/* ------------ AuditDB ------------ */
+//
+
+/*
+Init initialises the audit DB
+*/
+func (db *AuditDB) Init() {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	index := mgo.Index{
+		Key:        []string{"trackid", "timestamp"},
+		Background: true,
+	}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).EnsureIndex(index)
+	if err != nil {
+		panic(err)
+	}
+}
+
+/*
+Add adds an entry to the audit trail
+*/
+func (db *AuditDB) Add(entry AuditEntry) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Insert(entry)
+	if err != nil {
+		fmt.Printf("Error adding an audit entry of track %d to the DB: %s", entry.TrackID, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+GetAll returns the audit trail of a track, oldest first
+*/
+func (db *AuditDB) GetAll(trackID int) ([]AuditEntry, error) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	entries := []AuditEntry{}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{"trackid": trackID}).Sort("timestamp").All(&entries)
+	if err != nil {
+		return []AuditEntry{}, err
+	}
+
+	return entries, nil
+}
+
+//
+/* ------------ JobDB ------------ */
+//
+
+/*
+Init initialises the job DB, jobs are removed by the database jobRetention after they were created
+*/
+func (db *JobDB) Init() {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	indexes := []mgo.Index{
+		{Key: []string{"id"}, Unique: true, DropDups: true, Background: true},
+		{Key: []string{"createdat"}, ExpireAfter: jobRetention, Background: true},
+	}
+	for _, index := range indexes {
+		err = session.DB(db.DatabaseName).C(db.CollectionName).EnsureIndex(index)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+/*
+Add adds a job, returns false if a job with the same ID already exists
+*/
+func (db *JobDB) Add(job FetchJob) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Insert(job)
+	if err != nil {
+		fmt.Printf("Error adding job %s to the DB: %s", job.ID, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+Update replaces the stored job with the same ID, returns if the update was successful
+*/
+func (db *JobDB) Update(job FetchJob) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Update(bson.M{"id": job.ID}, job)
+	if err != nil {
+		fmt.Printf("Error updating job %s in the DB: %s", job.ID, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+Get returns the job with the given ID, and if it was found
+*/
+func (db *JobDB) Get(ID string) (FetchJob, bool) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	var job FetchJob
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{"id": ID}).One(&job)
+	if err != nil {
+		return FetchJob{}, false
+	}
+
+	return job, true
+}
+
+//
+/* ------------ APIKeyDB ------------ */
+//
+
+/*
+Init initialises the API key DB
+*/
+func (db *APIKeyDB) Init() {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	for _, key := range []string{"id", "hash"} {
+		index := mgo.Index{
+			Key:        []string{key},
+			Unique:     true,
+			DropDups:   true,
+			Background: true,
+		}
+
+		err = session.DB(db.DatabaseName).C(db.CollectionName).EnsureIndex(index)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+/*
+Add adds a key, returns false if it couldn't be added
+*/
+func (db *APIKeyDB) Add(key APIKey) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Insert(key)
+	if err != nil {
+		fmt.Printf("Error adding API key %s to the DB: %s", key.ID, err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+GetByHash returns the key with the hash, and if it was found
+*/
+func (db *APIKeyDB) GetByHash(hash string) (APIKey, bool) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	var key APIKey
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(bson.M{"hash": hash}).One(&key)
+	if err != nil {
+		return APIKey{}, false
+	}
+
+	return key, true
+}
+
+/*
+GetAll returns all the keys, revoked keys included, sorted by when they were created
+*/
+func (db *APIKeyDB) GetAll() ([]APIKey, error) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	keys := []APIKey{}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Find(nil).Sort("created").All(&keys)
+	if err != nil {
+		return []APIKey{}, err
+	}
+
+	return keys, nil
+}
+
+/*
+Revoke revokes the key with the ID, returns false if no key that isn't revoked has the ID
+*/
+func (db *APIKeyDB) Revoke(ID string, revokedAt int64) bool {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	query := bson.M{"id": ID, "revokedat": bson.M{"$not": bson.M{"$gt": 0}}}
+	err = session.DB(db.DatabaseName).C(db.CollectionName).Update(query, bson.M{"$set": bson.M{"revokedat": revokedAt}})
+	return err == nil
+}
+
+//
+/* ------------ RateLimitDB ------------ */
+//
+
+/*
+Init initialises the rate limit DB. Buckets expire when they would have been refilled, using a TTL index
+*/
+func (db *RateLimitDB) Init() {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	index := mgo.Index{
+		Key:        []string{"key"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+	}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).EnsureIndex(index)
+	if err != nil {
+		panic(err)
+	}
+
+	err = session.DB(db.DatabaseName).C(db.CollectionName).EnsureIndex(mgo.Index{Key: []string{"expires"}, ExpireAfter: time.Second})
+	if err != nil {
+		panic(err)
+	}
+}
+
+/*
+Take takes a token from the bucket with the key. The bucket is only written if it hasn't changed since it was
+read, and is read again if it has, so concurrent requests to different servers can't take the same token
+*/
+func (db *RateLimitDB) Take(key string, limit RateLimit, now time.Time) (bool, time.Duration) {
+	session, err := mgo.Dial(db.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer session.Close()
+
+	c := session.DB(db.DatabaseName).C(db.CollectionName)
+
+	type bucket struct {
+		Key     string    `bson:"key"`
+		Tokens  float64   `bson:"tokens"`
+		Updated int64     `bson:"updated"` // Unix nanoseconds, used to detect concurrent changes
+		Expires time.Time `bson:"expires"`
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		var stored bucket
+		found := c.Find(bson.M{"key": key}).One(&stored) == nil
+
+		tokens := float64(limit.Requests)
+		if found {
+			tokens = limit.Refill(stored.Tokens, now.Sub(time.Unix(0, stored.Updated)))
+		}
+
+		allowed, wait := tokens >= 1, time.Duration(0)
+		if allowed {
+			tokens--
+		} else {
+			wait = limit.Wait(tokens)
+		}
+
+		updated := bucket{Key: key, Tokens: tokens, Updated: now.UnixNano(), Expires: now.Add(limit.Per)}
+		if !found {
+			err = c.Insert(updated)
+		} else {
+			err = c.Update(bson.M{"key": key, "updated": stored.Updated}, updated)
+		}
+		if err == nil {
+			return allowed, wait
+		}
+		if err != mgo.ErrNotFound && !mgo.IsDup(err) {
+			fmt.Println("Error updating the rate limit:", err.Error())
+			return true, 0 // The limiter failing shouldn't take the API down
+		}
 	}
 
-	return wh
+	return false, time.Second // Too many concurrent requests from the same client
 }
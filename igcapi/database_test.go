@@ -1,6 +1,7 @@
 package igcapi
 
 import (
+	"os"
 	"reflect"
 	"testing"
 
@@ -9,7 +10,16 @@ import (
 	mgo "gopkg.in/mgo.v2"
 )
 
+// requireMongo skips tests that use MongoDB directly when the stores are in memory
+func requireMongo(t *testing.T) {
+	if storage, _ := os.LookupEnv("TRACK_STORAGE"); storage == "memory" {
+		t.Skip("Uses MongoDB, TRACK_STORAGE is memory")
+	}
+}
+
 func setup(t *testing.T) *TrackDB {
+	requireMongo(t)
+
 	db := &TrackDB{
 		DatabaseURL:    "mongodb://localhost",
 		DatabaseName:   "testTrackDB",
@@ -155,3 +165,23 @@ func Test_addDuplicateToDB(t *testing.T) {
 		t.Error("The same track could be added twice")
 	}
 }
+
+// Tests that the IDs of purged tracks aren't used again
+func Test_lastIDAfterPurge(t *testing.T) {
+	db := setup(t)
+	defer tearDown(t, db)
+
+	db.Init()
+	if lastID := db.GetLastID(); lastID != -1 {
+		t.Errorf("Expected -1 without tracks, got %d", lastID)
+	}
+
+	db.Add(TrackInfo{ID: 1, TrackSourceURL: "a"})
+	db.Add(TrackInfo{ID: 2, TrackSourceURL: "b"})
+	db.Delete(2, 1000)
+	db.Purge(1000)
+
+	if lastID := db.GetLastID(); lastID != 2 {
+		t.Errorf("Expected the last ID to stay 2 after purging track 2, got %d", lastID)
+	}
+}
@@ -0,0 +1,134 @@
+package igcapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+/*
+The codes of API errors, they tell clients what went wrong without parsing the message
+*/
+const (
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeInvalidID        = "invalid_id"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeInvalidBody      = "invalid_body"
+	CodeInvalidURL       = "invalid_url"
+	CodeInvalidIGC       = "invalid_igc"
+	CodeFetchFailed      = "fetch_failed"
+	CodeBodyTooLarge     = "body_too_large"
+	CodeConflict         = "conflict"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+)
+
+/*
+APIError is the error returned by every endpoint, rendered as an RFC 7807 problem ("application/problem+json").
+Code and Details are extension members: Code is one of the Code constants, Details has optional structured information
+*/
+type APIError struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Code     string      `json:"code"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+/*
+NewAPIError creates an error with the status, code and message
+*/
+func NewAPIError(status int, code, message string) *APIError {
+	return &APIError{
+		Type:   "about:blank", // The status and code describe the problem, there are no documents for the types
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: message,
+		Code:   code,
+	}
+}
+
+func (e *APIError) Error() string {
+	return e.Detail
+}
+
+/*
+WithDetails returns the error with the details set
+*/
+func (e *APIError) WithDetails(details interface{}) *APIError {
+	e.Details = details
+	return e
+}
+
+/*
+WriteError writes the error as the response, with the path of the request as the instance
+*/
+func WriteError(w http.ResponseWriter, r *http.Request, err *APIError) {
+	if r != nil {
+		err.Instance = r.URL.Path
+	}
+
+	w.Header().Set("content-type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(err)
+}
+
+// writeError writes an error with the status, code and message
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	WriteError(w, r, NewAPIError(status, code, message))
+}
+
+// notFound writes a 404 error for a resource that doesn't exist
+func notFound(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, http.StatusNotFound, CodeNotFound, message)
+}
+
+// methodNotAllowed writes a 405 error, with the methods the resource supports in the Allow header
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	WriteError(w, r, NewAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed,
+		"The method "+r.Method+" isn't supported, use "+strings.Join(allowed, " or ")))
+}
+
+/*
+HandlerNotFound responds with a 404 error, used for the paths that don't exist
+*/
+func HandlerNotFound(w http.ResponseWriter, r *http.Request) {
+	notFound(w, r, "The resource doesn't exist")
+}
+
+// internalError writes a 500 error, the message tells what couldn't be done
+func internalError(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, http.StatusInternalServerError, CodeInternal, message)
+}
+
+/*
+FetchError maps an error from fetching a track to an API error: URLs that can't be fetched are the client's
+fault (400), files that aren't IGC files can't be processed (422), and failing remote servers are 502
+*/
+func FetchError(err error, failures []string) *APIError {
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, ErrInvalidScheme), errors.Is(err, ErrHostNotAllowed), errors.Is(err, ErrPrivateAddress):
+		apiErr = NewAPIError(http.StatusBadRequest, CodeInvalidURL, "The URL can't be fetched: "+err.Error())
+	case errors.Is(err, ErrBodyTooLarge):
+		apiErr = NewAPIError(http.StatusUnprocessableEntity, CodeBodyTooLarge, "The file at the URL is too large")
+	case errors.Is(err, ErrNotIGC):
+		apiErr = NewAPIError(http.StatusUnprocessableEntity, CodeInvalidIGC, "The file at the URL isn't a valid IGC file")
+	default:
+		apiErr = NewAPIError(http.StatusBadGateway, CodeFetchFailed, "The file at the URL couldn't be fetched")
+	}
+
+	if len(failures) > 0 {
+		apiErr.Details = map[string][]string{"attempts": failures}
+	}
+
+	return apiErr
+}
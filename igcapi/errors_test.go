@@ -0,0 +1,113 @@
+package igcapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Tests that errors are written as problem details, with the path as the instance
+func Test_writeError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/paragliding/api/track/abc", nil)
+	w := httptest.NewRecorder()
+
+	WriteError(w, r, NewAPIError(http.StatusBadRequest, CodeInvalidID, "Invalid ID type given").WithDetails(map[string]string{"id": "abc"}))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+	if contentType := w.Header().Get("content-type"); contentType != "application/problem+json" {
+		t.Errorf("Expected application/problem+json, got '%s'", contentType)
+	}
+
+	var problem map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Fatalf("Couldn't decode the error: %s", err.Error())
+	}
+
+	expected := map[string]interface{}{
+		"type":     "about:blank",
+		"title":    "Bad Request",
+		"status":   float64(http.StatusBadRequest),
+		"detail":   "Invalid ID type given",
+		"instance": "/paragliding/api/track/abc",
+		"code":     CodeInvalidID,
+	}
+	for key, value := range expected {
+		if problem[key] != value {
+			t.Errorf("Expected %s to be '%v', got '%v'", key, value, problem[key])
+		}
+	}
+	if details, ok := problem["details"].(map[string]interface{}); !ok || details["id"] != "abc" {
+		t.Errorf("Expected the details, got '%v'", problem["details"])
+	}
+}
+
+// Tests that unsupported methods get 405 with the allowed methods
+func Test_methodNotAllowed(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/paragliding/api/ticker/", nil)
+	w := httptest.NewRecorder()
+
+	NewRouter().ServeHTTP(w, r)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("Expected Allow: GET, HEAD, OPTIONS, got '%s'", allow)
+	}
+}
+
+// Tests that tracks that don't exist get 404, and IDs that aren't numbers 400
+func Test_trackErrors(t *testing.T) {
+	defer func(storage TrackStorage) { db = storage }(db)
+	db = &TrackMemoryDB{}
+
+	tests := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/paragliding/api/track/1", http.StatusNotFound, CodeNotFound},
+		{"/paragliding/api/track/abc", http.StatusBadRequest, CodeInvalidID},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		NewRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		var problem APIError
+		json.NewDecoder(w.Body).Decode(&problem)
+		if w.Code != test.status || problem.Code != test.code {
+			t.Errorf("%s: expected %d %s, got %d %s", test.path, test.status, test.code, w.Code, problem.Code)
+		}
+	}
+}
+
+// Tests that fetch errors are mapped to the right status codes
+func Test_fetchError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{ErrInvalidScheme, http.StatusBadRequest, CodeInvalidURL},
+		{fmt.Errorf("dial: %w", ErrPrivateAddress), http.StatusBadRequest, CodeInvalidURL},
+		{ErrBodyTooLarge, http.StatusUnprocessableEntity, CodeBodyTooLarge},
+		{fmt.Errorf("%w: no B records", ErrNotIGC), http.StatusUnprocessableEntity, CodeInvalidIGC},
+		{errors.New("connection refused"), http.StatusBadGateway, CodeFetchFailed},
+	}
+
+	for _, test := range tests {
+		apiErr := FetchError(test.err, []string{"attempt 1: " + test.err.Error()})
+		if apiErr.Status != test.status || apiErr.Code != test.code {
+			t.Errorf("%s: expected %d %s, got %d %s", test.err.Error(), test.status, test.code, apiErr.Status, apiErr.Code)
+		}
+		if apiErr.Details == nil {
+			t.Errorf("%s: expected the attempts as details", test.err.Error())
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package igcapi
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+The names of the events, used where they are sent out of the API
+*/
+const (
+	EventTrackAdded        = "track_added"
+	EventTrackUpdated      = "track_updated"
+	EventTrackDeleted      = "track_deleted"
+	EventTrackRestored     = "track_restored"
+	EventJobStatus         = "job_status"
+	EventWebhookRegistered = "webhook_registered"
+	EventWebhookDeleted    = "webhook_deleted"
+)
+
+var events = NewEventBus() // The bus the handlers publish to
+
+var droppedLogInterval = time.Minute // How often the events lost by a subscription are logged at most
+
+/*
+Event is published on the event bus, the events are the types below
+*/
+type Event interface {
+	EventName() string
+}
+
+/*
+TrackAdded is published when a track has been ingested
+*/
+type TrackAdded struct {
+	Track TrackInfo
+}
+
+/*
+TrackUpdated is published when the metadata of a track has been edited, or a new revision has been fetched
+*/
+type TrackUpdated struct {
+	Before TrackInfo
+	After  TrackInfo
+}
+
+/*
+TrackDeleted is published when a track has been moved to the trash
+*/
+type TrackDeleted struct {
+	Track TrackInfo
+}
+
+/*
+TracksDeleted is published when every track has been moved to the trash at once
+*/
+type TracksDeleted struct {
+	Tracks []TrackInfo
+}
+
+/*
+TrackRestored is published when a track has been restored from the trash
+*/
+type TrackRestored struct {
+	Track TrackInfo
+}
+
+/*
+JobStatus is published when the fetch of a track to add starts and ends. The track ID is set when the track was added
+*/
+type JobStatus struct {
+	Job     FetchJob
+	TrackID int
+}
+
+/*
+WebhookRegistered is published when a webhook has been registered
+*/
+type WebhookRegistered struct {
+	Webhook Webhook
+}
+
+/*
+WebhookDeleted is published when a webhook has been deleted
+*/
+type WebhookDeleted struct {
+	Webhook Webhook
+}
+
+/*
+EventName returns the name of the event
+*/
+func (TrackAdded) EventName() string { return EventTrackAdded }
+
+/*
+EventName returns the name of the event
+*/
+func (TrackUpdated) EventName() string { return EventTrackUpdated }
+
+/*
+EventName returns the name of the event
+*/
+func (TrackDeleted) EventName() string { return EventTrackDeleted }
+
+/*
+EventName returns the name of the event, the same as for a single track
+*/
+func (TracksDeleted) EventName() string { return EventTrackDeleted }
+
+/*
+EventName returns the name of the event
+*/
+func (TrackRestored) EventName() string { return EventTrackRestored }
+
+/*
+EventName returns the name of the event
+*/
+func (JobStatus) EventName() string { return EventJobStatus }
+
+/*
+EventName returns the name of the event
+*/
+func (WebhookRegistered) EventName() string { return EventWebhookRegistered }
+
+/*
+EventName returns the name of the event
+*/
+func (WebhookDeleted) EventName() string { return EventWebhookDeleted }
+
+/*
+TrackChanges returns the tracks an event has changed, as they are after the change. Events that aren't about tracks have none
+*/
+func TrackChanges(event Event) []TrackInfo {
+	switch e := event.(type) {
+	case TrackAdded:
+		return []TrackInfo{e.Track}
+	case TrackUpdated:
+		return []TrackInfo{e.After}
+	case TrackDeleted:
+		return []TrackInfo{e.Track}
+	case TracksDeleted:
+		return e.Tracks
+	case TrackRestored:
+		return []TrackInfo{e.Track}
+	}
+
+	return nil
+}
+
+/*
+EventBus delivers the published events to the listeners and subscriptions. Listeners are called by Publish,
+for what has to be done before the handler responds. Subscriptions get the events through a buffer,
+publishing never waits for them and subscriptions that don't keep up lose the events that don't fit
+*/
+type EventBus struct {
+	mutex         sync.Mutex
+	listeners     []func(Event)
+	subscriptions map[*Subscription]bool
+}
+
+/*
+Subscription receives the events published on a bus until it's closed
+*/
+type Subscription struct {
+	Events <-chan Event
+
+	bus      *EventBus
+	events   chan Event
+	dropped  int
+	logged   int       // The dropped events already logged
+	loggedAt time.Time // When the dropped events were last logged
+}
+
+/*
+NewEventBus creates a bus without listeners and subscriptions
+*/
+func NewEventBus() *EventBus {
+	return &EventBus{subscriptions: make(map[*Subscription]bool)}
+}
+
+/*
+Listen adds a listener, called with every published event before Publish returns. Listeners are called in the
+order they were added, before the event is sent to the subscriptions
+*/
+func (bus *EventBus) Listen(listener func(Event)) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.listeners = append(bus.listeners, listener)
+}
+
+/*
+Subscribe returns a subscription to the events published from now on, buffering up to the given amount of events
+*/
+func (bus *EventBus) Subscribe(buffer int) *Subscription {
+	events := make(chan Event, buffer)
+	subscription := &Subscription{Events: events, bus: bus, events: events}
+
+	bus.mutex.Lock()
+	bus.subscriptions[subscription] = true
+	bus.mutex.Unlock()
+
+	return subscription
+}
+
+/*
+Publish calls the listeners with the event, and sends it to every subscription
+*/
+func (bus *EventBus) Publish(event Event) {
+	bus.mutex.Lock()
+	listeners := bus.listeners
+	bus.mutex.Unlock()
+
+	for _, listener := range listeners { // Without the lock, so listeners can publish too
+		listener(event)
+	}
+
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	for subscription := range bus.subscriptions {
+		select {
+		case subscription.events <- event:
+		default: // The buffer is full
+			if lost := subscription.drop(time.Now()); lost > 0 {
+				fmt.Printf("A subscription couldn't keep up and lost %d events, the last %s, %d lost in total\n", lost, event.EventName(), subscription.dropped)
+			}
+		}
+	}
+}
+
+// drop counts a lost event, and returns the events lost since they were last logged if it's time to log them again.
+// Called with the lock of the bus held
+func (s *Subscription) drop(now time.Time) int {
+	s.dropped++
+	if now.Sub(s.loggedAt) < droppedLogInterval {
+		return 0
+	}
+
+	lost := s.dropped - s.logged
+	s.logged, s.loggedAt = s.dropped, now
+	return lost
+}
+
+/*
+Dropped returns the amount of events the subscription has lost because its buffer was full
+*/
+func (s *Subscription) Dropped() int {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+
+	return s.dropped
+}
+
+/*
+Consume calls the handler with every event of the subscription until it's closed
+*/
+func (s *Subscription) Consume(handler func(Event)) {
+	for event := range s.Events {
+		handler(event)
+	}
+}
+
+/*
+Close ends the subscription and closes its channel
+*/
+func (s *Subscription) Close() {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+
+	if s.bus.subscriptions[s] {
+		delete(s.bus.subscriptions, s)
+		close(s.events)
+	}
+}
+
+/*
+StartSubscribers makes the aggregates, the Discord notifier and the webhooks react to the published events.
+The aggregates are updated before the handlers respond, the notifications are sent in the background,
+the webhooks by a fixed amount of workers
+*/
+func StartSubscribers() {
+	events.Listen(UpdateAggregates)
+	go events.Subscribe(256).Consume(discord.Notify)
+	go events.Subscribe(256).Consume(DispatchWebhooks)
+	for i := 0; i < webhookWorkers; i++ {
+		go SendWebhooks(webhookQueue)
+	}
+}
@@ -0,0 +1,139 @@
+package igcapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// trackID returns the ID of the added track of the event
+func trackID(event Event) int {
+	return event.(TrackAdded).Track.ID
+}
+
+// Tests that events are delivered to every subscription, and lost only by full subscriptions
+func Test_eventBus(t *testing.T) {
+	bus := NewEventBus()
+	first := bus.Subscribe(2)
+	second := bus.Subscribe(1)
+
+	bus.Publish(TrackAdded{Track: TrackInfo{ID: 1}})
+	bus.Publish(TrackAdded{Track: TrackInfo{ID: 2}})
+
+	for _, want := range []int{1, 2} {
+		if id := trackID(<-first.Events); id != want {
+			t.Errorf("Expected the track %d, got %d", want, id)
+		}
+	}
+	if id := trackID(<-second.Events); id != 1 {
+		t.Errorf("Expected the track 1, got %d", id)
+	}
+	if first.Dropped() != 0 || second.Dropped() != 1 {
+		t.Errorf("Expected 0 and 1 dropped events, got %d and %d", first.Dropped(), second.Dropped())
+	}
+
+	second.Close()
+	second.Close() // Closing twice does nothing
+	if _, open := <-second.Events; open {
+		t.Error("The channel of a closed subscription should be closed")
+	}
+
+	bus.Publish(TrackAdded{Track: TrackInfo{ID: 3}}) // Not sent to the closed subscription
+	if id := trackID(<-first.Events); id != 3 {
+		t.Errorf("Expected the track 3, got %d", id)
+	}
+}
+
+// Tests that the lost events are logged at most once per interval, with the events lost since the last time
+func Test_subscriptionDrop(t *testing.T) {
+	s := &Subscription{}
+	start := time.Now()
+
+	for i, expected := range []struct {
+		at   time.Duration
+		lost int
+	}{
+		{0, 1}, // The first lost event is logged right away
+		{time.Second, 0},
+		{2 * time.Second, 0},
+		{droppedLogInterval, 3}, // The two before and this one
+		{droppedLogInterval + time.Second, 0},
+	} {
+		if lost := s.drop(start.Add(expected.at)); lost != expected.lost {
+			t.Errorf("Drop %d: expected %d events to log, got %d", i+1, expected.lost, lost)
+		}
+	}
+	if s.dropped != 5 {
+		t.Errorf("Expected 5 dropped events, got %d", s.dropped)
+	}
+}
+
+// Tests that listeners are called in order before Publish returns, and before the subscriptions get the event
+func Test_eventBus_listen(t *testing.T) {
+	bus := NewEventBus()
+	subscription := bus.Subscribe(1)
+
+	var calls []string
+	bus.Listen(func(event Event) {
+		if len(subscription.Events) != 0 {
+			t.Error("The subscription got the event before the listeners")
+		}
+		calls = append(calls, "first:"+event.EventName())
+	})
+	bus.Listen(func(event Event) {
+		calls = append(calls, "second:"+event.EventName())
+		if _, ok := event.(TrackDeleted); ok {
+			bus.Publish(TrackRestored{}) // Listeners can publish
+		}
+	})
+
+	bus.Publish(TrackDeleted{Track: TrackInfo{ID: 1}})
+
+	expected := []string{"first:track_deleted", "second:track_deleted", "first:track_restored", "second:track_restored"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the calls %v, got %v", expected, calls)
+	}
+}
+
+// Tests that Consume handles the buffered events, and returns when the subscription is closed
+func Test_subscription_consume(t *testing.T) {
+	bus := NewEventBus()
+	subscription := bus.Subscribe(3)
+
+	bus.Publish(TrackAdded{Track: TrackInfo{ID: 1}})
+	bus.Publish(WebhookRegistered{Webhook: Webhook{ID: 2}})
+	subscription.Close()
+	bus.Publish(TrackAdded{Track: TrackInfo{ID: 3}}) // After closing
+
+	var names []string
+	subscription.Consume(func(event Event) { names = append(names, event.EventName()) })
+
+	if expected := []string{EventTrackAdded, EventWebhookRegistered}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected the events %v, got %v", expected, names)
+	}
+}
+
+// Tests the tracks changed by the events
+func Test_trackChanges(t *testing.T) {
+	before := TrackInfo{ID: 1, Pilot: "John Doe"}
+	after := TrackInfo{ID: 1, Pilot: "Jane Doe"}
+
+	tests := []struct {
+		event  Event
+		tracks []TrackInfo
+	}{
+		{TrackAdded{Track: before}, []TrackInfo{before}},
+		{TrackUpdated{Before: before, After: after}, []TrackInfo{after}},
+		{TrackDeleted{Track: before}, []TrackInfo{before}},
+		{TracksDeleted{Tracks: []TrackInfo{before, {ID: 2}}}, []TrackInfo{before, {ID: 2}}},
+		{TrackRestored{Track: after}, []TrackInfo{after}},
+		{JobStatus{Job: FetchJob{Status: JobFetched}, TrackID: 1}, nil},
+		{WebhookDeleted{Webhook: Webhook{ID: 1}}, nil},
+	}
+
+	for _, test := range tests {
+		if tracks := TrackChanges(test.event); !reflect.DeepEqual(tracks, test.tracks) {
+			t.Errorf("Expected %v for %s, got %v", test.tracks, test.event.EventName(), tracks)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package igcapi
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	feedSize  = 20                                              // The default amount of tracks in a feed, the most recently added
+	publicURL = url.URL{Scheme: "http", Host: "localhost:8080"} // Where the API is reached, the feeds link to it
+)
+
+// The date of the tag URIs (RFC 4151) identifying the feeds and their tracks, they never change
+const tagDate = "2018"
+
+// The content types of the feeds
+const (
+	atomType = "application/atom+xml"
+	rssType  = "application/rss+xml"
+)
+
+/*
+AtomFeed is an Atom (RFC 4287) feed of tracks
+*/
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  AtomPerson  `xml:"author"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+/*
+AtomEntry is a track in an Atom feed
+*/
+type AtomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Author    AtomPerson `xml:"author"`
+	Summary   string     `xml:"summary"`
+	Links     []AtomLink `xml:"link"`
+}
+
+/*
+AtomLink is a link of an Atom feed or entry
+*/
+type AtomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+}
+
+/*
+AtomPerson is the author of an Atom feed or entry
+*/
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+/*
+RSSFeed is an RSS 2.0 feed of tracks
+*/
+type RSSFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+/*
+RSSChannel is the channel of an RSS feed
+*/
+type RSSChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []RSSItem `xml:"item"`
+}
+
+/*
+RSSItem is a track in an RSS feed. RSS items have a single link, the other links are in the description
+*/
+type RSSItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        RSSGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+/*
+RSSGUID is the unique ID of an RSS item
+*/
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// feedTrack is a track of a feed with the links of the track
+type feedTrack struct {
+	TrackInfo
+	Tag       string // The ID of the track in every feed and version
+	URL       string // The track's JSON
+	PointsURL string // The GPS fixes of the track
+}
+
+/*
+HandlerFeedAtom handles GET /paragliding/api/feed.atom?pilot=<pilot>&site=<ID>&limit=<n>,
+an Atom feed of the most recently added tracks
+*/
+func HandlerFeedAtom(w http.ResponseWriter, r *http.Request) {
+	title, tracks, ok := feedTracks(w, r)
+	if !ok {
+		return
+	}
+
+	self := requestURL(r)
+	feed := AtomFeed{
+		Title:   title,
+		ID:      feedTag(r),
+		Updated: feedUpdated(tracks).Format(time.RFC3339),
+		Author:  AtomPerson{Name: "Paragliding API"},
+		Links:   []AtomLink{{Rel: "self", Type: atomType, Href: self}},
+		Entries: []AtomEntry{},
+	}
+	for _, track := range tracks {
+		added := unixTime(track.Timestamp).Format(time.RFC3339)
+		feed.Entries = append(feed.Entries, AtomEntry{
+			Title:     feedTitle(track.TrackInfo),
+			ID:        track.Tag,
+			Published: added,
+			Updated:   added,
+			Author:    AtomPerson{Name: track.Pilot},
+			Summary:   feedSummary(track.TrackInfo),
+			Links: []AtomLink{
+				{Rel: "alternate", Type: jsonType, Title: "Track", Href: track.URL},
+				{Rel: "related", Type: jsonType, Title: "Points", Href: track.PointsURL},
+			},
+		})
+	}
+
+	writeXML(w, r, atomType, feed)
+}
+
+/*
+HandlerFeedRSS handles GET /paragliding/api/feed.rss?pilot=<pilot>&site=<ID>&limit=<n>,
+an RSS feed of the most recently added tracks
+*/
+func HandlerFeedRSS(w http.ResponseWriter, r *http.Request) {
+	title, tracks, ok := feedTracks(w, r)
+	if !ok {
+		return
+	}
+
+	channel := RSSChannel{
+		Title:       title,
+		Link:        requestURL(r),
+		Description: "The most recently added paragliding tracks",
+		Items:       []RSSItem{},
+	}
+	if len(tracks) > 0 {
+		channel.LastBuildDate = feedUpdated(tracks).Format(time.RFC1123Z)
+	}
+	for _, track := range tracks {
+		channel.Items = append(channel.Items, RSSItem{
+			Title:       feedTitle(track.TrackInfo),
+			Link:        track.URL,
+			Description: fmt.Sprintf("%s\nPoints: %s", feedSummary(track.TrackInfo), track.PointsURL),
+			GUID:        RSSGUID{IsPermaLink: false, Value: track.Tag},
+			PubDate:     unixTime(track.Timestamp).Format(time.RFC1123Z),
+		})
+	}
+
+	writeXML(w, r, rssType, RSSFeed{Version: "2.0", Channel: channel})
+}
+
+// feedTracks returns the title of the feed and its tracks, newest first. The tracks can be limited to a pilot
+// and a site the same way as the ticker. Writes 400 if the query parameters are invalid
+func feedTracks(w http.ResponseWriter, r *http.Request) (string, []feedTrack, bool) {
+	query := r.URL.Query()
+	filter, err := ParseTickerFilter(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return "", nil, false
+	}
+
+	page := PageRequest{Limit: feedSize, Sort: "timestamp", Descending: true}
+	if param := query.Get("limit"); param != "" {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit < 1 {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "invalid 'limit' given")
+			return "", nil, false
+		}
+		page.Limit = Min(limit, MaxPageLimit)
+	}
+
+	tracks, _, err := db.FindPage(filter, page)
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the tracks")
+		return "", nil, false
+	}
+
+	title := "Paragliding tracks"
+	if filter.PilotID != "" {
+		title += " of pilot " + filter.PilotID
+	}
+	if filter.SiteID != 0 {
+		title += " from site " + strconv.Itoa(filter.SiteID)
+	}
+
+	base := requestBase(r)
+	linked := []feedTrack{}
+	for _, track := range tracks {
+		trackURL := fmt.Sprintf("%s/track/%d", base, track.ID)
+		linked = append(linked, feedTrack{
+			TrackInfo: track,
+			Tag:       fmt.Sprintf("%strack/%d", tagPrefix(), track.ID),
+			URL:       trackURL,
+			PointsURL: trackURL + "/points",
+		})
+	}
+
+	return title, linked, true
+}
+
+// feedTitle returns the title of a track in a feed
+func feedTitle(track TrackInfo) string {
+	return fmt.Sprintf("%s: %.1f km on %s", track.Pilot, track.TrackLength, track.HDate.Format("2006-01-02"))
+}
+
+// feedSummary returns the details of a track in a feed
+func feedSummary(track TrackInfo) string {
+	return fmt.Sprintf("Pilot: %s\nGlider: %s\nDate: %s\nDistance: %.1f km",
+		track.Pilot, track.Glider, track.HDate.Format("2006-01-02"), track.TrackLength)
+}
+
+// feedUpdated returns when the newest track of the feed was added, or now for an empty feed
+func feedUpdated(tracks []feedTrack) time.Time {
+	if len(tracks) == 0 {
+		return time.Now().UTC()
+	}
+
+	return unixTime(tracks[0].Timestamp)
+}
+
+// tagPrefix returns the start of the tag URIs, like "tag:example.com,2018:"
+func tagPrefix() string {
+	return "tag:" + publicURL.Hostname() + "," + tagDate + ":"
+}
+
+// feedTag returns the ID of the feed, the same for the feeds with the same pilot and site in every format and version
+func feedTag(r *http.Request) string {
+	filter, _ := ParseTickerFilter(r.URL.Query()) // Already validated
+	tag := tagPrefix() + "feed"
+	if filter.PilotID != "" {
+		tag += "/pilot/" + filter.PilotID
+	}
+	if filter.SiteID != 0 {
+		tag += "/site/" + strconv.Itoa(filter.SiteID)
+	}
+
+	return tag
+}
+
+// requestBase returns the absolute URL of the API in the version of the request, like "https://example.com/paragliding/api/v2".
+// The configured public URL is used, the Host header is set by the client
+func requestBase(r *http.Request) string {
+	base := url.URL{Scheme: publicURL.Scheme, Host: publicURL.Host, Path: apiPrefix}
+	if version := RequestVersion(r); version != Version1 {
+		base.Path += "/" + version
+	}
+
+	return base.String()
+}
+
+// requestURL returns the absolute URL of the request
+func requestURL(r *http.Request) string {
+	base, _ := url.Parse(requestBase(r))
+	base.Path = r.URL.Path
+	base.RawQuery = r.URL.RawQuery
+
+	return base.String()
+}
+
+// writeXML writes the value as XML with the content type
+func writeXML(w http.ResponseWriter, r *http.Request, contentType string, value interface{}) {
+	data, err := xml.MarshalIndent(value, "", "  ")
+	if err != nil {
+		internalError(w, r, "Couldn't encode the feed")
+		return
+	}
+
+	w.Header().Set("content-type", contentType+"; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
@@ -0,0 +1,121 @@
+package igcapi
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// feedTestTracks are three tracks of two pilots from two sites
+var feedTestTracks = []TrackInfo{
+	{ID: 1, Pilot: "John Doe", PilotID: "john-doe", Glider: "Ozone Rush 5", SiteID: 1, TrackLength: 42.25,
+		HDate: time.Date(2018, 8, 3, 0, 0, 0, 0, time.UTC), Timestamp: 1540000000},
+	{ID: 2, Pilot: "Jane Doe", PilotID: "jane-doe", SiteID: 1, Timestamp: 1540000100},
+	{ID: 3, Pilot: "John Doe", PilotID: "john-doe", SiteID: 2, Timestamp: 1540000200},
+}
+
+// getFeed requests the feed and decodes it
+func getFeed(t *testing.T, path string, feed interface{}, header http.Header) string {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	if host := header.Get("Host"); host != "" {
+		r.Host = host
+	}
+	w := httptest.NewRecorder()
+	NewRouter().ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: expected 200, got %d", path, w.Code)
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), feed); err != nil {
+		t.Fatalf("%s: couldn't decode the feed: %s", path, err.Error())
+	}
+
+	return w.Header().Get("content-type")
+}
+
+// Tests that the Atom feed has the newest tracks first, with the details and links of the tracks
+func Test_feedAtom(t *testing.T) {
+	defer func(storage TrackStorage, public url.URL) { db, publicURL = storage, public }(db, publicURL)
+	db = testTrackDB(feedTestTracks...)
+	publicURL = url.URL{Scheme: "http", Host: "paragliding.example.com"}
+
+	var feed AtomFeed
+	contentType := getFeed(t, "/paragliding/api/feed.atom", &feed, nil)
+	if !strings.HasPrefix(contentType, atomType) {
+		t.Errorf("Expected %s, got %s", atomType, contentType)
+	}
+
+	if len(feed.Entries) != 3 || feed.Entries[0].ID != "tag:paragliding.example.com,2018:track/3" {
+		t.Fatalf("Expected the tracks 3, 2 and 1, got %+v", feed.Entries)
+	}
+	if feed.ID != "tag:paragliding.example.com,2018:feed" {
+		t.Errorf("Expected the tag of the feed, got %s", feed.ID)
+	}
+	var filtered AtomFeed
+	getFeed(t, "/paragliding/api/v2/feed.atom?site=1&pilot=John%20Doe", &filtered, nil)
+	if filtered.ID != "tag:paragliding.example.com,2018:feed/pilot/john-doe/site/1" {
+		t.Errorf("Expected the tag of the pilot's feed from the site, got %s", filtered.ID)
+	}
+	if feed.Updated != "2018-10-20T01:50:00Z" || feed.Links[0].Href != "http://paragliding.example.com/paragliding/api/feed.atom" {
+		t.Errorf("Expected the feed to be updated when track 3 was added, got %s (%+v)", feed.Updated, feed.Links)
+	}
+
+	entry := feed.Entries[2]
+	if entry.Author.Name != "John Doe" || entry.Published != "2018-10-20T01:46:40Z" {
+		t.Errorf("Expected John Doe's track added at 2018-10-20T01:46:40Z, got %+v", entry)
+	}
+	for _, detail := range []string{"Glider: Ozone Rush 5", "Date: 2018-08-03", "Distance: 42.2 km"} {
+		if !strings.Contains(entry.Summary, detail) {
+			t.Errorf("Expected '%s' in the summary, got '%s'", detail, entry.Summary)
+		}
+	}
+	if len(entry.Links) != 2 || entry.Links[1].Href != "http://paragliding.example.com/paragliding/api/track/1/points" {
+		t.Errorf("Expected links to the track and its points, got %+v", entry.Links)
+	}
+}
+
+// Tests that the RSS feed can be limited to a pilot and a site, and links to the version of the request
+// at the configured URL, whatever the Host header is
+func Test_feedRSS(t *testing.T) {
+	defer func(storage TrackStorage, public url.URL) { db, publicURL = storage, public }(db, publicURL)
+	db = testTrackDB(feedTestTracks...)
+	publicURL = url.URL{Scheme: "https", Host: "paragliding.example.com"}
+
+	var feed RSSFeed
+	header := http.Header{"Host": {"attacker.example.com"}}
+	contentType := getFeed(t, "/paragliding/api/v2/feed.rss?pilot=John%20Doe&limit=1", &feed, header)
+	if !strings.HasPrefix(contentType, rssType) {
+		t.Errorf("Expected %s, got %s", rssType, contentType)
+	}
+
+	items := feed.Channel.Items
+	if feed.Version != "2.0" || len(items) != 1 || items[0].Link != "https://paragliding.example.com/paragliding/api/v2/track/3" {
+		t.Fatalf("Expected only track 3 in v2, got %+v", feed)
+	}
+	if items[0].PubDate != "Sat, 20 Oct 2018 01:50:00 +0000" || !strings.Contains(items[0].Description, "Points: https://paragliding.example.com/paragliding/api/v2/track/3/points") {
+		t.Errorf("Unexpected item: %+v", items[0])
+	}
+	if !strings.Contains(feed.Channel.Title, "john-doe") {
+		t.Errorf("Expected the pilot in the title, got '%s'", feed.Channel.Title)
+	}
+
+	feed = RSSFeed{}
+	getFeed(t, "/paragliding/api/feed.rss?site=1&pilot=john-doe", &feed, nil)
+	if len(feed.Channel.Items) != 1 || feed.Channel.Items[0].GUID.Value != "tag:paragliding.example.com,2018:track/1" ||
+		feed.Channel.Items[0].GUID.IsPermaLink {
+		t.Errorf("Expected only track 1, got %+v", feed.Channel.Items)
+	}
+
+	feed = RSSFeed{}
+	getFeed(t, "/paragliding/api/feed.rss?site=3", &feed, nil)
+	if len(feed.Channel.Items) != 0 || feed.Channel.LastBuildDate != "" {
+		t.Errorf("Expected an empty feed, got %+v", feed.Channel)
+	}
+}
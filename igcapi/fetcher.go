@@ -0,0 +1,362 @@
+package igcapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	igc "github.com/marni/goigc"
+)
+
+var (
+	// ErrInvalidScheme is returned when the URL is not http or https
+	ErrInvalidScheme = errors.New("only http and https URLs can be fetched")
+	// ErrHostNotAllowed is returned when the host is not in the allowlist
+	ErrHostNotAllowed = errors.New("host is not in the list of allowed hosts")
+	// ErrPrivateAddress is returned when the host resolves to a private, loopback or link-local address
+	ErrPrivateAddress = errors.New("host resolves to a non-public address")
+	// ErrBodyTooLarge is returned when the remote file is larger than the maximum body size
+	ErrBodyTooLarge = errors.New("remote file is larger than the maximum allowed size")
+	// ErrNotIGC is returned when the remote file doesn't look like an IGC file
+	ErrNotIGC = errors.New("remote file is not an IGC file")
+)
+
+const (
+	maxIGCSize   = 5 << 20        // 5 MB, the largest IGC files are around 2 MB
+	jobRetention = 24 * time.Hour // How long the jobs of added tracks are stored
+
+	// JobFetching is the status of a job that has started
+	JobFetching = "fetching"
+	// JobFetched is the status of a job where the file was retrieved
+	JobFetched = "fetched"
+	// JobFailed is the status of a job where all the attempts failed
+	JobFailed = "failed"
+	// JobNotModified is the status of a conditional job where the file hasn't changed
+	JobNotModified = "not_modified"
+	// JobDuplicate is the status of a job where the file was retrieved, but the track had already been added
+	JobDuplicate = "duplicate"
+)
+
+/*
+FetchJob records the attempts made to retrieve a remote IGC file.
+If ETag or LastModified is set before fetching the request is made conditional,
+and after a successful fetch they hold the validators sent by the remote server.
+The jobs of added tracks are stored with an ID, and the ID of the track once it's added
+*/
+type FetchJob struct {
+	ID           string    `json:"id,omitempty"`
+	TrackID      int       `json:"track_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	URL          string    `json:"url"`
+	Status       string    `json:"status"`
+	Attempts     int       `json:"attempts"`
+	Failures     []string  `json:"failures"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	ContentHash  string    `json:"content_hash,omitempty"`
+}
+
+/*
+NewFetchJob creates a job with a new ID to fetch the file at the URL
+*/
+func NewFetchJob(url string) (FetchJob, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return FetchJob{}, err
+	}
+
+	return FetchJob{ID: id, CreatedAt: time.Now().UTC(), URL: url, Status: JobFetching}, nil
+}
+
+/*
+Fetcher retrieves remote IGC files with timeouts, a size cap and protection against
+requests to internal addresses
+*/
+type Fetcher struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	MaxBodySize    int64
+	MaxRetries     int
+	RetryDelay     time.Duration
+	AllowedHosts   []string // If empty every public host is allowed
+
+	allowPrivate bool // Only used by the tests, as httptest servers listen on loopback
+	client       *http.Client
+}
+
+/*
+Init sets up the HTTP client used by the fetcher
+*/
+func (f *Fetcher) Init() {
+	dialer := &net.Dialer{
+		Timeout: f.ConnectTimeout,
+		Control: f.checkAddress, // Runs after DNS resolution, so rebinding to an internal IP is caught as well
+	}
+
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   f.ConnectTimeout,
+		ResponseHeaderTimeout: f.ReadTimeout,
+	}
+
+	f.client = &http.Client{
+		Transport: transport,
+		Timeout:   f.ConnectTimeout + f.ReadTimeout,
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return f.checkURL(r.URL) // Redirects have to pass the same checks as the original URL
+		},
+	}
+}
+
+/*
+Fetch downloads the file at the job's URL, retrying on network errors and server errors.
+Every failed attempt is recorded on the job. If the request was conditional and the file
+hasn't changed, no content and no error is returned, and the job status is JobNotModified
+*/
+func (f *Fetcher) Fetch(job *FetchJob) ([]byte, error) {
+	if f.client == nil {
+		f.Init()
+	}
+
+	var err error
+	for job.Attempts < f.MaxRetries+1 {
+		if job.Attempts > 0 {
+			time.Sleep(f.RetryDelay * time.Duration(job.Attempts))
+		}
+		job.Attempts++
+
+		var content []byte
+		var retry bool
+		content, retry, err = f.fetchOnce(job)
+		if err == nil {
+			if content == nil {
+				job.Status = JobNotModified
+				return nil, nil
+			}
+
+			hash := sha256.Sum256(content)
+			job.ContentHash = hex.EncodeToString(hash[:])
+			job.Status = JobFetched
+			return content, nil
+		}
+
+		job.Failures = append(job.Failures, fmt.Sprintf("attempt %d: %s", job.Attempts, err.Error()))
+		if !retry {
+			break
+		}
+	}
+
+	job.Status = JobFailed
+	return nil, err
+}
+
+/*
+Post posts the body to the URL with the same checks of the URL and the addresses connected to as fetching,
+used to call URLs given by clients
+*/
+func (f *Fetcher) Post(rawURL, contentType string, body io.Reader) error {
+	if f.client == nil {
+		f.Init()
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if err = f.checkURL(u); err != nil {
+		return err
+	}
+
+	resp, err := f.client.Post(u.String(), contentType, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+/*
+FetchTrack fetches and parses the IGC file at the job's URL, and returns the parsed track and the
+content of the file. For a conditional job where the file hasn't changed an empty track is returned,
+check the job status for this. Files that can't be parsed give ErrNotIGC
+*/
+func (f *Fetcher) FetchTrack(job *FetchJob) (igc.Track, string, error) {
+	content, err := f.Fetch(job)
+	if err != nil || content == nil {
+		return igc.Track{}, "", err
+	}
+
+	track, err := igc.Parse(string(content))
+	if err != nil {
+		job.Status = JobFailed
+		job.Failures = append(job.Failures, fmt.Sprintf("parsing: %s", err.Error()))
+		return igc.Track{}, "", fmt.Errorf("%w: %v", ErrNotIGC, err)
+	}
+
+	return track, string(content), nil
+}
+
+// fetchOnce does a single request, and returns whether it makes sense to try again on failure.
+// No content and no error means the file hasn't been modified since the last fetch
+func (f *Fetcher) fetchOnce(job *FetchJob) ([]byte, bool, error) {
+	u, err := url.Parse(job.URL)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = f.checkURL(u); err != nil {
+		return nil, false, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if job.ETag != "" {
+		req.Header.Set("If-None-Match", job.ETag)
+	}
+	if job.LastModified != "" {
+		req.Header.Set("If-Modified-Since", job.LastModified)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		blocked := errors.Is(err, ErrPrivateAddress) || errors.Is(err, ErrHostNotAllowed) || errors.Is(err, ErrInvalidScheme)
+		return nil, !blocked, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, false, nil
+	}
+	if resp.StatusCode >= 500 {
+		return nil, true, fmt.Errorf("remote server responded with %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("remote server responded with %s", resp.Status)
+	}
+
+	if resp.ContentLength > f.MaxBodySize {
+		return nil, false, ErrBodyTooLarge
+	}
+
+	// Read one byte more than the limit to know if the body was cut off
+	content, err := io.ReadAll(io.LimitReader(resp.Body, f.MaxBodySize+1))
+	if err != nil {
+		return nil, true, err
+	}
+	if int64(len(content)) > f.MaxBodySize {
+		return nil, false, ErrBodyTooLarge
+	}
+
+	if !LooksLikeIGC(content) {
+		return nil, false, ErrNotIGC
+	}
+
+	job.ETag = resp.Header.Get("ETag")
+	job.LastModified = resp.Header.Get("Last-Modified")
+
+	return content, false, nil
+}
+
+// checkURL checks the scheme and the host of a URL before anything is requested
+func (f *Fetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrInvalidScheme
+	}
+
+	if !f.hostAllowed(u.Hostname()) {
+		return ErrHostNotAllowed
+	}
+
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !f.allowPrivate && !IsPublicIP(ip) {
+		return ErrPrivateAddress
+	}
+
+	return nil
+}
+
+// checkAddress is used as the dialer control function, and refuses to connect to non-public IPs
+func (f *Fetcher) checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ErrPrivateAddress
+	}
+	if !f.allowPrivate && !IsPublicIP(ip) {
+		return ErrPrivateAddress
+	}
+
+	return nil
+}
+
+// hostAllowed checks the host against the allowlist, subdomains of an allowed host are allowed as well
+func (f *Fetcher) hostAllowed(host string) bool {
+	if len(f.AllowedHosts) == 0 {
+		return true
+	}
+
+	host = strings.ToLower(host)
+	for _, allowed := range f.AllowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+IsPublicIP returns false for private, loopback, link-local, multicast and unspecified addresses
+*/
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+
+	// 100.64.0.0/10 (carrier-grade NAT) isn't covered by IsPrivate
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 100 && ip4[1]&0xC0 == 64 {
+		return false
+	}
+
+	return true
+}
+
+/*
+LooksLikeIGC sniffs the content of a file to check if it could be an IGC file.
+The content has to be text, and the first record has to be an A or H record
+*/
+func LooksLikeIGC(content []byte) bool {
+	contentType := http.DetectContentType(content)
+	if !strings.HasPrefix(contentType, "text/plain") {
+		return false
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		return line[0] == 'A' || line[0] == 'H'
+	}
+
+	return false
+}
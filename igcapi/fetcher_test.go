@@ -0,0 +1,180 @@
+package igcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIGC = "AXXXABCFLIGHT:1\nHFDTE190216\nHFPLTPILOT:Test Pilot\nB1101355206343N00006198WA0058700558\n"
+
+// newTestFetcher returns a fetcher that is allowed to connect to the loopback httptest servers
+func newTestFetcher() *Fetcher {
+	f := &Fetcher{
+		ConnectTimeout: time.Second,
+		ReadTimeout:    time.Second,
+		MaxBodySize:    1024,
+		MaxRetries:     2,
+		allowPrivate:   true,
+	}
+	f.Init()
+
+	return f
+}
+
+// Tests that private, loopback and link-local addresses are not considered public
+func Test_isPublicIP(t *testing.T) {
+	notPublic := []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fc00::1"}
+	for _, addr := range notPublic {
+		if IsPublicIP(net.ParseIP(addr)) {
+			t.Errorf("%s should not be a public IP", addr)
+		}
+	}
+
+	public := []string{"8.8.8.8", "151.101.1.69", "2001:4860:4860::8888"}
+	for _, addr := range public {
+		if !IsPublicIP(net.ParseIP(addr)) {
+			t.Errorf("%s should be a public IP", addr)
+		}
+	}
+}
+
+// Tests that the fetcher refuses to connect to the loopback interface
+func Test_fetcherBlocksLoopback(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testIGC)
+	}))
+	defer testServer.Close()
+
+	f := &Fetcher{ConnectTimeout: time.Second, ReadTimeout: time.Second, MaxBodySize: 1024, MaxRetries: 2}
+	job := FetchJob{URL: testServer.URL}
+	_, err := f.Fetch(&job)
+
+	if err != ErrPrivateAddress {
+		t.Errorf("Expected '%v', got '%v'", ErrPrivateAddress, err)
+	}
+	if job.Attempts != 1 { // A blocked address should not be retried
+		t.Errorf("Expected 1 attempt, got %d", job.Attempts)
+	}
+	if job.Status != JobFailed || len(job.Failures) != 1 {
+		t.Errorf("Failure not recorded on the job: %+v", job)
+	}
+}
+
+// Tests that only hosts in the allowlist can be fetched
+func Test_fetcherAllowlist(t *testing.T) {
+	f := newTestFetcher()
+	f.AllowedHosts = []string{"skypolaris.org"}
+
+	if !f.hostAllowed("skypolaris.org") || !f.hostAllowed("www.skypolaris.org") {
+		t.Error("Allowed host was refused")
+	}
+
+	job := FetchJob{URL: "http://evilskypolaris.org/track.igc"}
+	if _, err := f.Fetch(&job); err != ErrHostNotAllowed {
+		t.Errorf("Expected '%v', got '%v'", ErrHostNotAllowed, err)
+	}
+}
+
+// Tests that files larger than the maximum size are refused
+func Test_fetcherMaxBodySize(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testIGC+strings.Repeat("B1101355206343N00006198WA0058700558\n", 100))
+	}))
+	defer testServer.Close()
+
+	job := FetchJob{URL: testServer.URL}
+	if _, err := newTestFetcher().Fetch(&job); err != ErrBodyTooLarge {
+		t.Errorf("Expected '%v', got '%v'", ErrBodyTooLarge, err)
+	}
+}
+
+// Tests that server errors are retried, and that every failure is recorded
+func Test_fetcherRetries(t *testing.T) {
+	requests := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, testIGC)
+	}))
+	defer testServer.Close()
+
+	job := FetchJob{URL: testServer.URL}
+	track, _, err := newTestFetcher().FetchTrack(&job)
+	if err != nil {
+		t.Errorf("Fetching failed: %s", err)
+		return
+	}
+
+	if job.Attempts != 3 || len(job.Failures) != 2 || job.Status != JobFetched {
+		t.Errorf("Unexpected job state: %+v", job)
+	}
+	if track.Pilot != "Test Pilot" {
+		t.Errorf("Expected pilot 'Test Pilot', got '%s'", track.Pilot)
+	}
+}
+
+// Tests that files which are not IGC files are refused
+func Test_looksLikeIGC(t *testing.T) {
+	if !LooksLikeIGC([]byte(testIGC)) {
+		t.Error("IGC file was not recognised")
+	}
+	if LooksLikeIGC([]byte("<html><body>Not found</body></html>")) {
+		t.Error("HTML was recognised as an IGC file")
+	}
+	if LooksLikeIGC([]byte{0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A}) {
+		t.Error("PNG was recognised as an IGC file")
+	}
+}
+
+// Tests that the job of an added track is stored, and linked to from the response
+func Test_handlerTrackJob(t *testing.T) {
+	defer func(storage APIKeyStorage) { keyDB = storage }(keyDB)
+	defer func(tracks TrackStorage, jobs JobStorage, f Fetcher) { db, jobDB, fetcher = tracks, jobs, f }(db, jobDB, fetcher)
+	memoryDB, keys := authTestKeys(t)
+	keyDB = memoryDB
+	db = &TrackMemoryDB{}
+	jobDB = &JobMemoryDB{}
+	fetcher = *newTestFetcher()
+	defer func(id int) { nextID = id }(nextID)
+	nextID = 1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testIGC)
+	}))
+	defer server.Close()
+
+	router := NewRouter()
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+keys[RoleUploader])
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request(http.MethodPost, "/paragliding/api/track", `{"url": "`+server.URL+`"}`)
+	link := w.Header().Get("Link")
+	if w.Code != http.StatusOK || !strings.HasPrefix(link, "</paragliding/api/track/jobs/") || !strings.HasSuffix(link, `>; rel="job"`) {
+		t.Fatalf("Expected 200 with a link to the job, got %d with '%s'", w.Code, link)
+	}
+
+	w = request(http.MethodGet, link[1:strings.Index(link, ">")], "")
+	var job FetchJob
+	json.NewDecoder(w.Body).Decode(&job)
+	if w.Code != http.StatusOK || job.Status != JobFetched || job.TrackID == 0 || job.Attempts != 1 || job.URL != server.URL {
+		t.Errorf("Expected the fetched job of the track, got %d with %+v", w.Code, job)
+	}
+
+	if w = request(http.MethodGet, "/paragliding/api/track/jobs/unknown", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown job, got %d", w.Code)
+	}
+}
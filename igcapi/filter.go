@@ -0,0 +1,254 @@
+package igcapi
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+/*
+TrackFilter holds the search criteria for tracks. Empty strings, zero times and zero lengths are not used
+*/
+type TrackFilter struct {
+	Pilot           string
+	Glider          string
+	GliderID        string
+	From            time.Time // Inclusive, compared to HDate
+	To              time.Time // Inclusive, compared to HDate
+	MinLength       float64
+	MaxLength       float64
+	SignatureStatus string
+	AddedAfter      int64      // Only tracks with a larger timestamp, used by the ticker
+	AddedSince      int64      // Inclusive, compared to the timestamp
+	AddedBefore     int64      // Exclusive, compared to the timestamp
+	Near            *GeoCircle // Tracks starting within the circle
+	BBox            *GeoBox    // Tracks with a path going through the box
+	SiteID          int        // Tracks from the site, sites are numbered from 1
+	PilotID         string
+	GliderKey       string // Tracks of the glider in the registry, see NormalizeGliderID
+	SourceURL       string // The track added from the URL
+	ID              *int   // Only the track with the ID, used to look up single tracks. A pointer, as 0 is an ID
+	Deleted         bool   // Only deleted tracks, deleted tracks are left out otherwise
+}
+
+/*
+ParseTrackFilter creates a filter from the query parameters pilot, glider, glider_id, from, to,
+min_length, max_length, signature_status, near, radius, bbox and site. Dates are given as YYYY-MM-DD or RFC 3339
+*/
+func ParseTrackFilter(query url.Values) (TrackFilter, error) {
+	filter := TrackFilter{
+		Pilot:           query.Get("pilot"),
+		Glider:          query.Get("glider"),
+		GliderID:        query.Get("glider_id"),
+		SignatureStatus: query.Get("signature_status"),
+	}
+
+	var err error
+	if filter.From, err = parseDateParam(query.Get("from")); err != nil {
+		return filter, fmt.Errorf("invalid 'from' given")
+	}
+	if filter.To, err = parseDateParam(query.Get("to")); err != nil {
+		return filter, fmt.Errorf("invalid 'to' given")
+	}
+
+	if param := query.Get("min_length"); param != "" {
+		if filter.MinLength, err = strconv.ParseFloat(param, 64); err != nil || filter.MinLength < 0 {
+			return filter, fmt.Errorf("invalid 'min_length' given")
+		}
+	}
+	if param := query.Get("max_length"); param != "" {
+		if filter.MaxLength, err = strconv.ParseFloat(param, 64); err != nil || filter.MaxLength < 0 {
+			return filter, fmt.Errorf("invalid 'max_length' given")
+		}
+	}
+
+	if param := query.Get("site"); param != "" {
+		if filter.SiteID, err = strconv.Atoi(param); err != nil || filter.SiteID < 1 {
+			return filter, fmt.Errorf("invalid 'site' given")
+		}
+	}
+
+	if param := query.Get("near"); param != "" {
+		if filter.Near, err = ParseNear(param, query.Get("radius")); err != nil {
+			return filter, err
+		}
+	}
+	if param := query.Get("bbox"); param != "" {
+		if filter.BBox, err = ParseBBox(param); err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+/*
+Query returns the filter as a mongo query
+*/
+func (f TrackFilter) Query() bson.M {
+	query := bson.M{"deletedat": bson.M{"$not": bson.M{"$gt": 0}}} // Tracks from before soft deletion have no deletedat
+	if f.Deleted {
+		query["deletedat"] = bson.M{"$gt": 0}
+	}
+	if f.ID != nil {
+		query["id"] = *f.ID
+	}
+
+	if f.SourceURL != "" {
+		query["tracksourceurl"] = f.SourceURL
+	}
+
+	if f.Pilot != "" {
+		query["pilot"] = f.Pilot
+	}
+	if f.Glider != "" {
+		query["glider"] = f.Glider
+	}
+	if f.GliderID != "" {
+		query["gliderid"] = f.GliderID
+	}
+	if f.SignatureStatus != "" {
+		query["signaturestatus"] = f.SignatureStatus
+	}
+	if f.AddedAfter != 0 || f.AddedSince != 0 || f.AddedBefore != 0 {
+		timestamp := bson.M{}
+		if f.AddedAfter != 0 {
+			timestamp["$gt"] = f.AddedAfter
+		}
+		if f.AddedSince != 0 {
+			timestamp["$gte"] = f.AddedSince
+		}
+		if f.AddedBefore != 0 {
+			timestamp["$lt"] = f.AddedBefore
+		}
+		query["timestamp"] = timestamp
+	}
+	if f.SiteID != 0 {
+		query["siteid"] = f.SiteID
+	}
+	if f.PilotID != "" {
+		query["pilotid"] = f.PilotID
+	}
+	if f.GliderKey != "" {
+		query["gliderkey"] = f.GliderKey
+	}
+
+	if !f.From.IsZero() || !f.To.IsZero() {
+		date := bson.M{}
+		if !f.From.IsZero() {
+			date["$gte"] = f.From
+		}
+		if !f.To.IsZero() {
+			date["$lte"] = f.To
+		}
+		query["hdate"] = date
+	}
+
+	if f.MinLength > 0 || f.MaxLength > 0 {
+		length := bson.M{}
+		if f.MinLength > 0 {
+			length["$gte"] = f.MinLength
+		}
+		if f.MaxLength > 0 {
+			length["$lte"] = f.MaxLength
+		}
+		query["tracklength"] = length
+	}
+
+	if f.Near != nil {
+		query["start"] = bson.M{"$geoWithin": bson.M{
+			"$centerSphere": []interface{}{[]float64{f.Near.Lng, f.Near.Lat}, f.Near.RadiusKm * 1000 / earthRadiusMeters},
+		}}
+	}
+	if f.BBox != nil {
+		query["path"] = bson.M{"$geoIntersects": bson.M{"$geometry": f.BBox.Polygon()}}
+	}
+
+	return query
+}
+
+/*
+Matches returns if the track matches the filter, used by storage backends without a query language.
+It has to give the same result as Query
+*/
+func (f TrackFilter) Matches(t TrackInfo) bool {
+	switch {
+	case f.Deleted != (t.DeletedAt > 0),
+		f.ID != nil && t.ID != *f.ID,
+		f.SourceURL != "" && t.TrackSourceURL != f.SourceURL,
+		f.Pilot != "" && t.Pilot != f.Pilot,
+		f.Glider != "" && t.Glider != f.Glider,
+		f.GliderID != "" && t.GliderID != f.GliderID,
+		f.SignatureStatus != "" && t.SignatureStatus != f.SignatureStatus,
+		!f.From.IsZero() && t.HDate.Before(f.From),
+		!f.To.IsZero() && t.HDate.After(f.To),
+		f.MinLength > 0 && t.TrackLength < f.MinLength,
+		f.MaxLength > 0 && t.TrackLength > f.MaxLength,
+		f.AddedAfter != 0 && t.Timestamp <= f.AddedAfter,
+		f.AddedSince != 0 && t.Timestamp < f.AddedSince,
+		f.AddedBefore != 0 && t.Timestamp >= f.AddedBefore,
+		f.SiteID != 0 && t.SiteID != f.SiteID,
+		f.PilotID != "" && t.PilotID != f.PilotID,
+		f.GliderKey != "" && t.GliderKey != f.GliderKey,
+		f.Near != nil && !f.Near.Contains(t.Start),
+		f.BBox != nil && !f.BBox.Intersects(t.Path):
+		return false
+	}
+
+	return true
+}
+
+/*
+ParseTickerFilter creates a filter from the query parameters of the ticker: since and until (RFC 3339 or unix timestamps)
+limit the time the tracks were added to [since, until), pilot is the name or ID of a pilot and site the ID of a site
+*/
+func ParseTickerFilter(query url.Values) (TrackFilter, error) {
+	filter := TrackFilter{}
+
+	since, err := parseTimeParam(query.Get("since"))
+	if err != nil {
+		return filter, fmt.Errorf("invalid 'since' given")
+	}
+	until, err := parseTimeParam(query.Get("until"))
+	if err != nil {
+		return filter, fmt.Errorf("invalid 'until' given")
+	}
+	if !since.IsZero() {
+		filter.AddedSince = since.Unix()
+	}
+	if !until.IsZero() {
+		filter.AddedBefore = until.Unix()
+	}
+	if filter.AddedSince != 0 && filter.AddedBefore != 0 && filter.AddedSince >= filter.AddedBefore {
+		return filter, fmt.Errorf("'since' has to be before 'until'")
+	}
+
+	if param := query.Get("pilot"); param != "" {
+		if filter.PilotID = PilotID(param); filter.PilotID == "" {
+			return filter, fmt.Errorf("invalid 'pilot' given")
+		}
+	}
+	if param := query.Get("site"); param != "" {
+		if filter.SiteID, err = strconv.Atoi(param); err != nil || filter.SiteID < 1 {
+			return filter, fmt.Errorf("invalid 'site' given")
+		}
+	}
+
+	return filter, nil
+}
+
+// parseDateParam parses a date given as YYYY-MM-DD or RFC 3339, an empty parameter gives the zero time
+func parseDateParam(param string) (time.Time, error) {
+	if param == "" {
+		return time.Time{}, nil
+	}
+
+	if date, err := time.Parse("2006-01-02", param); err == nil {
+		return date, nil
+	}
+
+	return time.Parse(time.RFC3339, param)
+}
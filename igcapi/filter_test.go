@@ -0,0 +1,135 @@
+package igcapi
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// filterTestTracks are three tracks with different pilots, dates and lengths
+var filterTestTracks = []TrackInfo{
+	{ID: 1, Pilot: "Anna", Glider: "Ozone", GliderID: "A1", HDate: time.Date(2016, 2, 19, 0, 0, 0, 0, time.UTC), TrackLength: 40},
+	{ID: 2, Pilot: "Bob", Glider: "Ozone", GliderID: "B1", HDate: time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC), TrackLength: 120},
+	{ID: 3, Pilot: "Anna", Glider: "Gin", GliderID: "A2", HDate: time.Date(2018, 8, 3, 0, 0, 0, 0, time.UTC), TrackLength: 80},
+}
+
+// Tests that the query parameters are used to search for tracks
+func Test_findIDs(t *testing.T) {
+	memoryDB := testTrackDB(filterTestTracks...)
+
+	tests := map[string][]int{
+		"":                              {1, 2, 3},
+		"pilot=Anna":                    {1, 3},
+		"glider=Ozone":                  {1, 2},
+		"glider_id=A2":                  {3},
+		"from=2017-01-01":               {2, 3},
+		"to=2017-06-01":                 {1, 2},
+		"from=2017-01-01&to=2017-12-31": {2},
+		"min_length=50":                 {2, 3},
+		"max_length=100":                {1, 3},
+		"pilot=Anna&min_length=50":      {3},
+		"pilot=Nobody":                  {},
+		"from=2016-02-19T00:00:00Z&to=2016-02-19T00:00:00Z": {1},
+	}
+
+	for rawQuery, expected := range tests {
+		query, _ := url.ParseQuery(rawQuery)
+		filter, err := ParseTrackFilter(query)
+		if err != nil {
+			t.Errorf("Couldn't parse '%s': %s", rawQuery, err)
+			continue
+		}
+
+		IDs, _ := memoryDB.FindIDs(filter)
+		if !reflect.DeepEqual(IDs, expected) {
+			t.Errorf("'%s': expected %v, got %v", rawQuery, expected, IDs)
+		}
+	}
+}
+
+// Tests that invalid query parameters are refused
+func Test_parseTrackFilter_invalid(t *testing.T) {
+	for _, rawQuery := range []string{"from=yesterday", "to=2018-13-01", "min_length=long", "max_length=-1"} {
+		query, _ := url.ParseQuery(rawQuery)
+		if _, err := ParseTrackFilter(query); err == nil {
+			t.Errorf("'%s' was accepted", rawQuery)
+		}
+	}
+}
+
+// Tests that the mongo query uses the same fields as the stored tracks
+func Test_trackFilterQuery(t *testing.T) {
+	from := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	filter := TrackFilter{Pilot: "Anna", From: from, MinLength: 50}
+
+	expected := bson.M{
+		"deletedat":   bson.M{"$not": bson.M{"$gt": 0}},
+		"pilot":       "Anna",
+		"hdate":       bson.M{"$gte": from},
+		"tracklength": bson.M{"$gte": 50.0},
+	}
+
+	if query := filter.Query(); !reflect.DeepEqual(query, expected) {
+		t.Errorf("Expected %v, got %v", expected, query)
+	}
+
+	if query := (TrackFilter{Deleted: true}).Query(); !reflect.DeepEqual(query, bson.M{"deletedat": bson.M{"$gt": 0}}) {
+		t.Errorf("Expected only deleted tracks, got %v", query)
+	}
+
+	first := 0 // The ID of the first track added
+	if query := (TrackFilter{ID: &first}).Query(); query["id"] != 0 {
+		t.Errorf("Expected only track 0, got %v", query)
+	}
+}
+
+// Tests that the ticker parameters limit the tracks to a time window, a pilot and a site
+func Test_tickerFilter(t *testing.T) {
+	memoryDB := &TrackMemoryDB{}
+	memoryDB.Add(TrackInfo{ID: 1, PilotID: "anna", SiteID: 1, Timestamp: 1000, TrackSourceURL: "a"})
+	memoryDB.Add(TrackInfo{ID: 2, PilotID: "bob", SiteID: 1, Timestamp: 2000, TrackSourceURL: "b"})
+	memoryDB.Add(TrackInfo{ID: 3, PilotID: "anna", SiteID: 2, Timestamp: 3000, TrackSourceURL: "c"})
+
+	tests := map[string][]int{
+		"":                                   {1, 2, 3},
+		"since=2000":                         {2, 3},
+		"until=2000":                         {1},
+		"since=1000&until=3000":              {1, 2},
+		"since=1970-01-01T00:33:20Z":         {2, 3},
+		"pilot=Anna":                         {1, 3},
+		"pilot=anna&site=1":                  {1},
+		"site=2&since=1":                     {3},
+		"since=3001":                         {},
+		"pilot=Nobody&since=1000&until=4000": {},
+	}
+
+	for rawQuery, expected := range tests {
+		query, _ := url.ParseQuery(rawQuery)
+		filter, err := ParseTickerFilter(query)
+		if err != nil {
+			t.Errorf("Couldn't parse '%s': %s", rawQuery, err)
+			continue
+		}
+
+		IDs, _ := memoryDB.FindIDs(filter)
+		if !reflect.DeepEqual(IDs, expected) {
+			t.Errorf("'%s': expected %v, got %v", rawQuery, expected, IDs)
+		}
+	}
+
+	for _, rawQuery := range []string{"since=yesterday", "until=2018-13-01T00:00:00Z", "since=2000&until=1000", "since=1000&until=1000", "site=0", "pilot=%20"} {
+		query, _ := url.ParseQuery(rawQuery)
+		if _, err := ParseTickerFilter(query); err == nil {
+			t.Errorf("'%s' was accepted", rawQuery)
+		}
+	}
+
+	filter := TrackFilter{AddedAfter: 10, AddedSince: 20, AddedBefore: 30}
+	expected := bson.M{"$gt": int64(10), "$gte": int64(20), "$lt": int64(30)}
+	if query := filter.Query(); !reflect.DeepEqual(query["timestamp"], expected) {
+		t.Errorf("Expected the timestamp query %v, got %v", expected, query["timestamp"])
+	}
+}
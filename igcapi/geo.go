@@ -0,0 +1,352 @@
+package igcapi
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	pathTolerance = 100.0 // Meters, the stored path is simplified with this tolerance
+	gridCellSize  = 1.0   // Degrees, the size of the cells in the in-memory spatial index
+)
+
+/*
+GeoJSONPoint is a GeoJSON point, the coordinates are [longitude, latitude]
+*/
+type GeoJSONPoint struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+/*
+GeoJSONLineString is a GeoJSON line string, each coordinate is [longitude, latitude]
+*/
+type GeoJSONLineString struct {
+	Type        string      `json:"type"`
+	Coordinates [][]float64 `json:"coordinates"`
+}
+
+/*
+GeoCircle is a search area given by a center and a radius
+*/
+type GeoCircle struct {
+	Lat      float64
+	Lng      float64
+	RadiusKm float64
+}
+
+/*
+GeoBox is a search area given by its south-west and north-east corners. Boxes crossing the antimeridian
+have a larger MinLng than MaxLng, like GeoJSON bounding boxes
+*/
+type GeoBox struct {
+	MinLng float64
+	MinLat float64
+	MaxLng float64
+	MaxLat float64
+}
+
+/*
+SetGeometry sets the start, end and simplified path of a track from its points
+*/
+func SetGeometry(track *TrackInfo, points []TrackPoint) {
+	track.Start, track.End, track.Path = nil, nil, nil
+	if len(points) == 0 {
+		return
+	}
+
+	first, last := points[0], points[len(points)-1]
+	track.Start = &GeoJSONPoint{Type: "Point", Coordinates: []float64{first.Lng, first.Lat}}
+	track.End = &GeoJSONPoint{Type: "Point", Coordinates: []float64{last.Lng, last.Lat}}
+
+	path := &GeoJSONLineString{Type: "LineString"}
+	for _, p := range SimplifyPoints(points, pathTolerance) {
+		coordinate := []float64{p.Lng, p.Lat}
+		if n := len(path.Coordinates); n > 0 && path.Coordinates[n-1][0] == p.Lng && path.Coordinates[n-1][1] == p.Lat {
+			continue // A line string can't have the same coordinate twice in a row
+		}
+		path.Coordinates = append(path.Coordinates, coordinate)
+	}
+
+	if len(path.Coordinates) >= 2 { // A line string needs at least two coordinates
+		track.Path = path
+	}
+}
+
+/*
+ParseNear parses "lat,lng" and a radius in km into a search circle
+*/
+func ParseNear(near, radius string) (*GeoCircle, error) {
+	coordinates, err := parseFloats(near, 2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'near' given, has to be lat,lng")
+	}
+
+	circle := &GeoCircle{Lat: coordinates[0], Lng: coordinates[1], RadiusKm: 5}
+	if radius != "" {
+		if circle.RadiusKm, err = strconv.ParseFloat(radius, 64); err != nil || circle.RadiusKm <= 0 {
+			return nil, fmt.Errorf("invalid 'radius' given")
+		}
+	}
+
+	if !validLatLng(circle.Lat, circle.Lng) {
+		return nil, fmt.Errorf("invalid 'near' given, the coordinates are out of range")
+	}
+
+	return circle, nil
+}
+
+/*
+ParseBBox parses "minLng,minLat,maxLng,maxLat" (the GeoJSON bbox order) into a search box.
+A larger minLng than maxLng is a box crossing the antimeridian
+*/
+func ParseBBox(bbox string) (*GeoBox, error) {
+	coordinates, err := parseFloats(bbox, 4)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'bbox' given, has to be minLng,minLat,maxLng,maxLat")
+	}
+
+	box := &GeoBox{MinLng: coordinates[0], MinLat: coordinates[1], MaxLng: coordinates[2], MaxLat: coordinates[3]}
+	if !validLatLng(box.MinLat, box.MinLng) || !validLatLng(box.MaxLat, box.MaxLng) || box.MinLat > box.MaxLat {
+		return nil, fmt.Errorf("invalid 'bbox' given, the coordinates are out of range")
+	}
+
+	return box, nil
+}
+
+/*
+Contains returns if the point is within the circle
+*/
+func (c GeoCircle) Contains(p *GeoJSONPoint) bool {
+	if p == nil {
+		return false
+	}
+
+	return HaversineDistance(c.Lat, c.Lng, p.Coordinates[1], p.Coordinates[0]) <= c.RadiusKm*1000
+}
+
+/*
+Polygon returns the box as a GeoJSON polygon, used in mongo queries
+*/
+func (b GeoBox) Polygon() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "Polygon",
+		"coordinates": [][][]float64{{
+			{b.MinLng, b.MinLat}, {b.MaxLng, b.MinLat}, {b.MaxLng, b.MaxLat}, {b.MinLng, b.MaxLat}, {b.MinLng, b.MinLat},
+		}},
+	}
+}
+
+/*
+Split returns the box as boxes that don't cross the antimeridian, two if the box crosses it
+*/
+func (b GeoBox) Split() []GeoBox {
+	if b.MinLng <= b.MaxLng {
+		return []GeoBox{b}
+	}
+
+	east, west := b, b
+	east.MaxLng = 180
+	west.MinLng = -180
+	return []GeoBox{east, west}
+}
+
+/*
+Intersects returns if any part of the path is within the box
+*/
+func (b GeoBox) Intersects(path *GeoJSONLineString) bool {
+	if path == nil {
+		return false
+	}
+	if boxes := b.Split(); len(boxes) > 1 {
+		return boxes[0].Intersects(path) || boxes[1].Intersects(path)
+	}
+
+	for i, c := range path.Coordinates {
+		if b.containsCoordinate(c) {
+			return true
+		}
+		if i > 0 && b.crossedBy(path.Coordinates[i-1], c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b GeoBox) containsCoordinate(c []float64) bool {
+	return c[0] >= b.MinLng && c[0] <= b.MaxLng && c[1] >= b.MinLat && c[1] <= b.MaxLat
+}
+
+// crossedBy returns if the segment from a to b crosses one of the edges of the box
+func (b GeoBox) crossedBy(from, to []float64) bool {
+	corners := [][]float64{{b.MinLng, b.MinLat}, {b.MaxLng, b.MinLat}, {b.MaxLng, b.MaxLat}, {b.MinLng, b.MaxLat}}
+	for i := range corners {
+		if segmentsIntersect(from, to, corners[i], corners[(i+1)%len(corners)]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// segmentsIntersect returns if the segments p1-p2 and p3-p4 intersect
+func segmentsIntersect(p1, p2, p3, p4 []float64) bool {
+	cross := func(a, b, c []float64) float64 {
+		return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+	}
+
+	d1, d2 := cross(p3, p4, p1), cross(p3, p4, p2)
+	d3, d4 := cross(p1, p2, p3), cross(p1, p2, p4)
+
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+/*
+HaversineDistance returns the great circle distance in meters between two coordinates
+*/
+func HaversineDistance(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLng := (lng2 - lng1) * toRad
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func validLatLng(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// parseFloats parses a comma separated list of exactly n numbers
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d numbers", n)
+	}
+
+	numbers := make([]float64, n)
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		numbers[i] = number
+	}
+
+	return numbers, nil
+}
+
+/*
+spatialIndex is a grid index of the start points and paths of tracks, used by the in-memory storage
+*/
+type spatialIndex struct {
+	starts map[gridCell][]int // Track IDs by the cell of their start point
+	paths  map[gridCell][]int // Track IDs by every cell their path's bounding box covers
+}
+
+type gridCell struct {
+	lat, lng int
+}
+
+func cellOf(lat, lng float64) gridCell {
+	return gridCell{int(math.Floor(lat / gridCellSize)), int(math.Floor(lng / gridCellSize))}
+}
+
+// cellsIn returns every cell covering the area between the coordinates. Longitudes past ±180 wrap around,
+// and a larger minLng than maxLng is an area crossing the antimeridian
+func cellsIn(minLat, minLng, maxLat, maxLng float64) []gridCell {
+	cells := []gridCell{}
+	for _, lngs := range lngRanges(minLng, maxLng) {
+		low, high := cellOf(minLat, lngs[0]), cellOf(maxLat, lngs[1])
+		for lat := low.lat; lat <= high.lat; lat++ {
+			for lng := low.lng; lng <= high.lng; lng++ {
+				cells = append(cells, gridCell{lat, lng})
+			}
+		}
+	}
+
+	return cells
+}
+
+// lngRanges returns the longitudes between minLng and maxLng as ranges within -180 to 180,
+// two ranges when the longitudes cross the antimeridian
+func lngRanges(minLng, maxLng float64) [][2]float64 {
+	switch {
+	case minLng <= maxLng && maxLng-minLng >= 360:
+		return [][2]float64{{-180, 180}}
+	case minLng < -180:
+		return lngRanges(minLng+360, maxLng)
+	case maxLng > 180:
+		return lngRanges(minLng, maxLng-360)
+	case minLng > maxLng:
+		return [][2]float64{{minLng, 180}, {-180, maxLng}}
+	}
+
+	return [][2]float64{{minLng, maxLng}}
+}
+
+func (idx *spatialIndex) add(t TrackInfo) {
+	if idx.starts == nil {
+		idx.starts = make(map[gridCell][]int)
+		idx.paths = make(map[gridCell][]int)
+	}
+
+	if t.Start != nil {
+		cell := cellOf(t.Start.Coordinates[1], t.Start.Coordinates[0])
+		idx.starts[cell] = append(idx.starts[cell], t.ID)
+	}
+
+	if t.Path != nil {
+		box := GeoBox{MinLng: 180, MinLat: 90, MaxLng: -180, MaxLat: -90}
+		for _, c := range t.Path.Coordinates {
+			box.MinLng, box.MaxLng = math.Min(box.MinLng, c[0]), math.Max(box.MaxLng, c[0])
+			box.MinLat, box.MaxLat = math.Min(box.MinLat, c[1]), math.Max(box.MaxLat, c[1])
+		}
+		for _, cell := range cellsIn(box.MinLat, box.MinLng, box.MaxLat, box.MaxLng) {
+			idx.paths[cell] = append(idx.paths[cell], t.ID)
+		}
+	}
+}
+
+// candidates returns the IDs of the tracks that could match the geographic part of the filter,
+// and false if the filter has no geographic part
+func (idx *spatialIndex) candidates(filter TrackFilter) (map[int]bool, bool) {
+	if filter.Near == nil && filter.BBox == nil {
+		return nil, false
+	}
+
+	var result map[int]bool
+
+	if c := filter.Near; c != nil {
+		// The bounding box of the circle, longitude degrees get shorter towards the poles
+		dLat := c.RadiusKm * 1000 / earthRadiusMeters * 180 / math.Pi
+		dLng := 360.0
+		if cos := math.Cos(c.Lat * math.Pi / 180); cos > 0.01 {
+			dLng = math.Min(360, dLat/cos)
+		}
+
+		result = make(map[int]bool)
+		for _, cell := range cellsIn(c.Lat-dLat, c.Lng-dLng, c.Lat+dLat, c.Lng+dLng) {
+			for _, id := range idx.starts[cell] {
+				result[id] = true
+			}
+		}
+	}
+
+	if b := filter.BBox; b != nil {
+		inBox := make(map[int]bool)
+		for _, cell := range cellsIn(b.MinLat, b.MinLng, b.MaxLat, b.MaxLng) {
+			for _, id := range idx.paths[cell] {
+				if result == nil || result[id] {
+					inBox[id] = true
+				}
+			}
+		}
+		result = inBox
+	}
+
+	return result, true
+}
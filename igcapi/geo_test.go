@@ -0,0 +1,111 @@
+package igcapi
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// line returns points at the latitude and longitude pairs
+func line(coordinates ...float64) []TrackPoint {
+	points := []TrackPoint{}
+	for i := 0; i < len(coordinates); i += 2 {
+		points = append(points, TrackPoint{Time: time.Unix(int64(i), 0), Lat: coordinates[i], Lng: coordinates[i+1]})
+	}
+	return points
+}
+
+// geoTestTracks are a track from Voss, one from Hemsedal and one crossing the
+// Hemsedal area without starting there
+var geoTestTracks = func() []TrackInfo {
+	tracks := []TrackInfo{{ID: 1}, {ID: 2}, {ID: 3}}
+	SetGeometry(&tracks[0], line(60.63, 6.42, 60.70, 6.60))
+	SetGeometry(&tracks[1], line(60.86, 8.55, 60.90, 8.70))
+	SetGeometry(&tracks[2], line(60.50, 8.00, 61.20, 9.20))
+
+	return tracks
+}()
+
+// Tests searching for tracks starting near a point, or going through a box
+func Test_findIDs_geo(t *testing.T) {
+	memoryDB := testTrackDB(geoTestTracks...)
+
+	tests := map[string][]int{
+		"near=60.63,6.42":                        {1},
+		"near=60.86,8.56&radius=2":               {2},
+		"near=60.0,5.0&radius=1":                 {},
+		"near=60.7,7.5&radius=100":               {1, 2, 3},
+		"bbox=8.5,60.8,8.8,61.0":                 {2, 3},
+		"bbox=6.0,60.0,7.0,61.0":                 {1},
+		"bbox=8.59,60.84,8.61,60.86":             {3}, // Only the line of track 3 crosses this small box
+		"bbox=8.5,60.8,8.8,61.0&near=60.86,8.55": {2},
+	}
+	checkGeoQueries(t, memoryDB, tests)
+}
+
+// Tests that circles and boxes crossing the antimeridian find the tracks on both sides of it
+func Test_findIDs_antimeridian(t *testing.T) {
+	tracks := []TrackInfo{{ID: 1}, {ID: 2}}
+	SetGeometry(&tracks[0], line(-17.00, 179.90, -17.10, 179.95)) // Fiji, east of the antimeridian
+	SetGeometry(&tracks[1], line(-17.00, -179.90, -17.10, -179.95))
+	memoryDB := testTrackDB(tracks...)
+
+	tests := map[string][]int{
+		"near=-17.0,179.99&radius=50":                         {1, 2},
+		"near=-17.0,-179.99&radius=50":                        {1, 2},
+		"near=-17.0,179.0&radius=50":                          {},
+		"bbox=179.5,-18,-179.5,-16":                           {1, 2},
+		"bbox=179.5,-18,179.99,-16":                           {1},
+		"bbox=179.99,-18,-179.92,-16":                         {2},
+		"bbox=-179.5,-18,179.5,-16":                           {},
+		"bbox=179.5,-18,-179.5,-16&near=-17.0,179.9&radius=1": {1},
+	}
+	checkGeoQueries(t, memoryDB, tests)
+}
+
+// checkGeoQueries checks the IDs found by the queries, with and without the spatial index
+func checkGeoQueries(t *testing.T, memoryDB *TrackMemoryDB, tests map[string][]int) {
+	for rawQuery, expected := range tests {
+		query, _ := url.ParseQuery(rawQuery)
+		filter, err := ParseTrackFilter(query)
+		if err != nil {
+			t.Errorf("Couldn't parse '%s': %s", rawQuery, err)
+			continue
+		}
+
+		IDs, _ := memoryDB.FindIDs(filter)
+		if !reflect.DeepEqual(IDs, expected) {
+			t.Errorf("'%s': expected %v, got %v", rawQuery, expected, IDs)
+		}
+
+		// The spatial index must not change the result
+		matching := []int{}
+		for _, track := range memoryDB.tracks {
+			if filter.Matches(track) {
+				matching = append(matching, track.ID)
+			}
+		}
+		if !reflect.DeepEqual(matching, expected) {
+			t.Errorf("'%s': without the index expected %v, got %v", rawQuery, expected, matching)
+		}
+	}
+}
+
+// Tests that invalid geographic parameters are refused
+func Test_parseTrackFilter_invalidGeo(t *testing.T) {
+	for _, rawQuery := range []string{"near=60", "near=91,0", "near=60,8&radius=-1", "bbox=1,2,3", "bbox=8,61,9,60", "bbox=181,60,8,61"} {
+		query, _ := url.ParseQuery(rawQuery)
+		if _, err := ParseTrackFilter(query); err == nil {
+			t.Errorf("'%s' was accepted", rawQuery)
+		}
+	}
+}
+
+// Tests the great circle distance between two known points
+func Test_haversineDistance(t *testing.T) {
+	distance := HaversineDistance(60.39, 5.32, 59.91, 10.75) // Bergen to Oslo, about 305 km
+	if distance < 300000 || distance > 310000 {
+		t.Errorf("Expected about 305 km, got %.0f m", distance)
+	}
+}
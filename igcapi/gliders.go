@@ -0,0 +1,130 @@
+package igcapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+GliderClasses are the classes a glider can be assigned, from the EN certification or CCC for competition gliders
+*/
+var GliderClasses = []string{"EN-A", "EN-B", "EN-C", "EN-D", "CCC"}
+
+/*
+Glider is a glider in the registry. The model, class and owner are set through the API,
+the totals are aggregated from the tracks flown with the glider
+*/
+type Glider struct {
+	ID       string  `json:"id"`
+	Model    string  `json:"model"`
+	Class    string  `json:"class"`
+	Owner    string  `json:"owner"`
+	Flights  int     `json:"flights"`
+	Airtime  int64   `json:"airtime"`  // Seconds
+	Distance float64 `json:"distance"` // The sum of the track lengths, in km
+}
+
+/*
+GliderRegistration contains the fields of a glider that are set through the API
+*/
+type GliderRegistration struct {
+	Model string `json:"model"`
+	Class string `json:"class"`
+	Owner string `json:"owner"`
+}
+
+/*
+NormalizeGliderID returns the registry ID of a glider ID from an H record: uppercase and without whitespace
+*/
+func NormalizeGliderID(gliderID string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(gliderID), ""))
+}
+
+/*
+NormalizeGliderClass returns the class in the form of GliderClasses ("en b" and "b" -> "EN-B"), and if it's a valid class.
+An empty class is valid and means the class isn't known
+*/
+func NormalizeGliderClass(class string) (string, bool) {
+	class = strings.ToUpper(strings.Join(strings.Fields(class), ""))
+	class = strings.TrimPrefix(strings.TrimPrefix(class, "EN"), "-")
+	if class == "" {
+		return "", true
+	}
+	if len(class) == 1 {
+		class = "EN-" + class
+	}
+
+	for _, valid := range GliderClasses {
+		if class == valid {
+			return class, true
+		}
+	}
+
+	return "", false
+}
+
+/*
+AddTrack adds a track to the glider's totals
+*/
+func (g *Glider) AddTrack(t TrackInfo) {
+	if g.Model == "" {
+		g.Model = strings.TrimSpace(t.Glider)
+	}
+
+	g.Flights++
+	g.Airtime += t.Airtime
+	g.Distance += t.TrackLength
+}
+
+/*
+CalculateGlider calculates the totals of a glider from the tracks flown with it, the registered fields are kept
+*/
+func CalculateGlider(glider Glider, tracks []TrackInfo) Glider {
+	glider.Flights, glider.Airtime, glider.Distance = 0, 0, 0
+	for _, track := range tracks {
+		if NormalizeGliderID(track.GliderID) == glider.ID {
+			glider.AddTrack(track)
+		}
+	}
+
+	return glider
+}
+
+/*
+RecalculateGlider recalculates and stores the totals of a glider from the stored tracks
+*/
+func RecalculateGlider(id string) {
+	if id == "" {
+		return
+	}
+
+	tracks, err := db.Find(TrackFilter{GliderKey: id})
+	if err != nil {
+		fmt.Printf("Couldn't retrieve the tracks of glider %s: %s\n", id, err.Error())
+		return
+	}
+
+	glider, found := gliderDB.Get(id)
+	if !found {
+		glider = Glider{ID: id}
+	}
+	gliderDB.SetTotals(CalculateGlider(glider, tracks))
+}
+
+/*
+BackfillGliderKeys sets the glider key of the tracks stored before tracks had one
+*/
+func BackfillGliderKeys() {
+	tracks, err := db.GetAll()
+	if err != nil {
+		fmt.Println("Couldn't retrieve the tracks to set their glider keys:", err.Error())
+		return
+	}
+
+	for _, track := range tracks {
+		if key := NormalizeGliderID(track.GliderID); track.GliderKey != key {
+			track.GliderKey = key
+			db.Update(track)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package igcapi
+
+import (
+	"testing"
+)
+
+// Tests that glider IDs and classes written in different ways are normalized
+func Test_normalizeGlider(t *testing.T) {
+	if id := NormalizeGliderID(" ec-xll "); id != "EC-XLL" {
+		t.Errorf("Expected EC-XLL, got '%s'", id)
+	}
+
+	classes := map[string]string{"en-b": "EN-B", "EN B": "EN-B", "c": "EN-C", "ccc": "CCC", "": ""}
+	for class, expected := range classes {
+		if normalized, ok := NormalizeGliderClass(class); !ok || normalized != expected {
+			t.Errorf("'%s': expected %s, got '%s' (valid: %v)", class, expected, normalized, ok)
+		}
+	}
+
+	for _, class := range []string{"EN-E", "DHV 1-2", "tandem"} {
+		if _, ok := NormalizeGliderClass(class); ok {
+			t.Errorf("'%s' was accepted as a class", class)
+		}
+	}
+}
+
+// Tests that the totals of a glider only count its own tracks, and that the registered fields are kept
+func Test_calculateGlider(t *testing.T) {
+	tracks := []TrackInfo{
+		{Glider: "Ozone Rush", GliderID: "EC-XLL", TrackLength: 40, Airtime: 3600},
+		{Glider: "Gin Bolero", GliderID: "LN-123", TrackLength: 80, Airtime: 7200},
+		{Glider: "Ozone Rush", GliderID: "ec-xll", TrackLength: 10, Airtime: 600},
+	}
+
+	glider := CalculateGlider(Glider{ID: "EC-XLL", Model: "Rush 4", Class: "EN-B", Owner: "Anna", Flights: 9}, tracks)
+	expected := Glider{ID: "EC-XLL", Model: "Rush 4", Class: "EN-B", Owner: "Anna", Flights: 2, Airtime: 4200, Distance: 50}
+	if glider != expected {
+		t.Errorf("Expected %+v, got %+v", expected, glider)
+	}
+
+	if glider = CalculateGlider(Glider{ID: "LN-123"}, tracks); glider.Model != "Gin Bolero" {
+		t.Errorf("Expected the model of an unregistered glider to be taken from its track, got '%s'", glider.Model)
+	}
+}
+
+// Tests that a glider is recalculated from the tracks with its glider key, and that tracks stored without a key get one
+func Test_recalculateGlider(t *testing.T) {
+	defer func(storage TrackStorage, gliders GliderStorage) { db, gliderDB = storage, gliders }(db, gliderDB)
+	db = &TrackMemoryDB{}
+	gliderDB = &GliderMemoryDB{}
+
+	db.Add(TrackInfo{ID: 1, Glider: "Ozone Rush", GliderID: "EC-XLL", TrackLength: 40}) // Stored before tracks had a key
+	db.Add(TrackInfo{ID: 2, Glider: "Gin Bolero", GliderID: "LN-123", GliderKey: "LN-123", TrackLength: 80})
+	db.Add(TrackInfo{ID: 3, Glider: "Ozone Rush", GliderID: "ec xll", GliderKey: "ECXLL", TrackLength: 10})
+
+	BackfillGliderKeys()
+	if track, _ := db.Get(1); track.GliderKey != "EC-XLL" {
+		t.Errorf("Expected the glider key EC-XLL, got '%s'", track.GliderKey)
+	}
+
+	RecalculateGlider("EC-XLL")
+	if glider, _ := gliderDB.Get("EC-XLL"); glider.Flights != 1 || glider.Distance != 40 {
+		t.Errorf("Expected 1 flight of 40 km, got %+v", glider)
+	}
+	RecalculateGlider("ECXLL")
+	if glider, _ := gliderDB.Get("ECXLL"); glider.Flights != 1 || glider.Distance != 10 {
+		t.Errorf("Expected 1 flight of 10 km, got %+v", glider)
+	}
+}
@@ -20,7 +20,15 @@ func PostURLToServer(t *testing.T, s *httptest.Server) *http.Response {
 
 	postURL := "{\"url\":\"http://skypolaris.org/wp-content/uploads/IGS%20Files/Madrid%20to%20Jerez.igc\"}"
 
-	response, err := http.Post(url, "application/json", strings.NewReader(postURL))
+	apiKey, key, err := NewAPIKey("test uploader", RoleUploader) // Adding tracks needs an uploader key
+	if err != nil || !keyDB.Add(apiKey) {
+		t.Fatalf("Couldn't create a key: %v", err)
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(postURL))
+	request.Header.Set("content-type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+key)
+	response, err := http.DefaultClient.Do(request)
 	if err != nil {
 		t.Errorf("Error making POST request %s", err)
 	}
@@ -34,7 +42,7 @@ func PostURLToServer(t *testing.T, s *httptest.Server) *http.Response {
 
 // Tests that /igcinfo/api/ responds with information about the API
 func Test_handlerAPI_info(t *testing.T) {
-	testServer := httptest.NewServer(http.HandlerFunc(HandlerAPI))
+	testServer := httptest.NewServer(NewRouter())
 	defer testServer.Close()
 
 	url := testServer.URL + "/paragliding/api/"
@@ -67,7 +75,7 @@ func Test_handlerAPI_info(t *testing.T) {
 
 // Tests that posting to the server returns the correct response (the ID)
 func Test_handlerIGC_POST(t *testing.T) {
-	testServer := httptest.NewServer(http.HandlerFunc(HandlerTrack))
+	testServer := httptest.NewServer(NewRouter())
 	defer testServer.Close()
 
 	response := PostURLToServer(t, testServer)
@@ -84,7 +92,7 @@ func Test_handlerIGC_POST(t *testing.T) {
 
 // Tests that /paragliding/api/track/ returns an empty array before anything is posted
 func Test_handlerIGC_empty(t *testing.T) {
-	testServer := httptest.NewServer(http.HandlerFunc(HandlerTrack))
+	testServer := httptest.NewServer(NewRouter())
 	defer testServer.Close()
 
 	url := testServer.URL + "/paragliding/api/track/"
@@ -104,7 +112,7 @@ func Test_handlerIGC_empty(t *testing.T) {
 
 // Tests that /paragliding/api/track/<ID> returns the correct information about the track with ID 1
 func Test_handlerIGC_ID(t *testing.T) {
-	testServer := httptest.NewServer(http.HandlerFunc(HandlerTrack))
+	testServer := httptest.NewServer(NewRouter())
 	defer testServer.Close()
 
 	url := testServer.URL + "/paragliding/api/track/"
@@ -138,7 +146,7 @@ func Test_handlerIGC_ID(t *testing.T) {
 
 // Checks that all the fields match after posted to the server
 func Test_handlerIGC_ID_Field(t *testing.T) {
-	testServer := httptest.NewServer(http.HandlerFunc(HandlerTrack))
+	testServer := httptest.NewServer(NewRouter())
 	defer testServer.Close()
 
 	url := testServer.URL + "/paragliding/api/track/"
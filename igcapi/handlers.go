@@ -2,14 +2,15 @@ package igcapi
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
-
-	igc "github.com/marni/goigc"
 )
 
 const (
@@ -17,400 +18,1155 @@ const (
 )
 
 var (
-	db        TrackDB
-	webhookDB WebhookDB
+	db         TrackStorage
+	webhookDB  WebhookStorage
+	revisionDB RevisionStorage
+	pointsDB   PointsStorage
+	siteDB     SiteStorage
+	pilotDB    PilotStorage
+	gliderDB   GliderStorage
+	auditDB    AuditStorage
+	jobDB      JobStorage
+	keyDB      APIKeyStorage
+	fetcher    Fetcher
 )
 
 func init() {
-	db = TrackDB{
-		DatabaseURL:    dbURL,
-		DatabaseName:   "paragliding",
-		CollectionName: "tracks",
+	if storage, _ := os.LookupEnv("TRACK_STORAGE"); storage == "memory" { // Every store, so nothing needs a database
+		db = &TrackMemoryDB{}
+		keyDB = &APIKeyMemoryDB{}
+		webhookDB = &WebhookMemoryDB{}
+		revisionDB = &RevisionMemoryDB{}
+		pointsDB = &PointsMemoryDB{}
+		siteDB = &SiteMemoryDB{}
+		pilotDB = &PilotMemoryDB{}
+		gliderDB = &GliderMemoryDB{}
+		auditDB = &AuditMemoryDB{}
+		jobDB = &JobMemoryDB{}
+	} else {
+		initMongoStorage()
 	}
-	db.Init()
+	SetAdminKey(os.Getenv("ADMIN_API_KEY"))
 
-	webhookDB = WebhookDB{
-		DatabaseURL:    dbURL,
-		DatabaseName:   "paragliding",
-		CollectionName: "webhooks",
+	if storage, _ := os.LookupEnv("RATE_LIMIT_STORAGE"); storage == "mongo" { // Shared by every server
+		limitDB := &RateLimitDB{
+			DatabaseURL:    dbURL,
+			DatabaseName:   "paragliding",
+			CollectionName: "ratelimits",
+		}
+		limitDB.Init()
+		rateLimitStore = limitDB
+	}
+	for budget, name := range map[string]string{BudgetRead: "RATE_LIMIT_READ", BudgetUpload: "RATE_LIMIT_UPLOAD", BudgetWebhook: "RATE_LIMIT_WEBHOOK"} {
+		if param, ok := os.LookupEnv(name); ok {
+			if limit, err := ParseRateLimit(param); err == nil {
+				SetRateLimit(budget, limit)
+			} else {
+				fmt.Printf("Invalid %s, using the default: %s\n", name, err.Error())
+			}
+		}
+	}
+	if trust, ok := os.LookupEnv("TRUST_PROXY"); ok { // "true" for one proxy, or the amount of proxies
+		if trust == "true" {
+			trustedProxies = 1
+		} else if proxies, err := strconv.Atoi(trust); err == nil && proxies >= 0 {
+			trustedProxies = proxies
+		} else {
+			fmt.Println("Invalid TRUST_PROXY, X-Forwarded-For isn't used")
+		}
+	}
+
+	if public, ok := os.LookupEnv("PUBLIC_URL"); ok { // Like "https://example.com", used in the links of the feeds
+		if parsed, err := url.Parse(public); err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" {
+			publicURL = url.URL{Scheme: parsed.Scheme, Host: parsed.Host} // The routes are at the root of the host
+		} else {
+			fmt.Println("Invalid PUBLIC_URL, using the default:", publicURL.String())
+		}
+	}
+
+	if aliases, ok := os.LookupEnv("PILOT_ALIASES"); ok { // "alias=name;alias=name"
+		parsed, err := ParsePilotAliases(aliases)
+		if err != nil {
+			fmt.Println("Invalid PILOT_ALIASES, no aliases are used:", err.Error())
+		} else {
+			pilotAliases = parsed
+		}
+	}
+
+	fetcher = Fetcher{
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    15 * time.Second,
+		MaxBodySize:    maxIGCSize,
+		MaxRetries:     2,
+		RetryDelay:     time.Second,
+	}
+	if hosts, ok := os.LookupEnv("IGC_ALLOWED_HOSTS"); ok && hosts != "" { // Comma separated list of hosts
+		fetcher.AllowedHosts = strings.Split(hosts, ",")
+	}
+	fetcher.Init()
+
+	if best, ok := os.LookupEnv("LEADERBOARD_BEST_FLIGHTS"); ok {
+		if n, err := strconv.Atoi(best); err == nil && n >= 0 {
+			leaderboardBestFlights = n
+		} else {
+			fmt.Println("Invalid LEADERBOARD_BEST_FLIGHTS, using the default:", leaderboardBestFlights)
+		}
+	}
+
+	// Only for test setups, with a known key anyone could sign files that are reported as valid
+	if testKey, ok := os.LookupEnv("IGC_TEST_SIGNATURE_KEY"); ok && testKey != "" {
+		RegisterSignatureVerifier(TestKeyVerifier{Manufacturer: "XTK", Key: []byte(testKey)})
 	}
-	webhookDB.Init()
+}
+
+// initMongoStorage connects every store to its collection in the database
+func initMongoStorage() {
+	trackDB := &TrackDB{DatabaseURL: dbURL, DatabaseName: "paragliding", CollectionName: "tracks"}
+	trackDB.Init()
+	db = trackDB
+
+	apiKeyDB := &APIKeyDB{DatabaseURL: dbURL, DatabaseName: "paragliding", CollectionName: "apikeys"}
+	apiKeyDB.Init()
+	keyDB = apiKeyDB
+
+	mongoWebhookDB := &WebhookDB{DatabaseURL: dbURL, DatabaseName: "paragliding", CollectionName: "webhooks"}
+	mongoWebhookDB.Init()
+	webhookDB = mongoWebhookDB
+
+	mongoRevisionDB := &RevisionDB{DatabaseURL: dbURL, DatabaseName: "paragliding", CollectionName: "revisions"}
+	mongoRevisionDB.Init()
+	revisionDB = mongoRevisionDB
+
+	mongoPointsDB := &PointsDB{DatabaseURL: dbURL, DatabaseName: "paragliding", CollectionName: "points"}
+	mongoPointsDB.Init()
+	pointsDB = mongoPointsDB
+
+	mongoSiteDB := &SiteDB{DatabaseURL: dbURL, DatabaseName: "paragliding", CollectionName: "sites"}
+	mongoSiteDB.Init()
+	siteDB = mongoSiteDB
+
+	mongoPilotDB := &PilotDB{DatabaseURL: dbURL, DatabaseName: "paragliding", CollectionName: "pilots"}
+	mongoPilotDB.Init()
+	pilotDB = mongoPilotDB
+
+	mongoGliderDB := &GliderDB{DatabaseURL: dbURL, DatabaseName: "paragliding", CollectionName: "gliders"}
+	mongoGliderDB.Init()
+	gliderDB = mongoGliderDB
+
+	mongoAuditDB := &AuditDB{DatabaseURL: dbURL, DatabaseName: "paragliding", CollectionName: "audit"}
+	mongoAuditDB.Init()
+	auditDB = mongoAuditDB
+
+	mongoJobDB := &JobDB{DatabaseURL: dbURL, DatabaseName: "paragliding", CollectionName: "jobs"}
+	mongoJobDB.Init()
+	jobDB = mongoJobDB
 }
 
 /*
-HandlerAPI handles "/paragliding/api"
+HandlerAPI handles GET /paragliding/api
 */
 func HandlerAPI(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		parts := RemoveEmpty(strings.Split(r.URL.Path, "/"))
-		if len(parts) == 2 {
-			w.Header().Set("content-type", "application/json")
-
-			info := APIInfo{
-				Uptime:  FormatISO8601(time.Since(startTime)),
-				Info:    "Service for IGC tracks",
-				Version: "V1",
-			}
+	info := APIInfo{
+		Uptime:  FormatISO8601(time.Since(startTime)),
+		Info:    "Service for IGC tracks",
+		Version: strings.ToUpper(RequestVersion(r)), // "V1" or "V2"
+	}
+
+	writeJSON(w, r, http.StatusOK, info)
+}
+
+/*
+HandlerTracks handles GET /paragliding/api/track, returns the IDs of the tracks matching the filter
+*/
+func HandlerTracks(w http.ResponseWriter, r *http.Request) {
+	filter, err := ParseTrackFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+
+	page, err := ParsePageRequest(r.URL.Query(), DefaultPageLimit, "id")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+
+	tracks, next, err := db.FindPage(filter, page)
+	if err != nil {
+		internalError(w, r, "Couldn't search for tracks")
+		return
+	}
 
-			json.NewEncoder(w).Encode(&info)
-		} else { // /paragliding/api/<rubbish>
-			statusCode := http.StatusNotFound
-			http.Error(w, http.StatusText(statusCode), statusCode)
+	IDs := []int{}
+	for _, track := range tracks {
+		IDs = append(IDs, track.ID)
+	}
+
+	SetLinkHeader(w, r, next)
+	writeJSON(w, r, http.StatusOK, IDs)
+}
+
+/*
+HandlerTrackAdd handles POST /paragliding/api/track, adds the track at the given URL and returns its ID
+*/
+func HandlerTrackAdd(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxIGCSize)
+
+	var body TrackURL
+	if err := json.NewDecoder(r.Body).Decode(&body); isTooLarge(err) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "The body is too large")
+		return
+	} else if err != nil || body.URL == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid POST field given, has to be {\"url\": <url>}")
+		return
+	}
+	url := body.URL
+
+	job, err := NewFetchJob(url)
+	if err != nil || !jobDB.Add(job) {
+		internalError(w, r, "Couldn't create the fetch job")
+		return
+	}
+	w.Header().Set("Link", fmt.Sprintf("<%s/jobs/%s>; rel=\"job\"", strings.TrimSuffix(r.URL.Path, "/"), job.ID))
+	events.Publish(JobStatus{Job: job})
+
+	parsedTrack, content, err := fetcher.FetchTrack(&job)
+	if err != nil { // If the passed URL couldn't be fetched or parsed the function aborts
+		updateJob(job)
+		WriteError(w, r, FetchError(err, job.Failures))
+		return
+	}
+
+	track := NewTrackInfo(parsedTrack, url)
+	track.ID = nextID
+	track.Timestamp = time.Now().Unix()
+	track.Revision = 1
+	track.ContentHash = job.ContentHash
+	track.ETag = job.ETag
+	track.LastModified = job.LastModified
+	track.SignatureStatus = VerifySignature(content)
+
+	points := NewTrackPoints(parsedTrack)
+	SetGeometry(&track, points)
+	track.Airtime = Airtime(points)
+	track.Score = ScoreTrack(points)
+
+	if !db.Add(track) { // The URL is unique, so the track has already been added
+		job.Status = JobDuplicate
+		updateJob(job)
+		// Deleted tracks keep their URL until they're purged, so they have to be restored instead
+		if trashed, err := db.Find(TrackFilter{SourceURL: url, Deleted: true}); err == nil && len(trashed) > 0 {
+			writeError(w, r, http.StatusConflict, CodeConflict,
+				fmt.Sprintf("The track has already been added, and is in the trash as track %d", trashed[0].ID))
+			return
 		}
+		writeError(w, r, http.StatusConflict, CodeConflict, "The track has already been added")
+		return
+	}
 
-	default:
-		statusCode := http.StatusNotImplemented
-		http.Error(w, http.StatusText(statusCode), statusCode)
+	// The site is assigned after adding, as assigning creates and moves sites, which duplicates mustn't do
+	AssignSite(&track)
+	if track.SiteID != 0 {
+		db.Update(track)
 	}
+	pointsDB.Set(track.ID, points)
+	revisionDB.Add(TrackRevision{
+		TrackID:     track.ID,
+		Revision:    track.Revision,
+		ContentHash: track.ContentHash,
+		Timestamp:   track.Timestamp,
+		Track:       track,
+	})
+	job.TrackID = track.ID
+	updateJob(job)
+	events.Publish(TrackAdded{Track: track}) // The pilot and glider totals are updated by the listener
+
+	idMap := make(map[string]int)
+	idMap["id"] = nextID
+	nextID++
+
+	writeJSON(w, r, http.StatusOK, idMap) // Encode the map as a JSON object
+}
+
+// updateJob stores the new status of a job, and publishes it
+func updateJob(job FetchJob) {
+	jobDB.Update(job)
+	events.Publish(JobStatus{Job: job, TrackID: job.TrackID})
 }
 
 /*
-HandlerTrack handles "/paragliding/api/track"
+HandlerTrackJob handles GET /paragliding/api/track/jobs/<id>, the status and attempts of the fetch of an added track
 */
-func HandlerTrack(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("content-type", "application/json")
-	parts := strings.Split(r.URL.Path, "/")
-
-	// Remove "[ paragliding api]" to make it more natural to work with "[igc]" being the start of the array
-	parts = RemoveEmpty(parts[3:]) // Remove the empty strings, this makes it so "/track/" and "/track" is treated as the same
-
-	switch len(parts) {
-	case 1: // PATH: /track/
-		switch r.Method {
-		case http.MethodGet: // Return all the IDs in use
-			IDs, _ := db.GetAllIDs()
-			json.NewEncoder(w).Encode(IDs)
-
-		case http.MethodPost: // Add a new track, return its ID
-			bodyStr, err := ioutil.ReadAll(r.Body) // Read the entire body (SHOULD be of form {"url": <url>})
-			if err != nil {
-				fmt.Println("Couldn't read the response body")
-				return
-			}
+func HandlerTrackJob(w http.ResponseWriter, r *http.Request) {
+	job, found := jobDB.Get(PathParam(r, "id"))
+	if !found {
+		notFound(w, r, "Invalid job ID given")
+		return
+	}
 
-			urlMap := make(map[string]string) // Convert the JSON string to a map
-			json.Unmarshal(bodyStr, &urlMap)
+	writeJSON(w, r, http.StatusOK, job)
+}
 
-			url := urlMap["url"]
-			if url == "" { // If the field name from the json is wrong no element (empty string) will be returned
-				http.Error(w, "Invalid POST field given", http.StatusNotFound)
-				return
-			}
+// getTrack returns the track with the ID in the path, and writes 404 if it doesn't exist
+func getTrack(w http.ResponseWriter, r *http.Request) (TrackInfo, bool) {
+	track, found := db.Get(PathInt(r, "id"))
+	if !found {
+		notFound(w, r, "Invalid ID given")
+	}
 
-			parsedTrack, err := igc.ParseLocation(url)
-			if err != nil { // If the passed URL couldn't be parsed the function aborts
-				http.Error(w, fmt.Sprintf("Bad Request; Invalid URL given: %s", err.Error()), http.StatusBadRequest)
-				return
-			}
+	return track, found
+}
 
-			track := TrackInfo{
-				HDate:          parsedTrack.Date,
-				Pilot:          parsedTrack.Pilot,
-				Glider:         parsedTrack.GliderType,
-				GliderID:       parsedTrack.GliderID,
-				TrackSourceURL: url,
-				ID:             nextID,
-				Timestamp:      time.Now().Unix(),
-			}
+/*
+HandlerTrack handles GET /paragliding/api/track/<id>
+*/
+func HandlerTrack(w http.ResponseWriter, r *http.Request) {
+	track, found := getTrack(w, r)
+	if !found {
+		return
+	}
 
-			parsedTrack.Task.Start = parsedTrack.Points[0] // Set the points of the track
-			parsedTrack.Task.Finish = parsedTrack.Points[len(parsedTrack.Points)-1]
-			parsedTrack.Task.Turnpoints = parsedTrack.Points[1 : len(parsedTrack.Points)-1] // [from, including : to, not including]
-			track.TrackLength = parsedTrack.Task.Distance()
+	writeJSON(w, r, http.StatusOK, track)
+}
 
-			if db.Add(track) {
-				idMap := make(map[string]int)
-				idMap["id"] = nextID
-				nextID++
-				json.NewEncoder(w).Encode(idMap) // Encode the map as a JSON object
-			} else {
-				w.Header().Set("content-type", "text/plain")
-				//http.Error(w, fmt.Sprintf("2%s", "f"), 201)
-				fmt.Fprintf(w, "Couldn't add the track: %s\n", "xd")
-			}
+/*
+HandlerTrackField handles GET /paragliding/api/track/<id>/<field>, returns the field as text.
+The fields are named as in the JSON of the track in the version
+*/
+func HandlerTrackField(w http.ResponseWriter, r *http.Request) {
+	track, found := getTrack(w, r)
+	if !found {
+		return
+	}
 
-		default:
-			statusCode := http.StatusNotImplemented
-			http.Error(w, http.StatusText(statusCode), statusCode)
+	response := make(map[string]interface{})
+	response["H_date"] = track.HDate
+	response["pilot"] = track.Pilot
+	response["glider"] = track.Glider
+	response["glider_id"] = track.GliderID
+	response["track_length"] = track.TrackLength
+	response["track_src_url"] = track.TrackSourceURL
+	response["signature_status"] = track.SignatureStatus
+	response["pilot_id"] = track.PilotID
+	if RequestVersion(r) == Version2 {
+		response = map[string]interface{}{
+			"date":             track.HDate.Format(time.RFC3339),
+			"pilot":            track.Pilot,
+			"pilot_id":         track.PilotID,
+			"glider":           track.Glider,
+			"glider_id":        track.GliderID,
+			"source_url":       track.TrackSourceURL,
+			"signature_status": track.SignatureStatus,
+			"site_id":          track.SiteID,
+			"length":           track.TrackLength,
 		}
+	}
+
+	res, found := response[PathParam(r, "field")]
+	if !found {
+		notFound(w, r, "Invalid field given")
+		return
+	}
+
+	w.Header().Set("content-type", "text/plain")
+	fmt.Fprintln(w, res)
+}
+
+/*
+HandlerTrackRevisions handles GET /paragliding/api/track/<id>/revisions
+*/
+func HandlerTrackRevisions(w http.ResponseWriter, r *http.Request) {
+	track, found := getTrack(w, r)
+	if !found {
+		return
+	}
+
+	revisions, err := revisionDB.GetAll(track.ID)
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the revisions")
+		return
+	}
 
-	case 2, 3: // PATH: /<id> or /<id>/<field>
-		HandlerTrackFieldID(w, r)
+	writeJSON(w, r, http.StatusOK, revisions)
+}
 
-	default: // More than 3 parts in the url (after /api/) is not implemented
-		statusCode := http.StatusBadRequest
-		http.Error(w, http.StatusText(statusCode), statusCode)
+/*
+HandlerTrackAudit handles GET /paragliding/api/track/<id>/audit
+*/
+func HandlerTrackAudit(w http.ResponseWriter, r *http.Request) {
+	track, found := getTrack(w, r)
+	if !found {
+		return
 	}
+
+	entries, err := auditDB.GetAll(track.ID)
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the audit trail")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, entries)
 }
 
 /*
-HandlerTrackFieldID handles /paragliding/api/track/<ID> and /paragliding/api/track/<id>/<field>
+HandlerTrackEdit handles PATCH /paragliding/api/track/<id>, corrects the metadata of the track
 */
-func HandlerTrackFieldID(w http.ResponseWriter, r *http.Request) {
-	parts := strings.Split(r.URL.Path, "/")
-	parts = RemoveEmpty(parts[4:])
+func HandlerTrackEdit(w http.ResponseWriter, r *http.Request) {
+	track, found := getTrack(w, r)
+	if !found {
+		return
+	}
 
-	switch r.Method {
-	case http.MethodGet:
-		id, err := strconv.Atoi(parts[0])
-		if err != nil { // Not an integer given
-			http.Error(w, "Invalid ID type given", http.StatusBadRequest)
+	edit, err := ParseTrackEdit(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	}
+
+	edited, changes := edit.Apply(track)
+	if len(changes) > 0 {
+		if !db.Update(edited) {
+			internalError(w, r, "Couldn't update the track")
 			return
 		}
+		auditDB.Add(NewAuditEntry(track.ID, AuditEdit, changes))
+		events.Publish(TrackUpdated{Before: track, After: edited})
+	}
 
-		track, found := db.Get(id)
-		if found {
-			response := make(map[string]interface{})
-			response["H_date"] = track.HDate
-			response["pilot"] = track.Pilot
-			response["glider"] = track.Glider
-			response["glider_id"] = track.Glider
-			response["track_length"] = track.TrackLength
-			response["track_src_url"] = track.TrackSourceURL
-
-			if len(parts) == 1 { // /track/<ID>/
-				json.NewEncoder(w).Encode(track)
-			} else { // /track/<ID>/<field>/
-				w.Header().Set("content-type", "text/plain")
-
-				field := parts[1]
-				if res, found := response[field]; found {
-					fmt.Fprintln(w, res)
-				} else {
-					http.Error(w, "Invalid field given", http.StatusBadRequest)
-				}
-			}
+	writeJSON(w, r, http.StatusOK, edited)
+}
 
-		} else {
-			http.Error(w, "Invalid ID given", http.StatusBadRequest)
+/*
+HandlerTrackDelete handles DELETE /paragliding/api/track/<id>, moves the track to the trash
+*/
+func HandlerTrackDelete(w http.ResponseWriter, r *http.Request) {
+	track, found := getTrack(w, r)
+	if !found {
+		return
+	}
+
+	track.DeletedAt = time.Now().Unix()
+	if !db.Delete(track.ID, track.DeletedAt) {
+		internalError(w, r, "Couldn't delete the track")
+		return
+	}
+	auditDB.Add(NewAuditEntry(track.ID, AuditDelete, nil))
+	events.Publish(TrackDeleted{Track: track})
 
+	writeJSON(w, r, http.StatusOK, track)
+}
+
+/*
+HandlerTrackPoints handles GET /paragliding/api/track/<id>/points. The points can be limited to a time
+window with "from" and "to" (RFC 3339 or unix timestamps), resampled with "resample=<seconds>"
+and simplified with "simplify=<meters>"
+*/
+func HandlerTrackPoints(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, err := parseTimeParam(query.Get("from"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "Invalid 'from' given")
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "Invalid 'to' given")
+		return
+	}
+
+	resample := 0.0
+	if param := query.Get("resample"); param != "" {
+		if resample, err = strconv.ParseFloat(param, 64); err != nil || resample < 0 {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "Invalid 'resample' given")
+			return
+		}
+	}
+
+	simplify := 0.0
+	if param := query.Get("simplify"); param != "" {
+		if simplify, err = strconv.ParseFloat(param, 64); err != nil || simplify < 0 {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "Invalid 'simplify' given")
+			return
 		}
+	}
+
+	track, found := getTrack(w, r)
+	if !found {
+		return
+	}
+
+	points, found := pointsDB.Get(track.ID)
+	if !found {
+		notFound(w, r, "No points stored for the given ID")
+		return
+	}
+
+	points = FilterPointsByTime(points, from, to)
+	points = ResamplePoints(points, time.Duration(resample*float64(time.Second)))
+	points = SimplifyPoints(points, simplify)
+
+	writeJSON(w, r, http.StatusOK, points)
+}
+
+// parseTimeParam parses a query parameter given as RFC 3339 or a unix timestamp, an empty parameter gives the zero time
+func parseTimeParam(param string) (time.Time, error) {
+	if param == "" {
+		return time.Time{}, nil
+	}
+
+	if unix, err := strconv.ParseInt(param, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+
+	return time.Parse(time.RFC3339, param)
+}
 
+/*
+HandlerSites handles GET /paragliding/api/sites
+*/
+func HandlerSites(w http.ResponseWriter, r *http.Request) {
+	sites, err := siteDB.GetAll()
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the sites")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, sites)
+}
+
+/*
+HandlerSiteAdd handles POST /paragliding/api/sites, adds a named site given as {"name": .., "lat": .., "lng": .., "radius": ..}
+*/
+func HandlerSiteAdd(w http.ResponseWriter, r *http.Request) {
+	var site Site
+	if err := json.NewDecoder(r.Body).Decode(&site); err != nil || site.Name == "" || !validLatLng(site.Lat, site.Lng) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid site given")
+		return
+	}
+	if site.Radius <= 0 {
+		site.Radius = defaultSiteRadius
+	}
+
+	added := addSites([]Site{site})
+	if len(added) == 0 {
+		internalError(w, r, "Couldn't add the site")
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, added[0])
+}
+
+/*
+HandlerSitesImport handles POST /paragliding/api/sites/import?format=csv|cup
+*/
+func HandlerSitesImport(w http.ResponseWriter, r *http.Request) {
+	var sites []Site
+	var err error
+	switch r.URL.Query().Get("format") {
+	case "", "csv":
+		sites, err = ParseSitesCSV(http.MaxBytesReader(w, r.Body, maxIGCSize))
+	case "cup":
+		sites, err = ParseSitesCUP(http.MaxBytesReader(w, r.Body, maxIGCSize))
 	default:
-		statusCode := http.StatusNotImplemented
-		http.Error(w, http.StatusText(statusCode), statusCode)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "Invalid format given, has to be csv or cup")
+		return
 	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, fmt.Sprintf("Couldn't parse the sites: %s", err.Error()))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, addSites(sites))
+}
+
+// getSite returns the site with the ID in the path, and writes 404 if it doesn't exist
+func getSite(w http.ResponseWriter, r *http.Request) (Site, bool) {
+	site, found := siteDB.Get(PathInt(r, "id"))
+	if !found {
+		notFound(w, r, "Invalid ID given")
+	}
+
+	return site, found
 }
 
 /*
-HandlerTicker handles /paragliding/api/ticker/
+HandlerSite handles GET /paragliding/api/sites/<id>, returns the site with the stats of its tracks
 */
-func HandlerTicker(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		w.Header().Set("content-type", "application/json")
-		parts := RemoveEmpty(strings.Split(r.URL.Path, "/"))
-		parts = parts[2:]
+func HandlerSite(w http.ResponseWriter, r *http.Request) {
+	site, found := getSite(w, r)
+	if !found {
+		return
+	}
+
+	tracks, err := db.Find(TrackFilter{SiteID: site.ID})
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the tracks")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, SiteDetails{site, CalculateSiteStats(tracks)})
+}
+
+/*
+HandlerSiteTracks handles GET /paragliding/api/sites/<id>/tracks
+*/
+func HandlerSiteTracks(w http.ResponseWriter, r *http.Request) {
+	site, found := getSite(w, r)
+	if !found {
+		return
+	}
+
+	page, err := ParsePageRequest(r.URL.Query(), DefaultPageLimit, "id")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+
+	tracks, next, err := db.FindPage(TrackFilter{SiteID: site.ID}, page)
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the tracks")
+		return
+	}
 
-		pagingSize := 5
+	IDs := []int{}
+	for _, track := range tracks {
+		IDs = append(IDs, track.ID)
+	}
+
+	SetLinkHeader(w, r, next)
+	writeJSON(w, r, http.StatusOK, IDs)
+}
+
+// addSites gives the sites IDs and stores them, and returns the sites that were added
+func addSites(sites []Site) []Site {
+	sitesMutex.Lock()
+	defer sitesMutex.Unlock()
+
+	added := []Site{}
+	for _, site := range sites {
+		site.ID = nextSiteID
+		if siteDB.Add(site) {
+			nextSiteID++
+			added = append(added, site)
+		}
+	}
+
+	return added
+}
+
+/*
+HandlerPilots handles GET /paragliding/api/pilots
+*/
+func HandlerPilots(w http.ResponseWriter, r *http.Request) {
+	pilots, err := pilotDB.GetAll()
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the pilots")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, pilots)
+}
+
+/*
+HandlerPilot handles GET /paragliding/api/pilots/<id>
+*/
+func HandlerPilot(w http.ResponseWriter, r *http.Request) {
+	pilot, found := pilotDB.Get(PathParam(r, "id"))
+	if !found {
+		notFound(w, r, "Invalid ID given")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, pilot)
+}
+
+/*
+HandlerPilotTracks handles GET /paragliding/api/pilots/<id>/tracks
+*/
+func HandlerPilotTracks(w http.ResponseWriter, r *http.Request) {
+	pilot, found := pilotDB.Get(PathParam(r, "id"))
+	if !found {
+		notFound(w, r, "Invalid ID given")
+		return
+	}
+
+	page, err := ParsePageRequest(r.URL.Query(), DefaultPageLimit, "id")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+
+	tracks, next, err := db.FindPage(TrackFilter{PilotID: pilot.ID}, page)
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the tracks")
+		return
+	}
+
+	IDs := []int{}
+	for _, track := range tracks {
+		IDs = append(IDs, track.ID)
+	}
+
+	SetLinkHeader(w, r, next)
+	writeJSON(w, r, http.StatusOK, IDs)
+}
+
+/*
+HandlerGliders handles GET /paragliding/api/gliders?class=<class>
+*/
+func HandlerGliders(w http.ResponseWriter, r *http.Request) {
+	class, ok := NormalizeGliderClass(r.URL.Query().Get("class"))
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "Invalid class given")
+		return
+	}
+
+	gliders, err := gliderDB.GetAll(class)
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the gliders")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, gliders)
+}
+
+/*
+HandlerGlider handles GET /paragliding/api/gliders/<id>
+*/
+func HandlerGlider(w http.ResponseWriter, r *http.Request) {
+	glider, found := gliderDB.Get(NormalizeGliderID(PathParam(r, "id")))
+	if !found {
+		notFound(w, r, "Invalid ID given")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, glider)
+}
+
+/*
+HandlerGliderRegister handles PUT /paragliding/api/gliders/<id>, registers the glider given as {"model": .., "class": .., "owner": ..}
+*/
+func HandlerGliderRegister(w http.ResponseWriter, r *http.Request) {
+	id := NormalizeGliderID(PathParam(r, "id"))
 
-		taskStart := time.Now().Unix()
+	var registration GliderRegistration
+	if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid glider given")
+		return
+	}
+
+	class, ok := NormalizeGliderClass(registration.Class)
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, fmt.Sprintf("Invalid class given, has to be one of %s", strings.Join(GliderClasses, ", ")))
+		return
+	}
+	registration.Class = class
+
+	// The class decides which leaderboards the flights are on, so only admins can change it
+	current, _ := gliderDB.Get(id)
+	if key, _ := RequestAPIKey(r); class != current.Class && !HasRole(key.Role, RoleAdmin) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Only API keys with the role admin can change the class of a glider")
+		return
+	}
+
+	if !gliderDB.Register(id, registration) {
+		internalError(w, r, "Couldn't register the glider")
+		return
+	}
+	InvalidateLeaderboards() // The class might have changed
+
+	glider, _ := gliderDB.Get(id)
+	writeJSON(w, r, http.StatusOK, glider)
+}
+
+/*
+HandlerLeaderboard handles GET /paragliding/api/leaderboard?season=<year>&site=<id>&class=<class>&metric=<score|distance|airtime>
+*/
+func HandlerLeaderboard(w http.ResponseWriter, r *http.Request) {
+	query, err := ParseLeaderboardQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+
+	leaderboard, err := GetLeaderboard(query)
+	if err != nil {
+		internalError(w, r, "Couldn't calculate the leaderboard")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, leaderboard)
+}
 
-		tracks, err := db.GetAll()
+/*
+HandlerValidate handles POST /paragliding/api/validate. The IGC file can be given as the body,
+as the field "file" of a multipart form, or as a URL in a JSON body ({"url": <url>}).
+Nothing is stored
+*/
+func HandlerValidate(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxIGCSize)
+
+	var content []byte
+	var err error
+	contentType := r.Header.Get("content-type")
+
+	switch {
+	case strings.HasPrefix(contentType, "application/json"):
+		var body TrackURL
+		if err = json.NewDecoder(r.Body).Decode(&body); isTooLarge(err) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "The body is too large")
+			return
+		} else if err != nil || body.URL == "" {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid POST field given, has to be {\"url\": <url>}")
+			return
+		}
+
+		job := FetchJob{URL: body.URL}
+		content, err = fetcher.Fetch(&job)
 		if err != nil {
-			fmt.Println("Error retrieving from DB, DB could be empty.")
+			WriteError(w, r, FetchError(err, job.Failures))
 			return
 		}
 
-		type ticker struct {
-			TLatest    int64 `json:"t_latest"`
-			TStart     int64 `json:"t_start"`
-			TStop      int64 `json:"t_stop"`
-			Tracks     []int `json:"tracks"`
-			Processing int64 `json:"processing"`
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		file, _, err := r.FormFile("file")
+		if isTooLarge(err) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "The body is too large")
+			return
+		} else if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "No file given in the field 'file'")
+			return
 		}
+		defer file.Close()
 
-		switch len(parts) {
-		case 1, 2: // /ticker/ and /ticker/<timestamp>
-			if len(parts) == 2 { // If /ticker/<timestamp> we simply modify the start of the track array
-				timestamp, err := strconv.Atoi(parts[1])
-				if err != nil {
-					http.Error(w, "Invalid ID type given", http.StatusBadRequest)
-					return
-				}
-
-				trackStart := -1
-				for i, val := range tracks {
-					if val.Timestamp == int64(timestamp) {
-						trackStart = i + 1 // The tracks should start at the NEXT after the timestamp
-					}
-				}
-
-				if trackStart == -1 { // If the timestamp wasn't found
-					http.Error(w, "Invalid ID given", http.StatusBadRequest)
-					return
-				}
-
-				if trackStart >= len(tracks) { // The timestamp given is the newest in the DB
-					w.Header().Set("content-type", "text/plain")
-					fmt.Fprintln(w, "No new added tracks")
-					return
-				}
-
-				tracks = tracks[trackStart:] // Remove the tracks before
-			}
+		content, err = ioutil.ReadAll(file)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Couldn't read the file")
+			return
+		}
 
-			trackIDs := []int{}
-			amountOfTracks := Min(pagingSize, len(tracks)) // The amount of tracks on the "page"
+	default: // The body is the IGC file
+		content, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "The body is too large")
+			return
+		}
+	}
 
-			for i := 0; i < amountOfTracks; i++ {
-				trackIDs = append(trackIDs, tracks[i].ID)
-			}
+	writeJSON(w, r, http.StatusOK, ValidateIGC(string(content)))
+}
 
-			response := ticker{
-				TLatest:    tracks[len(tracks)-1].Timestamp,
-				TStart:     tracks[0].Timestamp,
-				TStop:      tracks[amountOfTracks-1].Timestamp,
-				Tracks:     trackIDs,
-				Processing: time.Now().Unix() - taskStart,
-			}
+// isTooLarge returns whether the error is from reading past the limit of http.MaxBytesReader
+func isTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
 
-			json.NewEncoder(w).Encode(response)
+/*
+HandlerTicker handles GET /paragliding/api/ticker and /paragliding/api/ticker/<timestamp>,
+with a timestamp only the tracks added after it are used. The tracks can be limited with since, until, pilot and site,
+see ParseTickerFilter. Without tracks an empty ticker is returned
+*/
+func HandlerTicker(w http.ResponseWriter, r *http.Request) {
+	pagingSize := 5 // The default amount of tracks on a "page"
 
-		default:
-			statusCode := http.StatusBadRequest
-			http.Error(w, http.StatusText(statusCode), statusCode)
-		}
+	taskStart := time.Now().Unix()
 
-	default:
-		statusCode := http.StatusNotImplemented
-		http.Error(w, http.StatusText(statusCode), statusCode)
+	filter, err := ParseTickerFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+	if PathParam(r, "timestamp") != "" {
+		filter.AddedAfter = PathInt64(r, "timestamp")
 	}
 
+	page, err := ParsePageRequest(r.URL.Query(), pagingSize, "timestamp")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+
+	tracks, next, err := db.FindPage(filter, page)
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the tracks")
+		return
+	}
+
+	response := Ticker{Tracks: []int{}}
+	if latest, err := db.GetLast(); err == nil {
+		response.TLatest = latest.Timestamp
+	}
+	if len(tracks) > 0 {
+		response.TStart = tracks[0].Timestamp
+		response.TStop = tracks[len(tracks)-1].Timestamp
+	}
+	for _, track := range tracks {
+		response.Tracks = append(response.Tracks, track.ID)
+	}
+	response.Processing = time.Now().Unix() - taskStart
+
+	SetLinkHeader(w, r, next)
+	writeJSON(w, r, http.StatusOK, response)
 }
 
 /*
-HandlerTickerLatest handles /paragliding/api/ticker/latest/
+HandlerTickerLatest handles GET /paragliding/api/ticker/latest
 */
 func HandlerTickerLatest(w http.ResponseWriter, r *http.Request) {
-	parts := RemoveEmpty(strings.Split(r.URL.Path, "/"))
-	if len(parts) == 4 {
-		t, err := db.GetLast()
-		if err != nil {
-			fmt.Println("Couldn't get a track :)")
+	t, err := db.GetLast()
+	if err != nil {
+		notFound(w, r, "No tracks have been added")
+		return
+	}
+
+	w.Header().Set("content-type", "text/plain")
+	if RequestVersion(r) == Version2 {
+		fmt.Fprintln(w, unixTime(t.Timestamp).Format(time.RFC3339))
+		return
+	}
+	fmt.Fprintln(w, t.Timestamp)
+}
+
+/*
+HandlerWebhookAdd handles POST /paragliding/api/webhook/new_track, registers a webhook given as
+{"webhookURL": <url>, "minTriggerValue": <n>, "events": [<event>]}, or {"url": <url>, "min_trigger_value": <n>, "events": [<event>]} in v2
+*/
+func HandlerWebhookAdd(w http.ResponseWriter, r *http.Request) {
+	var wh Webhook
+	if err := decodeJSON(r, &wh); err != nil || wh.URL == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid webhook given, has to have a URL")
+		return
+	}
+	if wh.MinTriggerValue < 0 {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid minimum trigger value given")
+		return
+	}
+	if wh.MinTriggerValue == 0 {
+		wh.MinTriggerValue = 1
+	}
+	for _, event := range wh.Events {
+		if !containsString(WebhookEventTypes, event) {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidBody, fmt.Sprintf("Invalid event given, has to be one of %s", strings.Join(WebhookEventTypes, ", ")))
 			return
 		}
+	}
+	wh.ID = nextWBID
+	wh.Timestamp = time.Now().Unix()
+	if key, ok := RequestAPIKey(r); ok {
+		wh.Owner = key.ID
+	}
 
-		w.Header().Set("content-type", "text/plain")
-		fmt.Fprintln(w, t.Timestamp)
-	} else {
-		statusCode := http.StatusNotFound
-		http.Error(w, http.StatusText(statusCode), statusCode)
+	if !webhookDB.Add(wh) {
+		internalError(w, r, "Couldn't add the webhook")
+		return
 	}
+	nextWBID++
+	events.Publish(WebhookRegistered{Webhook: wh})
+
+	if RequestVersion(r) == Version2 {
+		writeJSON(w, r, http.StatusCreated, map[string]int{"id": wh.ID})
+		return
+	}
+	w.Header().Set("content-type", "text/plain")
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintln(w, "ID for the new Webhook:", wh.ID)
 }
 
 /*
-HandlerWebhook handles /paragliding/api/webhook/..
+HandlerWebhook handles GET /paragliding/api/webhook/new_track/<id>
 */
 func HandlerWebhook(w http.ResponseWriter, r *http.Request) {
-	parts := RemoveEmpty(strings.Split(r.URL.Path, "/"))
-	parts = parts[3:]
-
-	switch len(parts) {
-	case 1:
-		switch r.Method {
-		case http.MethodPost:
-			bodyStr, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				fmt.Println("Couldn't read the response body")
-				return
-			}
+	wh, found := webhookDB.Get(PathInt(r, "id"))
+	if !found {
+		notFound(w, r, "Invalid ID given")
+		return
+	}
 
-			contentMap := make(map[string]interface{})
-			json.Unmarshal(bodyStr, &contentMap)
+	writeJSON(w, r, http.StatusOK, wh)
+}
 
-			wh := Webhook{
-				URL:       contentMap["webhookURL"].(string),
-				ID:        nextWBID,
-				Timestamp: time.Now().Unix(),
-			}
+/*
+HandlerWebhookDelete handles DELETE /paragliding/api/webhook/new_track/<id>, returns the deleted webhook.
+Only the API key that registered the webhook and admins can delete it
+*/
+func HandlerWebhookDelete(w http.ResponseWriter, r *http.Request) {
+	id := PathInt(r, "id")
+	wh, found := webhookDB.Get(id)
+	if !found {
+		notFound(w, r, "Invalid ID given")
+		return
+	}
+	if key, _ := RequestAPIKey(r); (wh.Owner == "" || key.ID != wh.Owner) && !HasRole(key.Role, RoleAdmin) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Only the API key that registered the webhook and admins can delete it")
+		return
+	}
 
-			triggerValue := contentMap["minTriggerValue"]
+	wh, found = webhookDB.Delete(id)
+	if !found {
+		notFound(w, r, "Invalid ID given")
+		return
+	}
+	events.Publish(WebhookDeleted{Webhook: wh})
 
-			if triggerValue == nil || triggerValue.(int) == 0 {
-				triggerValue = 1
-			}
+	writeJSON(w, r, http.StatusOK, wh)
+}
 
-			wh.MinTriggerValue = triggerValue.(int)
+/*
+HandlerAdminTrackCount handles GET /paragliding/admin/api/tracks_count
+*/
+func HandlerAdminTrackCount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/plain")
+	fmt.Fprintln(w, db.Count())
+}
 
-			if webhookDB.Add(wh) {
-				fmt.Fprintln(w, "ID for the new Webhook:", wh.ID)
-				nextWBID++
-				http.Error(w, http.StatusText(http.StatusCreated), http.StatusCreated)
-			} else {
-				fmt.Fprintln(w, "Couldn't add that webhook")
-			}
+/*
+HandlerAdminTrack handles DELETE /paragliding/admin/api/tracks, moves every track to the trash
+*/
+func HandlerAdminTrack(w http.ResponseWriter, r *http.Request) {
+	tracks, err := db.GetAll()
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the tracks")
+		return
+	}
 
-		default:
-			statusCode := http.StatusNotImplemented
-			http.Error(w, http.StatusText(statusCode), statusCode)
-		}
+	deletedAt := time.Now().Unix()
+	countDeleted := db.DeleteAll(deletedAt)
+	for i := range tracks {
+		tracks[i].DeletedAt = deletedAt
+	}
+	events.Publish(TracksDeleted{Tracks: tracks})
 
-	case 2:
-		HandlerWebhookID(w, r)
+	w.Header().Set("content-type", "text/plain")
+	fmt.Fprintln(w, "Deleted tracks:", countDeleted)
+}
 
-	default:
-		statusCode := http.StatusBadRequest
-		http.Error(w, http.StatusText(statusCode), statusCode)
+/*
+HandlerAdminTrash handles GET /paragliding/admin/api/trash, the deleted tracks paged
+*/
+func HandlerAdminTrash(w http.ResponseWriter, r *http.Request) {
+	page, err := ParsePageRequest(r.URL.Query(), DefaultPageLimit, "id")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
 	}
+
+	tracks, next, err := db.FindPage(TrackFilter{Deleted: true}, page)
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the deleted tracks")
+		return
+	}
+
+	trashed := []TrashedTrack{}
+	for _, track := range tracks {
+		trashed = append(trashed, TrashedTrack{ID: track.ID, TrackInfo: track})
+	}
+
+	SetLinkHeader(w, r, next)
+	writeJSON(w, r, http.StatusOK, trashed)
 }
 
 /*
-HandlerWebhookID handles /webhook/new_track/<webhook_id>
+HandlerAdminTrashEmpty handles DELETE /paragliding/admin/api/trash, purges every deleted track
 */
-func HandlerWebhookID(w http.ResponseWriter, r *http.Request) {
-	parts := RemoveEmpty(strings.Split(r.URL.Path, "/"))
-	parts = parts[4:]
+func HandlerAdminTrashEmpty(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/plain")
+	fmt.Fprintln(w, "Purged tracks:", PurgeTrash(time.Now().Unix()))
+}
 
-	ID, err := strconv.Atoi(parts[0])
+// getTrashedTrack returns the deleted track with the ID in the path, and writes an error if it can't be retrieved
+func getTrashedTrack(w http.ResponseWriter, r *http.Request) (TrackInfo, bool) {
+	ID := PathInt(r, "id")
+	tracks, err := db.Find(TrackFilter{ID: &ID, Deleted: true})
 	if err != nil {
-		http.Error(w, "Invalid ID type given", http.StatusBadRequest)
+		internalError(w, r, "Couldn't retrieve the deleted track")
+		return TrackInfo{}, false
+	}
+	if len(tracks) == 0 {
+		notFound(w, r, "Invalid ID given")
+		return TrackInfo{}, false
+	}
+
+	return tracks[0], true
+}
+
+/*
+HandlerAdminTrashTrack handles GET /paragliding/admin/api/trash/<id>
+*/
+func HandlerAdminTrashTrack(w http.ResponseWriter, r *http.Request) {
+	track, found := getTrashedTrack(w, r)
+	if !found {
 		return
 	}
 
-	switch r.Method {
-	case http.MethodGet:
-		wh := webhookDB.Get(ID)
-		json.NewEncoder(w).Encode(wh)
+	writeJSON(w, r, http.StatusOK, TrashedTrack{ID: track.ID, TrackInfo: track})
+}
 
-	case http.MethodDelete:
-		wh := webhookDB.Delete(ID)
-		json.NewEncoder(w).Encode(wh)
+/*
+HandlerAdminTrashRestore handles POST /paragliding/admin/api/trash/<id>/restore
+*/
+func HandlerAdminTrashRestore(w http.ResponseWriter, r *http.Request) {
+	track, found := getTrashedTrack(w, r)
+	if !found {
+		return
+	}
 
-	default:
-		statusCode := http.StatusNotImplemented
-		http.Error(w, http.StatusText(statusCode), statusCode)
+	if !db.Restore(track.ID) {
+		internalError(w, r, "Couldn't restore the track")
+		return
 	}
+	track.DeletedAt = 0
+	auditDB.Add(NewAuditEntry(track.ID, AuditRestore, nil))
+	events.Publish(TrackRestored{Track: track})
+
+	writeJSON(w, r, http.StatusOK, TrashedTrack{ID: track.ID, TrackInfo: track})
 }
 
 /*
-HandlerAdminTrackCount handles /paragliding/admin/api/tracks_count/
+HandlerAdminKeys handles GET /paragliding/admin/api/keys, the keys without the keys themselves
 */
-func HandlerAdminTrackCount(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		w.Header().Set("content-type", "text/plain")
-		fmt.Fprintln(w, db.Count())
-
-	default:
-		statusCode := http.StatusNotImplemented
-		http.Error(w, http.StatusText(statusCode), statusCode)
+func HandlerAdminKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := keyDB.GetAll()
+	if err != nil {
+		internalError(w, r, "Couldn't retrieve the keys")
+		return
 	}
+
+	writeJSON(w, r, http.StatusOK, keys)
 }
 
 /*
-HandlerAdminTrack handles /paragliding/admin/api/tracks/
+HandlerAdminKeyAdd handles POST /paragliding/admin/api/keys, creates a key given as {"name": .., "role": ..}
 */
-func HandlerAdminTrack(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodDelete:
-		w.Header().Set("content-type", "text/plain")
-		countDeleted := db.DeleteAll()
-		fmt.Fprintln(w, "Deleted tracks:", countDeleted)
+func HandlerAdminKeyAdd(w http.ResponseWriter, r *http.Request) {
+	var request APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Name == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid key given, has to have a name and a role")
+		return
+	}
 
-	default:
-		statusCode := http.StatusNotImplemented
-		http.Error(w, http.StatusText(statusCode), statusCode)
+	apiKey, key, err := NewAPIKey(request.Name, request.Role)
+	if err == ErrInvalidRole {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	}
+	if err != nil || !keyDB.Add(apiKey) {
+		internalError(w, r, "Couldn't create the key")
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, CreatedAPIKey{apiKey, key})
+}
+
+/*
+HandlerAdminKeyRevoke handles DELETE /paragliding/admin/api/keys/<id>
+*/
+func HandlerAdminKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	if !keyDB.Revoke(PathParam(r, "id"), time.Now().Unix()) {
+		notFound(w, r, "Invalid ID given")
+		return
 	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -4,15 +4,27 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"net/http"
+	"sync"
 	"time"
+
+	igc "github.com/marni/goigc"
 )
 
 var (
-	startTime time.Time
-	nextID    int
-	nextWBID  int
+	startTime     time.Time
+	nextID        int
+	nextWBID      int
+	webhookClient = &http.Client{Timeout: 10 * time.Second}
+	discord       = DiscordNotifier{URL: discordWebhookURL, Client: webhookClient}
+
+	// The webhooks are called by a few workers from a queue, with the same protection against internal addresses as the fetcher
+	webhookSender = &Fetcher{ConnectTimeout: 5 * time.Second, ReadTimeout: 10 * time.Second}
+	webhookQueue  = make(chan webhookDelivery, 256)
+)
+
+const (
+	webhookWorkers = 4
 )
 
 const (
@@ -23,6 +35,8 @@ func init() {
 	startTime = time.Now()
 	nextID = db.GetLastID() + 1
 	nextWBID = webhookDB.GetLastID() + 1
+	nextSiteID = Max(siteDB.GetLastID()+1, 1) // Site ID 0 is used for tracks without a site
+	BackfillGliderKeys()
 }
 
 /*
@@ -38,24 +52,108 @@ type APIInfo struct {
 TrackInfo contains meta data about a track, including its source url and database ID
 */
 type TrackInfo struct {
-	HDate          time.Time `json:"H_date"`
-	Pilot          string    `json:"pilot"`
-	Glider         string    `json:"glider"`
-	GliderID       string    `json:"glider_id"`
-	TrackLength    float64   `json:"track_length"`
-	TrackSourceURL string    `json:"track_src_url"`
-	ID             int       `json:"-"`
-	Timestamp      int64     `json:"-"`
+	HDate           time.Time `json:"H_date"`
+	Pilot           string    `json:"pilot"`
+	Glider          string    `json:"glider"`
+	GliderID        string    `json:"glider_id"`
+	TrackLength     float64   `json:"track_length"`
+	TrackSourceURL  string    `json:"track_src_url"`
+	SignatureStatus string    `json:"signature_status"`
+	SiteID          int       `json:"site_id"`
+	PilotID         string    `json:"pilot_id"`
+	GliderKey       string    `json:"-"`                                      // The normalized glider ID, the ID of the glider in the registry
+	DeletedAt       int64     `json:"deleted_at,omitempty" bson:",omitempty"` // Unix time, deleted tracks are kept in the trash until purged
+	ID              int       `json:"-"`
+	Timestamp       int64     `json:"-"`
+	Revision        int       `json:"-"`
+	ContentHash     string    `json:"-"`
+	ETag            string    `json:"-"`
+	LastModified    string    `json:"-"`
+	Airtime         int64     `json:"-"` // Seconds
+	Score           float64   `json:"-"` // Free distance in km, see ScoreTrack
+
+	Start *GeoJSONPoint      `json:"-" bson:",omitempty"` // Tracks without points have no geometry, which the 2dsphere index doesn't accept
+	End   *GeoJSONPoint      `json:"-" bson:",omitempty"`
+	Path  *GeoJSONLineString `json:"-" bson:",omitempty"`
+}
+
+/*
+TrackRevision is a stored version of a track, a new revision is made every time the
+file at the source URL changes
+*/
+type TrackRevision struct {
+	TrackID     int       `json:"track_id"`
+	Revision    int       `json:"revision"`
+	ContentHash string    `json:"content_hash"`
+	Timestamp   int64     `json:"timestamp"`
+	Track       TrackInfo `json:"track"`
+}
+
+/*
+TrackURL is the body of requests adding a track from a URL
+*/
+type TrackURL struct {
+	URL string `json:"url"`
+}
+
+/*
+Ticker is a page of the tracks in the order they were added, with the timestamps of the page
+*/
+type Ticker struct {
+	TLatest    int64 `json:"t_latest"`
+	TStart     int64 `json:"t_start"`
+	TStop      int64 `json:"t_stop"`
+	Tracks     []int `json:"tracks"`
+	Processing int64 `json:"processing"`
 }
 
 /*
-Webhook contains the URL and minimum trigger value for a webhook
+WebhookEventTypes are the events webhooks can opt in to, besides the added tracks every webhook gets
+*/
+var WebhookEventTypes = []string{EventTrackUpdated, EventTrackDeleted, EventTrackRestored}
+
+/*
+Webhook contains the URL and minimum trigger value for a webhook. It's called every MinTriggerValue added tracks,
+and for the events in Events
 */
 type Webhook struct {
-	URL             string `json:"webhookURL"`
-	MinTriggerValue int    `json:"minTriggerValue"`
-	ID              int    `json:"-"`
-	Timestamp       int64  `json:"-"`
+	URL             string   `json:"webhookURL"`
+	MinTriggerValue int      `json:"minTriggerValue"`
+	Events          []string `json:"events,omitempty"`
+	ID              int      `json:"-"`
+	Timestamp       int64    `json:"-"`
+	Owner           string   `json:"-"` // ID of the API key that registered the webhook
+}
+
+/*
+Subscribed returns if the webhook opted in to the event
+*/
+func (wh Webhook) Subscribed(event string) bool {
+	return containsString(wh.Events, event)
+}
+
+/*
+NewTrackInfo creates the track information for a parsed track, the ID and timestamp are not set
+*/
+func NewTrackInfo(parsedTrack igc.Track, url string) TrackInfo {
+	track := TrackInfo{
+		HDate:          parsedTrack.Date,
+		Pilot:          parsedTrack.Pilot,
+		Glider:         parsedTrack.GliderType,
+		GliderID:       parsedTrack.GliderID,
+		TrackSourceURL: url,
+		PilotID:        PilotID(parsedTrack.Pilot),
+		GliderKey:      NormalizeGliderID(parsedTrack.GliderID),
+	}
+
+	if len(parsedTrack.Points) >= 2 {
+		parsedTrack.Task.Start = parsedTrack.Points[0] // Set the points of the track
+		parsedTrack.Task.Finish = parsedTrack.Points[len(parsedTrack.Points)-1]
+		parsedTrack.Task.Turnpoints = parsedTrack.Points[1 : len(parsedTrack.Points)-1] // [from, including : to, not including]
+		track.TrackLength = parsedTrack.Task.Distance()
+	}
+
+	return track
 }
 
 /*
@@ -89,54 +187,204 @@ func RemoveEmpty(arr []string) []string {
 }
 
 /*
-ClockTrigger checks every 10 minutes if the number of tracks has changed, and notifies if it has
+DiscordNotifier posts a message to a Discord channel for the added, deleted and restored tracks
+and the registered webhooks
 */
-func ClockTrigger() {
-	delay := time.Minute * 1
-	previousTrackNum := db.Count()
+type DiscordNotifier struct {
+	URL    string
+	Client *http.Client
+}
 
-	for {
-		if previousTrackNum != db.Count() {
-			previousTrackNum = db.Count()
-			NotifyDiscord()
-		} else if rand.Intn(10) == 1 { // This probably should be seeded, but who cares really
-			SendNotificationAnyway()
-		}
+/*
+Notify posts the message of the event, events without a message are ignored
+*/
+func (d DiscordNotifier) Notify(event Event) {
+	message := discordMessage(event)
+	if message == "" {
+		return
+	}
 
-		time.Sleep(delay)
+	raw, _ := json.Marshal(map[string]string{"content": message})
+	resp, err := d.Client.Post(d.URL, "application/json", bytes.NewBuffer(raw))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
 	}
+	resp.Body.Close()
+}
 
+// discordMessage returns the message posted to Discord for the event, or "" if none is posted
+func discordMessage(event Event) string {
+	switch e := event.(type) {
+	case TrackAdded:
+		return fmt.Sprintf("Track %d was added: %s flying a %s, %.1f km\n", e.Track.ID, e.Track.Pilot, e.Track.Glider, e.Track.TrackLength)
+	case TrackDeleted:
+		return fmt.Sprintf("Track %d was deleted\n", e.Track.ID)
+	case TracksDeleted:
+		return fmt.Sprintf("Every track was deleted, %d in total\n", len(e.Tracks))
+	case TrackRestored:
+		return fmt.Sprintf("Track %d was restored\n", e.Track.ID)
+	case WebhookRegistered:
+		return fmt.Sprintf("Webhook %d was registered\n", e.Webhook.ID)
+	}
+
+	return ""
 }
 
 /*
-NotifyDiscord sends an update to a discord channel
+WebhookEvent is sent to the registered webhooks. Added tracks are sent once MinTriggerValue tracks have been added,
+with the IDs of all of them in Tracks and the last of them in Track. Edited, deleted and restored tracks are sent
+to the webhooks that opted in to the event
 */
-func NotifyDiscord() {
-	content := make(map[string]string)
-	content["content"] = "There has been an update to the database!\n"
-	raw, _ := json.Marshal(content)
+type WebhookEvent struct {
+	Event   string     `json:"event"`
+	TrackID int        `json:"track_id"`
+	Track   *TrackInfo `json:"track,omitempty"`  // The track after the change, not set for deletions
+	Tracks  []int      `json:"tracks,omitempty"` // The added tracks
+}
 
-	_, err := http.Post(discordWebhookURL, "application/json", bytes.NewBuffer(raw))
+// webhookDelivery is a webhook event to send to a URL
+type webhookDelivery struct {
+	URL   string
+	Event WebhookEvent
+}
+
+// webhookBatches holds the tracks added since each webhook was last called. It's kept in memory,
+// so the tracks of batches that weren't full are lost on restarts
+type webhookBatches struct {
+	mutex   sync.Mutex
+	pending map[int][]int // The track IDs by webhook ID
+}
+
+var batches = &webhookBatches{}
+
+/*
+DispatchWebhooks is the subscriber that sends the added, updated, deleted and restored tracks to the registered webhooks
+*/
+func DispatchWebhooks(event Event) {
+	if e, ok := event.(WebhookDeleted); ok {
+		batches.forget(e.Webhook.ID)
+		return
+	}
+
+	webhookEvents := webhookEvents(event)
+	if len(webhookEvents) == 0 {
+		return
+	}
+
+	webhooks, err := webhookDB.GetAll()
 	if err != nil {
-		fmt.Println(err.Error())
+		fmt.Println("Couldn't retrieve the webhooks:", err.Error())
+		return
+	}
+
+	for _, webhookEvent := range webhookEvents {
+		NotifyWebhooks(batches.deliveries(webhookEvent, webhooks))
+	}
+}
+
+// webhookEvents returns what is sent to the webhooks for the event, one per changed track
+func webhookEvents(event Event) []WebhookEvent {
+	switch e := event.(type) {
+	case TrackAdded:
+		return []WebhookEvent{{Event: EventTrackAdded, TrackID: e.Track.ID, Track: &e.Track}}
+	case TrackUpdated:
+		return []WebhookEvent{{Event: EventTrackUpdated, TrackID: e.After.ID, Track: &e.After}}
+	case TrackRestored:
+		return []WebhookEvent{{Event: EventTrackRestored, TrackID: e.Track.ID, Track: &e.Track}}
+	case TrackDeleted:
+		return []WebhookEvent{{Event: EventTrackDeleted, TrackID: e.Track.ID}}
+	case TracksDeleted:
+		deleted := []WebhookEvent{}
+		for _, track := range e.Tracks {
+			deleted = append(deleted, WebhookEvent{Event: EventTrackDeleted, TrackID: track.ID})
+		}
+		return deleted
+	}
+
+	return nil
+}
+
+// deliveries returns what is sent to each of the webhooks for the event. Added tracks are counted for every
+// webhook, and sent when the webhook has MinTriggerValue of them. Other events only go to the webhooks that opted in
+func (b *webhookBatches) deliveries(event WebhookEvent, webhooks []Webhook) []webhookDelivery {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.pending == nil {
+		b.pending = make(map[int][]int)
+	}
+
+	deliveries := []webhookDelivery{}
+	for _, wh := range webhooks {
+		if event.Event != EventTrackAdded {
+			if wh.Subscribed(event.Event) {
+				deliveries = append(deliveries, webhookDelivery{URL: wh.URL, Event: event})
+			}
+			continue
+		}
+
+		b.pending[wh.ID] = append(b.pending[wh.ID], event.TrackID)
+		if len(b.pending[wh.ID]) >= Max(wh.MinTriggerValue, 1) {
+			batch := event
+			batch.Tracks = b.pending[wh.ID]
+			deliveries = append(deliveries, webhookDelivery{URL: wh.URL, Event: batch})
+			delete(b.pending, wh.ID)
+		}
 	}
+
+	return deliveries
+}
+
+// forget removes the added tracks counted for a deleted webhook
+func (b *webhookBatches) forget(webhookID int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.pending, webhookID)
 }
 
 /*
-SendNotificationAnyway sends a notification to the discord server even if no
-update has happened, because everyone deserves love sometimes
+NotifyWebhooks queues the events for the webhook workers, without waiting for them to be sent.
+Events that don't fit in the queue are dropped
 */
-func SendNotificationAnyway() {
-	content := make(map[string]string)
-	content["content"] = "Sadly, no update. But hey, you deserve to be loved anyways!\n"
-	raw, _ := json.Marshal(content)
+func NotifyWebhooks(deliveries []webhookDelivery) {
+	for _, delivery := range deliveries {
+		select {
+		case webhookQueue <- delivery:
+		default:
+			fmt.Printf("The webhook queue is full, %s of track %d to %s was dropped\n", delivery.Event.Event, delivery.Event.TrackID, delivery.URL)
+		}
+	}
+}
 
-	_, err := http.Post(discordWebhookURL, "application/json", bytes.NewBuffer(raw))
-	if err != nil {
-		fmt.Println(err.Error())
+/*
+SendWebhooks is a webhook worker, it sends the queued events until the queue is closed
+*/
+func SendWebhooks(queue <-chan webhookDelivery) {
+	for delivery := range queue {
+		if err := sendWebhook(webhookSender, delivery); err != nil {
+			fmt.Printf("Couldn't call the webhook %s: %s\n", delivery.URL, err.Error())
+		}
 	}
 }
 
+// sendWebhook posts the event of the delivery to its URL
+func sendWebhook(sender *Fetcher, delivery webhookDelivery) error {
+	raw, _ := json.Marshal(delivery.Event)
+	return sender.Post(delivery.URL, "application/json", bytes.NewBuffer(raw))
+}
+
+/*
+Max returns the largest value of a and b
+*/
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 /*
 Min returns the smallest value of a and b
 */
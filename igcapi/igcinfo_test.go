@@ -4,17 +4,20 @@ Tests the general functions of the API
 package igcapi
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
 
 // Tests that the same track cannot be added two times
 func Test_trackAlreadyAdded(t *testing.T) {
-	testServer := httptest.NewServer(http.HandlerFunc(HandlerTrack))
+	testServer := httptest.NewServer(NewRouter())
 	defer testServer.Close()
 
 	// Post a url to the server
@@ -62,3 +65,198 @@ func Test_removeEmpty(t *testing.T) {
 		}
 	}
 }
+
+// Tests the events sent to the webhooks for the events of the bus
+func Test_webhookEvents(t *testing.T) {
+	track := TrackInfo{ID: 1, Pilot: "John Doe"}
+
+	updated := webhookEvents(TrackUpdated{Before: TrackInfo{ID: 1}, After: track})
+	if len(updated) != 1 || updated[0].Event != EventTrackUpdated || updated[0].Track == nil || updated[0].Track.Pilot != "John Doe" {
+		t.Errorf("Expected track_updated with the track after the change, got %+v", updated)
+	}
+
+	deleted := webhookEvents(TracksDeleted{Tracks: []TrackInfo{{ID: 1}, {ID: 2}}})
+	if len(deleted) != 2 || deleted[1].Event != EventTrackDeleted || deleted[1].TrackID != 2 || deleted[1].Track != nil {
+		t.Errorf("Expected track_deleted without the track for both tracks, got %+v", deleted)
+	}
+
+	added := webhookEvents(TrackAdded{Track: track})
+	if len(added) != 1 || added[0].Event != EventTrackAdded || added[0].TrackID != 1 {
+		t.Errorf("Expected track_added with the track, got %+v", added)
+	}
+
+	if jobs := webhookEvents(JobStatus{Job: FetchJob{Status: JobFetched}, TrackID: 1}); len(jobs) != 0 {
+		t.Errorf("Jobs shouldn't be sent to the webhooks, got %+v", jobs)
+	}
+}
+
+// Tests that added tracks are sent every minTriggerValue tracks, and the other events only to the webhooks that opted in
+func Test_webhookBatches(t *testing.T) {
+	webhooks := []Webhook{
+		{ID: 1, URL: "http://example.com/every", MinTriggerValue: 1},
+		{ID: 2, URL: "http://example.com/third", MinTriggerValue: 3, Events: []string{EventTrackDeleted}},
+	}
+	b := &webhookBatches{}
+
+	urls := func(deliveries []webhookDelivery) []string {
+		sent := []string{}
+		for _, delivery := range deliveries {
+			sent = append(sent, delivery.URL)
+		}
+		return sent
+	}
+
+	for id := 1; id <= 3; id++ {
+		deliveries := b.deliveries(WebhookEvent{Event: EventTrackAdded, TrackID: id}, webhooks)
+		expected := []string{"http://example.com/every"}
+		if id == 3 {
+			expected = append(expected, "http://example.com/third")
+		}
+		if !reflect.DeepEqual(urls(deliveries), expected) {
+			t.Errorf("Track %d: expected the webhooks %v, got %v", id, expected, urls(deliveries))
+		}
+		if id == 3 && !reflect.DeepEqual(deliveries[1].Event.Tracks, []int{1, 2, 3}) {
+			t.Errorf("Expected the tracks [1 2 3], got %v", deliveries[1].Event.Tracks)
+		}
+	}
+
+	if deliveries := b.deliveries(WebhookEvent{Event: EventTrackDeleted, TrackID: 1}, webhooks); !reflect.DeepEqual(urls(deliveries), []string{"http://example.com/third"}) {
+		t.Errorf("Expected the deletion to go to the webhook that opted in, got %v", urls(deliveries))
+	}
+	if deliveries := b.deliveries(WebhookEvent{Event: EventTrackUpdated, TrackID: 1}, webhooks); len(deliveries) != 0 {
+		t.Errorf("Expected no webhook to get the update, got %v", urls(deliveries))
+	}
+
+	b.deliveries(WebhookEvent{Event: EventTrackAdded, TrackID: 4}, webhooks)
+	b.forget(2) // Deleted webhooks start over
+	if len(b.pending[2]) != 0 {
+		t.Errorf("Expected the tracks of the deleted webhook to be forgotten, got %v", b.pending[2])
+	}
+}
+
+// Tests that webhooks can only be deleted by the key that registered them and by admins
+func Test_handlerWebhookDelete_owner(t *testing.T) {
+	defer func(webhooks WebhookStorage, keys APIKeyStorage, id int) {
+		webhookDB, keyDB, nextWBID = webhooks, keys, id
+	}(webhookDB, keyDB, nextWBID)
+	memoryDB, keys := authTestKeys(t)
+	otherKey, other, err := NewAPIKey("other uploader key", RoleUploader)
+	if err != nil {
+		t.Fatalf("Couldn't create a key: %s", err)
+	}
+	memoryDB.Add(otherKey)
+	keyDB = memoryDB
+	webhookDB = &WebhookMemoryDB{}
+
+	request := func(method, path, key, body string) int {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		NewRouter().ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		body := fmt.Sprintf(`{"webhookURL": "http://example.com/%d"}`, i)
+		if code := request(http.MethodPost, "/paragliding/api/webhook/new_track", keys[RoleUploader], body); code != http.StatusCreated {
+			t.Fatalf("Expected the webhook to be registered, got %d", code)
+		}
+	}
+	webhooks, _ := webhookDB.GetAll()
+	if len(webhooks) != 2 || webhooks[0].Owner == "" || webhooks[0].Owner == otherKey.ID {
+		t.Fatalf("Expected the webhooks to be owned by the uploader key, got %+v", webhooks)
+	}
+
+	first := fmt.Sprintf("/paragliding/api/webhook/new_track/%d", webhooks[0].ID)
+	second := fmt.Sprintf("/paragliding/api/webhook/new_track/%d", webhooks[1].ID)
+	if code := request(http.MethodDelete, first, other, ""); code != http.StatusForbidden {
+		t.Errorf("Expected another uploader key to get 403, got %d", code)
+	}
+	if code := request(http.MethodDelete, first, keys[RoleUploader], ""); code != http.StatusOK {
+		t.Errorf("Expected the key that registered the webhook to delete it, got %d", code)
+	}
+	if code := request(http.MethodDelete, second, keys[RoleAdmin], ""); code != http.StatusOK {
+		t.Errorf("Expected an admin to delete the webhook, got %d", code)
+	}
+	if left, _ := webhookDB.GetAll(); len(left) != 0 {
+		t.Errorf("Expected both webhooks to be deleted, got %+v", left)
+	}
+}
+
+// Tests that the Discord notifier posts a message for the events that have one
+func Test_discordNotifier(t *testing.T) {
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		messages = append(messages, body["content"])
+	}))
+	defer server.Close()
+
+	notifier := DiscordNotifier{URL: server.URL, Client: server.Client()}
+	notifier.Notify(TrackAdded{Track: TrackInfo{ID: 4, Pilot: "John Doe", Glider: "Ozone Rush 5", TrackLength: 42.25}})
+	notifier.Notify(JobStatus{Job: FetchJob{Status: JobFetching}}) // No message
+	notifier.Notify(TracksDeleted{Tracks: []TrackInfo{{ID: 1}, {ID: 2}}})
+
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %v", messages)
+	}
+	if !strings.Contains(messages[0], "Track 4") || !strings.Contains(messages[0], "John Doe") || !strings.Contains(messages[0], "42.2 km") {
+		t.Errorf("Expected the added track in the message, got '%s'", messages[0])
+	}
+	if !strings.Contains(messages[1], "2 in total") {
+		t.Errorf("Expected the deleted tracks in the message, got '%s'", messages[1])
+	}
+}
+
+// Tests that webhooks are posted to, but not on internal addresses
+func Test_sendWebhook(t *testing.T) {
+	var received WebhookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	delivery := webhookDelivery{URL: server.URL, Event: WebhookEvent{Event: EventTrackDeleted, TrackID: 3}}
+	if err := sendWebhook(&Fetcher{ConnectTimeout: time.Second, ReadTimeout: time.Second}, delivery); err == nil || !strings.Contains(err.Error(), ErrPrivateAddress.Error()) {
+		t.Errorf("Expected the loopback address to be refused, got %v", err)
+	}
+	for _, url := range []string{"http://169.254.169.254/latest/meta-data", "file:///etc/passwd"} {
+		if err := sendWebhook(&Fetcher{}, webhookDelivery{URL: url}); err == nil {
+			t.Errorf("%s was posted to", url)
+		}
+	}
+
+	if err := sendWebhook(newTestFetcher(), delivery); err != nil || received.TrackID != 3 {
+		t.Errorf("Expected the event to be received, got %+v (error: %v)", received, err)
+	}
+}
+
+// Tests that the workers send the queued events, and that a full queue drops events instead of blocking
+func Test_notifyWebhooks(t *testing.T) {
+	defer func(sender *Fetcher) { webhookSender = sender }(webhookSender)
+	webhookSender = newTestFetcher()
+
+	received := make(chan int, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event WebhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event.TrackID
+	}))
+	defer server.Close()
+
+	queue := make(chan webhookDelivery, 1)
+	defer func(q chan webhookDelivery) { webhookQueue = q }(webhookQueue)
+	webhookQueue = queue
+
+	NotifyWebhooks([]webhookDelivery{{URL: server.URL, Event: WebhookEvent{TrackID: 1}}, {URL: server.URL, Event: WebhookEvent{TrackID: 2}}})
+	if len(queue) != 1 {
+		t.Fatalf("Expected 1 queued event, got %d", len(queue))
+	}
+
+	close(queue)
+	SendWebhooks(queue)
+	if id := <-received; id != 1 || len(received) != 0 {
+		t.Errorf("Expected only the track 1 to be sent, got %d", id)
+	}
+}
@@ -0,0 +1,241 @@
+package igcapi
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBestFlights    = 6   // The amount of flights counted for each pilot, unless LEADERBOARD_BEST_FLIGHTS is set
+	maxCachedLeaderboards = 100 // The least recently used leaderboards are removed from the cache above this
+)
+
+/*
+The metrics a leaderboard can rank by
+*/
+const (
+	MetricScore    = "score"    // Free distance in km
+	MetricDistance = "distance" // Track length in km
+	MetricAirtime  = "airtime"  // Seconds
+)
+
+var (
+	leaderboardBestFlights = defaultBestFlights // 0 counts every flight
+	leaderboardCache       = make(map[LeaderboardQuery]Leaderboard)
+	leaderboardUsed        []LeaderboardQuery // The cached queries, least recently used first
+	leaderboardGeneration  int                // Incremented by InvalidateLeaderboards
+	leaderboardMutex       sync.Mutex
+)
+
+/*
+LeaderboardQuery selects the flights of a leaderboard. A site of 0 and an empty class means every site and class
+*/
+type LeaderboardQuery struct {
+	Season int    `json:"season"`
+	SiteID int    `json:"site"`
+	Class  string `json:"class"`
+	Metric string `json:"metric"`
+}
+
+/*
+LeaderboardEntry is the result of a pilot, Flights are the IDs of the counted tracks
+*/
+type LeaderboardEntry struct {
+	Rank    int     `json:"rank"`
+	PilotID string  `json:"pilot_id"`
+	Name    string  `json:"name"`
+	Total   float64 `json:"total"`
+	Flights []int   `json:"flights"`
+}
+
+/*
+Leaderboard is a ranking of pilots
+*/
+type Leaderboard struct {
+	LeaderboardQuery
+	BestFlights int                `json:"best_flights"`
+	Entries     []LeaderboardEntry `json:"entries"`
+}
+
+/*
+ParseLeaderboardQuery creates a leaderboard query from the query parameters season, site, class and metric.
+The default season is the current year, and the default metric is score
+*/
+func ParseLeaderboardQuery(query url.Values) (LeaderboardQuery, error) {
+	q := LeaderboardQuery{Season: time.Now().UTC().Year(), Metric: MetricScore}
+
+	var err error
+	if param := query.Get("season"); param != "" {
+		if q.Season, err = strconv.Atoi(param); err != nil || q.Season < 1 {
+			return q, fmt.Errorf("invalid 'season' given")
+		}
+	}
+	if param := query.Get("site"); param != "" {
+		if q.SiteID, err = strconv.Atoi(param); err != nil || q.SiteID < 1 {
+			return q, fmt.Errorf("invalid 'site' given")
+		}
+	}
+
+	var ok bool
+	if q.Class, ok = NormalizeGliderClass(query.Get("class")); !ok {
+		return q, fmt.Errorf("invalid 'class' given, has to be one of %s", strings.Join(GliderClasses, ", "))
+	}
+
+	if param := query.Get("metric"); param != "" {
+		switch param {
+		case MetricScore, MetricDistance, MetricAirtime:
+			q.Metric = param
+		default:
+			return q, fmt.Errorf("invalid 'metric' given, has to be score, distance or airtime")
+		}
+	}
+
+	return q, nil
+}
+
+/*
+Filter returns the track filter of the season and site of the query, the class has to be checked separately
+*/
+func (q LeaderboardQuery) Filter() TrackFilter {
+	return TrackFilter{
+		From:   time.Date(q.Season, time.January, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(q.Season, time.December, 31, 23, 59, 59, 0, time.UTC),
+		SiteID: q.SiteID,
+	}
+}
+
+/*
+CalculateLeaderboard ranks the pilots of the tracks by the sum of their best flights. The gliders
+are the gliders of the query's class, tracks with other gliders aren't counted when a class is given.
+Pilots with the same total share a rank
+*/
+func CalculateLeaderboard(q LeaderboardQuery, tracks []TrackInfo, gliders []Glider, bestFlights int) Leaderboard {
+	classGliders := make(map[string]bool)
+	for _, glider := range gliders {
+		classGliders[glider.ID] = true
+	}
+
+	pilotTracks := make(map[string][]TrackInfo)
+	for _, track := range tracks {
+		if track.PilotID == "" || (q.Class != "" && !classGliders[NormalizeGliderID(track.GliderID)]) {
+			continue
+		}
+		pilotTracks[track.PilotID] = append(pilotTracks[track.PilotID], track)
+	}
+
+	entries := []LeaderboardEntry{}
+	for pilotID, flights := range pilotTracks {
+		sort.SliceStable(flights, func(i, j int) bool {
+			return metricValue(flights[i], q.Metric) > metricValue(flights[j], q.Metric)
+		})
+		if bestFlights > 0 && len(flights) > bestFlights {
+			flights = flights[:bestFlights]
+		}
+
+		entry := LeaderboardEntry{PilotID: pilotID, Name: strings.Join(strings.Fields(flights[0].Pilot), " "), Flights: []int{}}
+		for _, flight := range flights {
+			entry.Total += metricValue(flight, q.Metric)
+			entry.Flights = append(entry.Flights, flight.ID)
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Total != entries[j].Total {
+			return entries[i].Total > entries[j].Total
+		}
+		return entries[i].PilotID < entries[j].PilotID
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Total == entries[i-1].Total {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+
+	return Leaderboard{LeaderboardQuery: q, BestFlights: bestFlights, Entries: entries}
+}
+
+/*
+GetLeaderboard returns the leaderboard of the query, from the cache if it has been calculated since the tracks last changed.
+The lock isn't held while calculating, so other leaderboards can be served meanwhile
+*/
+func GetLeaderboard(q LeaderboardQuery) (Leaderboard, error) {
+	leaderboardMutex.Lock()
+	if leaderboard, ok := leaderboardCache[q]; ok {
+		useLeaderboard(q)
+		leaderboardMutex.Unlock()
+		return leaderboard, nil
+	}
+	generation := leaderboardGeneration
+	leaderboardMutex.Unlock()
+
+	tracks, err := db.Find(q.Filter())
+	if err != nil {
+		return Leaderboard{}, err
+	}
+
+	gliders := []Glider{}
+	if q.Class != "" {
+		if gliders, err = gliderDB.GetAll(q.Class); err != nil {
+			return Leaderboard{}, err
+		}
+	}
+
+	leaderboard := CalculateLeaderboard(q, tracks, gliders, leaderboardBestFlights)
+
+	leaderboardMutex.Lock()
+	defer leaderboardMutex.Unlock()
+
+	if generation == leaderboardGeneration { // Leaderboards calculated before the tracks changed aren't cached
+		if _, ok := leaderboardCache[q]; !ok && len(leaderboardCache) >= maxCachedLeaderboards {
+			delete(leaderboardCache, leaderboardUsed[0])
+			leaderboardUsed = leaderboardUsed[1:]
+		}
+		leaderboardCache[q] = leaderboard
+		useLeaderboard(q)
+	}
+
+	return leaderboard, nil
+}
+
+// useLeaderboard marks the cached leaderboard of the query as the most recently used. The lock has to be held
+func useLeaderboard(q LeaderboardQuery) {
+	for i, used := range leaderboardUsed {
+		if used == q {
+			leaderboardUsed = append(leaderboardUsed[:i], leaderboardUsed[i+1:]...)
+			break
+		}
+	}
+	leaderboardUsed = append(leaderboardUsed, q)
+}
+
+/*
+InvalidateLeaderboards empties the leaderboard cache, it has to be called when tracks are added, changed or
+deleted, and when the class of a glider changes
+*/
+func InvalidateLeaderboards() {
+	leaderboardMutex.Lock()
+	defer leaderboardMutex.Unlock()
+
+	leaderboardCache = make(map[LeaderboardQuery]Leaderboard)
+	leaderboardUsed = nil
+	leaderboardGeneration++
+}
+
+// metricValue returns the value of the track that's ranked by the metric
+func metricValue(t TrackInfo, metric string) float64 {
+	switch metric {
+	case MetricDistance:
+		return t.TrackLength
+	case MetricAirtime:
+		return float64(t.Airtime)
+	default:
+		return t.Score
+	}
+}
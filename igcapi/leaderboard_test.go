@@ -0,0 +1,150 @@
+package igcapi
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// leaderboardTestTracks are tracks of three pilots in the 2026 season, and one from the season before
+var leaderboardTestTracks = func() []TrackInfo {
+	date := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	return []TrackInfo{
+		{ID: 1, Pilot: "Anna", PilotID: "anna", GliderID: "A-1", HDate: date, Score: 50, TrackLength: 60, Airtime: 3600},
+		{ID: 2, Pilot: "Anna", PilotID: "anna", GliderID: "A-1", HDate: date, Score: 30, TrackLength: 20, Airtime: 7200},
+		{ID: 3, Pilot: "Anna", PilotID: "anna", GliderID: "A-1", HDate: date, Score: 10, TrackLength: 10, Airtime: 600},
+		{ID: 4, Pilot: "Bob", PilotID: "bob", GliderID: "B-1", HDate: date, Score: 80, TrackLength: 90, Airtime: 1800},
+		{ID: 5, Pilot: "Carl", PilotID: "carl", GliderID: "C-1", HDate: date, Score: 40, TrackLength: 40, Airtime: 1200},
+		{ID: 6, Pilot: "Carl", PilotID: "carl", GliderID: "c-1", HDate: date, Score: 40, TrackLength: 40, Airtime: 1200},
+		{ID: 7, Pilot: "Bob", PilotID: "bob", GliderID: "B-1", HDate: date.AddDate(-1, 0, 0), Score: 500},
+	}
+}()
+
+// Tests ranking the pilots by the sum of their best flights
+func Test_calculateLeaderboard(t *testing.T) {
+	var tracks []TrackInfo
+	filter := LeaderboardQuery{Season: 2026}.Filter()
+	for _, track := range leaderboardTestTracks {
+		if filter.Matches(track) {
+			tracks = append(tracks, track)
+		}
+	}
+
+	leaderboard := CalculateLeaderboard(LeaderboardQuery{Season: 2026, Metric: MetricScore}, tracks, nil, 2)
+	expected := []LeaderboardEntry{
+		{Rank: 1, PilotID: "anna", Name: "Anna", Total: 80, Flights: []int{1, 2}},
+		{Rank: 1, PilotID: "bob", Name: "Bob", Total: 80, Flights: []int{4}},
+		{Rank: 1, PilotID: "carl", Name: "Carl", Total: 80, Flights: []int{5, 6}},
+	}
+	if !reflect.DeepEqual(leaderboard.Entries, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, leaderboard.Entries)
+	}
+
+	leaderboard = CalculateLeaderboard(LeaderboardQuery{Season: 2026, Metric: MetricAirtime}, tracks, nil, 0)
+	if len(leaderboard.Entries) != 3 || leaderboard.Entries[0].PilotID != "anna" || leaderboard.Entries[0].Total != 11400 ||
+		leaderboard.Entries[1].PilotID != "carl" || leaderboard.Entries[2].Rank != 3 {
+		t.Errorf("Unexpected airtime leaderboard: %+v", leaderboard.Entries)
+	}
+}
+
+// Tests that only the flights with gliders of the class are counted when a class is given
+func Test_calculateLeaderboard_class(t *testing.T) {
+	query := LeaderboardQuery{Season: 2026, Class: "EN-B", Metric: MetricDistance}
+	gliders := []Glider{{ID: "A-1", Class: "EN-B"}, {ID: "C-1", Class: "EN-B"}}
+
+	leaderboard := CalculateLeaderboard(query, leaderboardTestTracks[:6], gliders, 6)
+	if len(leaderboard.Entries) != 2 || leaderboard.Entries[0].PilotID != "anna" || leaderboard.Entries[0].Total != 90 ||
+		leaderboard.Entries[1].PilotID != "carl" || leaderboard.Entries[1].Total != 80 {
+		t.Errorf("Unexpected leaderboard: %+v", leaderboard.Entries)
+	}
+}
+
+// Tests the parameters of the leaderboard
+func Test_parseLeaderboardQuery(t *testing.T) {
+	query, _ := url.ParseQuery("season=2026&site=3&class=b&metric=distance")
+	q, err := ParseLeaderboardQuery(query)
+	if err != nil || q != (LeaderboardQuery{Season: 2026, SiteID: 3, Class: "EN-B", Metric: MetricDistance}) {
+		t.Errorf("Unexpected query %+v (error: %v)", q, err)
+	}
+
+	if q, _ = ParseLeaderboardQuery(url.Values{}); q.Season != time.Now().UTC().Year() || q.Metric != MetricScore {
+		t.Errorf("Unexpected defaults: %+v", q)
+	}
+
+	for _, rawQuery := range []string{"season=abc", "site=0", "class=EN-X", "metric=height"} {
+		query, _ := url.ParseQuery(rawQuery)
+		if _, err := ParseLeaderboardQuery(query); err == nil {
+			t.Errorf("'%s' was accepted", rawQuery)
+		}
+	}
+}
+
+// Tests that cached leaderboards are recalculated after being invalidated
+func Test_getLeaderboard_cache(t *testing.T) {
+	defer func(storage TrackStorage) { db = storage }(db)
+
+	memoryDB := testTrackDB(leaderboardTestTracks[0])
+	db = memoryDB
+	InvalidateLeaderboards()
+	query := LeaderboardQuery{Season: 2026, Metric: MetricScore}
+
+	if leaderboard, _ := GetLeaderboard(query); len(leaderboard.Entries) != 1 {
+		t.Errorf("Expected 1 entry, got %+v", leaderboard.Entries)
+	}
+
+	track := leaderboardTestTracks[3]
+	track.TrackSourceURL = "b"
+	memoryDB.Add(track)
+	if leaderboard, _ := GetLeaderboard(query); len(leaderboard.Entries) != 1 {
+		t.Errorf("Expected the cached leaderboard with 1 entry, got %+v", leaderboard.Entries)
+	}
+
+	InvalidateLeaderboards()
+	if leaderboard, _ := GetLeaderboard(query); len(leaderboard.Entries) != 2 {
+		t.Errorf("Expected 2 entries after invalidating, got %+v", leaderboard.Entries)
+	}
+}
+
+// Tests that the cache keeps the most recently used leaderboards, and that leaderboards calculated
+// while the tracks changed aren't cached
+func Test_getLeaderboard_cacheSize(t *testing.T) {
+	defer func(storage TrackStorage) { db = storage }(db)
+	db = &TrackMemoryDB{}
+	InvalidateLeaderboards()
+	defer InvalidateLeaderboards()
+
+	first := LeaderboardQuery{Season: 1, Metric: MetricScore}
+	GetLeaderboard(first)
+	for season := 2; season <= maxCachedLeaderboards+10; season++ {
+		GetLeaderboard(LeaderboardQuery{Season: season, Metric: MetricScore})
+		GetLeaderboard(first) // Kept by being used
+	}
+
+	if len(leaderboardCache) != maxCachedLeaderboards || len(leaderboardUsed) != maxCachedLeaderboards {
+		t.Errorf("Expected %d cached leaderboards, got %d (%d used)", maxCachedLeaderboards, len(leaderboardCache), len(leaderboardUsed))
+	}
+	if _, ok := leaderboardCache[first]; !ok {
+		t.Error("The most recently used leaderboard was removed")
+	}
+	if _, ok := leaderboardCache[LeaderboardQuery{Season: 2, Metric: MetricScore}]; ok {
+		t.Error("The least recently used leaderboard was kept")
+	}
+
+	stale := LeaderboardQuery{Season: 3000, Metric: MetricScore}
+	db = &invalidatingTrackStorage{TrackStorage: db}
+	GetLeaderboard(stale)
+	if _, ok := leaderboardCache[stale]; ok {
+		t.Error("A leaderboard calculated while the tracks changed was cached")
+	}
+}
+
+// invalidatingTrackStorage invalidates the leaderboards while they're calculated, like a track changing meanwhile
+type invalidatingTrackStorage struct {
+	TrackStorage
+}
+
+func (s *invalidatingTrackStorage) Find(filter TrackFilter) ([]TrackInfo, error) {
+	InvalidateLeaderboards()
+	return s.TrackStorage.Find(filter)
+}
@@ -0,0 +1,300 @@
+package igcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+The topics of the live feed. Pilots and sites are subscribed to as "pilot:<pilot ID>" and "site:<site ID>"
+*/
+const (
+	TopicTracks = "tracks" // Every added, updated, deleted and restored track
+	TopicJobs   = "jobs"   // The status of the fetches of added tracks
+	TopicPilot  = "pilot"
+	TopicSite   = "site"
+)
+
+var (
+	liveHeartbeat = 30 * time.Second // How often clients are pinged, clients that don't answer in two heartbeats are closed
+	liveBuffer    = 64               // The events a client can be behind before it's closed
+)
+
+/*
+LiveRequest is a message from a client of the live feed, subscribing to or unsubscribing from a topic
+*/
+type LiveRequest struct {
+	Action string `json:"action"` // subscribe or unsubscribe
+	Topic  string `json:"topic"`
+}
+
+/*
+LiveMessage is a message to a client of the live feed: an event from the bus, or the answer to a request
+*/
+type LiveMessage struct {
+	Event   string      `json:"event"`
+	TrackID int         `json:"track_id,omitempty"`
+	Track   interface{} `json:"track,omitempty"` // In the version of the feed
+	Job     *LiveJob    `json:"job,omitempty"`
+	Topics  []string    `json:"topics,omitempty"` // The topics after subscribing or unsubscribing
+	Error   string      `json:"error,omitempty"`
+}
+
+/*
+LiveJob is the status of a fetch job sent on the live feed. The URL and the failures are left out,
+since anyone can subscribe to the jobs, and only uploaders can see them at /track/jobs/<ID>
+*/
+type LiveJob struct {
+	ID       string `json:"id,omitempty"`
+	TrackID  int    `json:"track_id,omitempty"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+}
+
+/*
+LiveFilter is the topics a client of the live feed subscribes to
+*/
+type LiveFilter struct {
+	mutex  sync.Mutex
+	topics map[string]bool
+}
+
+/*
+NewLiveFilter creates a filter without topics
+*/
+func NewLiveFilter() *LiveFilter {
+	return &LiveFilter{topics: make(map[string]bool)}
+}
+
+/*
+Subscribe adds the topic to the filter
+*/
+func (f *LiveFilter) Subscribe(topic string) error {
+	topic, err := parseLiveTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	f.topics[topic] = true
+	f.mutex.Unlock()
+	return nil
+}
+
+/*
+Unsubscribe removes the topic from the filter
+*/
+func (f *LiveFilter) Unsubscribe(topic string) error {
+	topic, err := parseLiveTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	delete(f.topics, topic)
+	f.mutex.Unlock()
+	return nil
+}
+
+/*
+Topics returns the subscribed topics, sorted
+*/
+func (f *LiveFilter) Topics() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	topics := []string{}
+	for topic := range f.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	return topics
+}
+
+/*
+Matches returns true if the event is in one of the subscribed topics
+*/
+func (f *LiveFilter) Matches(event Event) bool {
+	if _, ok := event.(JobStatus); ok {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		return f.topics[TopicJobs]
+	}
+
+	for _, track := range TrackChanges(event) {
+		if f.MatchesTrack(track) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+MatchesTrack returns true if changes to the track are in one of the subscribed topics
+*/
+func (f *LiveFilter) MatchesTrack(track TrackInfo) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.topics[TopicTracks] ||
+		f.topics[TopicPilot+":"+track.PilotID] ||
+		f.topics[TopicSite+":"+strconv.Itoa(track.SiteID)]
+}
+
+// parseLiveTopic checks the topic, and returns it normalized
+func parseLiveTopic(topic string) (string, error) {
+	topic = strings.TrimSpace(topic)
+	parts := strings.SplitN(topic, ":", 2)
+
+	switch {
+	case len(parts) == 1 && (topic == TopicTracks || topic == TopicJobs):
+		return topic, nil
+	case len(parts) == 2 && parts[0] == TopicPilot && parts[1] != "":
+		return TopicPilot + ":" + PilotID(parts[1]), nil // Names are accepted too
+	case len(parts) == 2 && parts[0] == TopicSite:
+		if id, err := strconv.Atoi(parts[1]); err == nil && id > 0 {
+			return TopicSite + ":" + strconv.Itoa(id), nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid topic '%s', has to be tracks, jobs, pilot:<ID> or site:<ID>", topic)
+}
+
+/*
+HandlerLive handles GET /paragliding/api/live, a WebSocket feed of the events of the topics the client subscribes to.
+The first topics can be given as "topics=<topic>,<topic>", and later sent as {"action": "subscribe", "topic": <topic>}
+*/
+func HandlerLive(w http.ResponseWriter, r *http.Request) {
+	// HEAD is routed to the GET handlers, but a WebSocket can't be upgraded without answering with a body
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	filter := NewLiveFilter()
+	if param := r.URL.Query().Get("topics"); param != "" {
+		for _, topic := range strings.Split(param, ",") {
+			if err := filter.Subscribe(topic); err != nil {
+				writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+				return
+			}
+		}
+	}
+
+	conn, ok := upgradeWebSocket(w, r)
+	if !ok {
+		return
+	}
+	conn.readTimeout = 2 * liveHeartbeat
+
+	subscription := events.Subscribe(liveBuffer)
+	defer subscription.Close()
+
+	closed := make(chan struct{})
+	go func() { // Reads the requests of the client until it's gone
+		defer close(closed)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			writeLiveMessage(conn, handleLiveRequest(filter, message))
+		}
+	}()
+
+	heartbeat := time.NewTicker(liveHeartbeat)
+	defer heartbeat.Stop()
+
+	version := RequestVersion(r)
+	for {
+		select {
+		case <-closed:
+			conn.conn.Close()
+			return
+
+		case event, open := <-subscription.Events:
+			if !open {
+				conn.CloseWith(wsCloseNormal, "")
+				return
+			}
+			if subscription.Dropped() > 0 {
+				conn.CloseWith(wsClosePolicy, "The client is too slow")
+				return
+			}
+			for _, message := range liveMessages(event, filter, version) {
+				if err := writeLiveMessage(conn, message); err != nil {
+					conn.conn.Close()
+					return
+				}
+			}
+
+		case <-heartbeat.C:
+			if err := conn.WriteMessage(wsPing, nil); err != nil {
+				conn.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// liveMessages returns the messages of the event the filter matches in the version of the feed, one per changed track
+func liveMessages(event Event, filter *LiveFilter, version string) []LiveMessage {
+	messages := []LiveMessage{}
+	if status, ok := event.(JobStatus); ok {
+		if filter.Matches(event) {
+			messages = append(messages, LiveMessage{Event: event.EventName(), TrackID: status.TrackID, Job: &LiveJob{
+				ID: status.Job.ID, TrackID: status.Job.TrackID, Status: status.Job.Status, Attempts: status.Job.Attempts,
+			}})
+		}
+		return messages
+	}
+
+	for _, track := range TrackChanges(event) {
+		if filter.MatchesTrack(track) {
+			messages = append(messages, LiveMessage{Event: event.EventName(), TrackID: track.ID, Track: Represent(version, track)})
+		}
+	}
+
+	return messages
+}
+
+// handleLiveRequest changes the filter by the request, and returns the answer to the client
+func handleLiveRequest(filter *LiveFilter, message []byte) LiveMessage {
+	var request LiveRequest
+	if err := json.Unmarshal(message, &request); err != nil {
+		return LiveMessage{Event: "error", Error: "Invalid message, has to be {\"action\": <subscribe|unsubscribe>, \"topic\": <topic>}"}
+	}
+
+	var err error
+	switch request.Action {
+	case "subscribe":
+		err = filter.Subscribe(request.Topic)
+	case "unsubscribe":
+		err = filter.Unsubscribe(request.Topic)
+	default:
+		return LiveMessage{Event: "error", Error: "Invalid action, has to be subscribe or unsubscribe"}
+	}
+	if err != nil {
+		return LiveMessage{Event: "error", Error: err.Error()}
+	}
+
+	return LiveMessage{Event: request.Action + "d", Topics: filter.Topics()} // subscribed or unsubscribed
+}
+
+// writeLiveMessage sends the message as a text message
+func writeLiveMessage(conn *wsConn, message LiveMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteMessage(wsText, data)
+}
@@ -0,0 +1,169 @@
+package igcapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that the filter matches the events of the subscribed topics
+func Test_liveFilter(t *testing.T) {
+	filter := NewLiveFilter()
+	for _, topic := range []string{"jobs", "pilot:John  Doe", "site:3"} {
+		if err := filter.Subscribe(topic); err != nil {
+			t.Errorf("Couldn't subscribe to %s: %s", topic, err.Error())
+		}
+	}
+	for _, topic := range []string{"", "track", "pilot:", "site:x", "site:0"} {
+		if err := filter.Subscribe(topic); err == nil {
+			t.Errorf("The topic '%s' should be invalid", topic)
+		}
+	}
+
+	if topics := strings.Join(filter.Topics(), ","); topics != "jobs,pilot:john-doe,site:3" {
+		t.Errorf("Expected the topics jobs,pilot:john-doe,site:3, got %s", topics)
+	}
+
+	tests := []struct {
+		event   Event
+		matches bool
+	}{
+		{JobStatus{Job: FetchJob{Status: JobFetching}}, true},
+		{TrackAdded{Track: TrackInfo{PilotID: "john-doe", SiteID: 1}}, true},
+		{TrackDeleted{Track: TrackInfo{PilotID: "jane-doe", SiteID: 3}}, true},
+		{TrackAdded{Track: TrackInfo{PilotID: "jane-doe", SiteID: 1}}, false},
+		{TracksDeleted{Tracks: []TrackInfo{{PilotID: "jane-doe"}, {PilotID: "john-doe"}}}, true},
+		{WebhookRegistered{Webhook: Webhook{ID: 1}}, false},
+	}
+	for _, test := range tests {
+		if filter.Matches(test.event) != test.matches {
+			t.Errorf("Expected %v for %+v", test.matches, test.event)
+		}
+	}
+
+	filter.Unsubscribe("jobs")
+	if filter.Matches(tests[0].event) {
+		t.Error("The unsubscribed topic still matches")
+	}
+}
+
+// Tests that only the tracks of an event the filter matches are sent, one message each
+func Test_liveMessages(t *testing.T) {
+	filter := NewLiveFilter()
+	filter.Subscribe("pilot:john-doe")
+
+	deleted := TracksDeleted{Tracks: []TrackInfo{{ID: 1, PilotID: "john-doe"}, {ID: 2, PilotID: "jane-doe"}, {ID: 3, PilotID: "john-doe"}}}
+	messages := liveMessages(deleted, filter, Version1)
+	if len(messages) != 2 || messages[0].TrackID != 1 || messages[1].TrackID != 3 || messages[0].Event != EventTrackDeleted {
+		t.Errorf("Expected track_deleted for the tracks 1 and 3, got %+v", messages)
+	}
+
+	if messages := liveMessages(JobStatus{Job: FetchJob{Status: JobFetched}, TrackID: 4}, filter, Version1); len(messages) != 0 {
+		t.Errorf("Expected no messages for the unsubscribed jobs, got %+v", messages)
+	}
+	filter.Subscribe("jobs")
+	job := FetchJob{URL: "http://example.com/private.igc", Status: JobFetched, Failures: []string{"Timeout"}}
+	messages = liveMessages(JobStatus{Job: job, TrackID: 4}, filter, Version1)
+	if len(messages) != 1 || messages[0].TrackID != 4 || messages[0].Job.Status != JobFetched {
+		t.Errorf("Expected the fetched job of track 4, got %+v", messages)
+	}
+	if payload, _ := json.Marshal(messages); strings.Contains(string(payload), "private.igc") || strings.Contains(string(payload), "Timeout") {
+		t.Errorf("Expected the job without its URL and failures, got %s", payload)
+	}
+}
+
+// dialLive connects to the live feed of the server
+func dialLive(t *testing.T, server *httptest.Server, path string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Couldn't connect: %s", err.Error())
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", path)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Couldn't read the handshake: %s", err.Error())
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected 101 with the accept key from RFC 6455, got %d with '%s'", resp.StatusCode, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	return conn, reader
+}
+
+// readLiveMessage reads the next text message
+func readLiveMessage(t *testing.T, reader *bufio.Reader) LiveMessage {
+	opcode, payload, err := readServerFrame(reader)
+	if err != nil || opcode != wsText {
+		t.Fatalf("Expected a text message, got %d (%v)", opcode, err)
+	}
+
+	var message LiveMessage
+	json.Unmarshal(payload, &message)
+	return message
+}
+
+// Tests that clients get the events of the topics they subscribe to, in the version of the feed
+func Test_liveFeed(t *testing.T) {
+	server := httptest.NewServer(NewRouter())
+	defer server.Close()
+
+	conn, reader := dialLive(t, server, "/paragliding/api/v2/live?topics=jobs")
+	defer conn.Close()
+
+	writeClientFrame(conn, true, wsText, []byte(`{"action": "subscribe", "topic": "pilot:john-doe"}`))
+	if message := readLiveMessage(t, reader); message.Event != "subscribed" || strings.Join(message.Topics, ",") != "jobs,pilot:john-doe" {
+		t.Errorf("Expected subscribed to jobs,pilot:john-doe, got %+v", message)
+	}
+
+	writeClientFrame(conn, true, wsText, []byte(`{"action": "watch"}`))
+	if message := readLiveMessage(t, reader); message.Event != "error" {
+		t.Errorf("Expected an error, got %+v", message)
+	}
+
+	events.Publish(TrackAdded{Track: TrackInfo{ID: 7, PilotID: "jane-doe"}})
+	events.Publish(TrackAdded{Track: TrackInfo{ID: 8, PilotID: "john-doe", Timestamp: 1540000000}})
+	events.Publish(JobStatus{Job: FetchJob{URL: "http://example.com", Status: JobFailed}})
+
+	message := readLiveMessage(t, reader)
+	track, _ := message.Track.(map[string]interface{})
+	if message.Event != EventTrackAdded || message.TrackID != 8 || track["added_at"] != "2018-10-20T01:46:40Z" {
+		t.Errorf("Expected the v2 track 8, got %+v", message)
+	}
+	if message := readLiveMessage(t, reader); message.Event != EventJobStatus || message.Job == nil || message.Job.Status != JobFailed {
+		t.Errorf("Expected the failed job, got %+v", message)
+	}
+
+	writeClientFrame(conn, true, wsClose, []byte{0x03, 0xE8})
+	if opcode, _, err := readServerFrame(reader); err != nil || opcode != wsClose {
+		t.Errorf("Expected the close to be answered, got %d (%v)", opcode, err)
+	}
+}
+
+// Tests that HEAD requests, requests without a handshake and with invalid topics are refused
+func Test_liveFeedInvalid(t *testing.T) {
+	for _, path := range []string{"/paragliding/api/live", "/paragliding/api/live?topics=nothing"} {
+		w := httptest.NewRecorder()
+		NewRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	NewRouter().ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/paragliding/api/live", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodGet {
+		t.Errorf("Expected HEAD to be refused with 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,874 @@
+package igcapi
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+TrackMemoryDB stores tracks in memory. It behaves like TrackDB, and is used when running
+without a database (TRACK_STORAGE=memory) and in tests
+*/
+type TrackMemoryDB struct {
+	mutex  sync.RWMutex
+	tracks []TrackInfo // In the order they were added, like the natural order of the mongo collection
+	index  spatialIndex
+	nextID int // One more than the largest ID added, purged tracks included
+}
+
+/*
+Add adds a new track, returns false if a track with the same source URL is already added
+*/
+func (db *TrackMemoryDB) Add(t TrackInfo) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, track := range db.tracks {
+		if t.TrackSourceURL != "" && track.TrackSourceURL == t.TrackSourceURL {
+			return false
+		}
+	}
+
+	db.tracks = append(db.tracks, t)
+	db.index.add(t)
+	db.nextID = Max(db.nextID, t.ID+1)
+	return true
+}
+
+/*
+Update replaces the stored track with the same ID, returns if the update was successful. The track is only
+replaced if it's still deleted or not as when it was read, so a track deleted in the meantime isn't restored
+*/
+func (db *TrackMemoryDB) Update(t TrackInfo) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for i, track := range db.tracks {
+		if track.ID == t.ID && track.DeletedAt == t.DeletedAt {
+			db.tracks[i] = t
+			db.rebuildIndex() // The geometry can change with the update
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Count returns the amount of tracks, deleted tracks are not counted
+*/
+func (db *TrackMemoryDB) Count() int {
+	IDs, _ := db.FindIDs(TrackFilter{})
+	return len(IDs)
+}
+
+/*
+Get returns the track with a given ID, and if the track was found. Deleted tracks are not found
+*/
+func (db *TrackMemoryDB) Get(key int) (TrackInfo, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	for _, track := range db.tracks {
+		if track.ID == key && track.DeletedAt == 0 {
+			return track, true
+		}
+	}
+
+	return TrackInfo{}, false
+}
+
+/*
+GetAll returns all the tracks that aren't deleted
+*/
+func (db *TrackMemoryDB) GetAll() ([]TrackInfo, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	tracks := []TrackInfo{}
+	for _, track := range db.tracks {
+		if track.DeletedAt == 0 {
+			tracks = append(tracks, track)
+		}
+	}
+
+	return tracks, nil
+}
+
+/*
+GetAllIDs returns a slice of the IDs of the tracks that aren't deleted
+*/
+func (db *TrackMemoryDB) GetAllIDs() ([]int, error) {
+	return db.FindIDs(TrackFilter{})
+}
+
+/*
+Find returns the tracks matching the filter, sorted by ID
+*/
+func (db *TrackMemoryDB) Find(filter TrackFilter) ([]TrackInfo, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	tracks := []TrackInfo{}
+	for _, track := range db.candidates(filter) {
+		if filter.Matches(track) {
+			tracks = append(tracks, track)
+		}
+	}
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i].ID < tracks[j].ID })
+
+	return tracks, nil
+}
+
+/*
+FindIDs returns the IDs of the tracks matching the filter, sorted by ID
+*/
+func (db *TrackMemoryDB) FindIDs(filter TrackFilter) ([]int, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	IDs := []int{}
+	for _, track := range db.candidates(filter) {
+		if filter.Matches(track) {
+			IDs = append(IDs, track.ID)
+		}
+	}
+	sort.Ints(IDs)
+
+	return IDs, nil
+}
+
+/*
+FindPage returns a page of the tracks matching the filter, and the cursor of the next page
+(an empty string if it's the last page)
+*/
+func (db *TrackMemoryDB) FindPage(filter TrackFilter, page PageRequest) ([]TrackInfo, string, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	tracks := []TrackInfo{}
+	for _, track := range db.candidates(filter) {
+		after, err := page.After(track)
+		if err != nil {
+			return []TrackInfo{}, "", err
+		}
+		if after && filter.Matches(track) {
+			tracks = append(tracks, track)
+		}
+	}
+
+	sort.Slice(tracks, func(i, j int) bool {
+		return page.Compare(tracks[i], tracks[j]) < 0
+	})
+
+	if len(tracks) > page.Limit+1 {
+		tracks = tracks[:page.Limit+1]
+	}
+
+	tracks, next := page.cut(tracks)
+	return tracks, next, nil
+}
+
+/*
+GetLast returns the last added track that isn't deleted
+*/
+func (db *TrackMemoryDB) GetLast() (TrackInfo, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	for i := len(db.tracks) - 1; i >= 0; i-- {
+		if db.tracks[i].DeletedAt == 0 {
+			return db.tracks[i], nil
+		}
+	}
+
+	return TrackInfo{}, errors.New("no tracks added")
+}
+
+/*
+GetLastID returns the last used track ID, or -1 if no tracks were added. Deleted and purged tracks are included so IDs aren't reused
+*/
+func (db *TrackMemoryDB) GetLastID() int {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	return db.nextID - 1
+}
+
+/*
+Delete marks the track with the given ID as deleted, returns if a track was deleted
+*/
+func (db *TrackMemoryDB) Delete(ID int, deletedAt int64) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for i, track := range db.tracks {
+		if track.ID == ID && track.DeletedAt == 0 {
+			db.tracks[i].DeletedAt = deletedAt
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+DeleteAll marks all tracks as deleted, and returns how many tracks were deleted
+*/
+func (db *TrackMemoryDB) DeleteAll(deletedAt int64) int {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	count := 0
+	for i := range db.tracks {
+		if db.tracks[i].DeletedAt == 0 {
+			db.tracks[i].DeletedAt = deletedAt
+			count++
+		}
+	}
+
+	return count
+}
+
+/*
+Restore restores a deleted track, returns if a track was restored
+*/
+func (db *TrackMemoryDB) Restore(ID int) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for i, track := range db.tracks {
+		if track.ID == ID && track.DeletedAt != 0 {
+			db.tracks[i].DeletedAt = 0
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Purge permanently removes the tracks deleted at or before the given time, and returns the removed tracks
+*/
+func (db *TrackMemoryDB) Purge(deletedBefore int64) ([]TrackInfo, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	purged, kept := []TrackInfo{}, []TrackInfo{}
+	for _, track := range db.tracks {
+		if track.DeletedAt != 0 && track.DeletedAt <= deletedBefore {
+			purged = append(purged, track)
+		} else {
+			kept = append(kept, track)
+		}
+	}
+	db.tracks = kept
+	db.rebuildIndex()
+
+	return purged, nil
+}
+
+// candidates returns the tracks that can match the filter, using the spatial index for geographic filters
+func (db *TrackMemoryDB) candidates(filter TrackFilter) []TrackInfo {
+	IDs, ok := db.index.candidates(filter)
+	if !ok {
+		return db.tracks
+	}
+
+	tracks := []TrackInfo{}
+	for _, track := range db.tracks {
+		if IDs[track.ID] {
+			tracks = append(tracks, track)
+		}
+	}
+
+	return tracks
+}
+
+// rebuildIndex recreates the spatial index from all the tracks
+func (db *TrackMemoryDB) rebuildIndex() {
+	db.index = spatialIndex{}
+	for _, track := range db.tracks {
+		db.index.add(track)
+	}
+}
+
+/*
+WebhookMemoryDB stores webhooks in memory, it behaves like WebhookDB
+*/
+type WebhookMemoryDB struct {
+	mutex    sync.RWMutex
+	webhooks []Webhook
+}
+
+/*
+Add adds a webhook, returns false if a webhook with the same URL is already added
+*/
+func (db *WebhookMemoryDB) Add(wh Webhook) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, webhook := range db.webhooks {
+		if webhook.URL == wh.URL {
+			return false
+		}
+	}
+	db.webhooks = append(db.webhooks, wh)
+
+	return true
+}
+
+/*
+GetLastID returns the largest webhook ID used, or 0 if there are no webhooks
+*/
+func (db *WebhookMemoryDB) GetLastID() int {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	last := 0
+	for _, webhook := range db.webhooks {
+		last = Max(last, webhook.ID)
+	}
+
+	return last
+}
+
+/*
+GetAll returns all the webhooks
+*/
+func (db *WebhookMemoryDB) GetAll() ([]Webhook, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	webhooks := make([]Webhook, len(db.webhooks))
+	copy(webhooks, db.webhooks)
+
+	return webhooks, nil
+}
+
+/*
+Get returns the webhook with the given ID, and if it was found
+*/
+func (db *WebhookMemoryDB) Get(ID int) (Webhook, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	for _, webhook := range db.webhooks {
+		if webhook.ID == ID {
+			return webhook, true
+		}
+	}
+
+	return Webhook{}, false
+}
+
+/*
+Delete deletes the webhook with the given ID and returns it, and if it was found
+*/
+func (db *WebhookMemoryDB) Delete(ID int) (Webhook, bool) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for i, webhook := range db.webhooks {
+		if webhook.ID == ID {
+			db.webhooks = append(db.webhooks[:i], db.webhooks[i+1:]...)
+			return webhook, true
+		}
+	}
+
+	return Webhook{}, false
+}
+
+/*
+RevisionMemoryDB stores track revisions in memory, it behaves like RevisionDB
+*/
+type RevisionMemoryDB struct {
+	mutex     sync.RWMutex
+	revisions []TrackRevision
+}
+
+/*
+Add adds a revision, returns false if the track already has a revision with the same number
+*/
+func (db *RevisionMemoryDB) Add(rev TrackRevision) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, revision := range db.revisions {
+		if revision.TrackID == rev.TrackID && revision.Revision == rev.Revision {
+			return false
+		}
+	}
+	db.revisions = append(db.revisions, rev)
+
+	return true
+}
+
+/*
+GetAll returns all the revisions of a track, oldest first
+*/
+func (db *RevisionMemoryDB) GetAll(trackID int) ([]TrackRevision, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	revisions := []TrackRevision{}
+	for _, revision := range db.revisions {
+		if revision.TrackID == trackID {
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.SliceStable(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+
+	return revisions, nil
+}
+
+/*
+DeleteAll deletes every revision of a track
+*/
+func (db *RevisionMemoryDB) DeleteAll(trackID int) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	kept := []TrackRevision{}
+	for _, revision := range db.revisions {
+		if revision.TrackID != trackID {
+			kept = append(kept, revision)
+		}
+	}
+	db.revisions = kept
+
+	return true
+}
+
+/*
+PointsMemoryDB stores the points of the tracks in memory, it behaves like PointsDB
+*/
+type PointsMemoryDB struct {
+	mutex  sync.RWMutex
+	points map[int][]TrackPoint // By track ID
+}
+
+/*
+Set stores the points of a track, replacing the points already stored for it
+*/
+func (db *PointsMemoryDB) Set(trackID int, points []TrackPoint) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.points == nil {
+		db.points = make(map[int][]TrackPoint)
+	}
+	db.points[trackID] = points
+
+	return true
+}
+
+/*
+Get returns the points of a track, and if they were found
+*/
+func (db *PointsMemoryDB) Get(trackID int) ([]TrackPoint, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	points, found := db.points[trackID]
+	if !found {
+		return []TrackPoint{}, false
+	}
+
+	return points, true
+}
+
+/*
+Delete deletes the points of a track
+*/
+func (db *PointsMemoryDB) Delete(trackID int) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	_, found := db.points[trackID]
+	delete(db.points, trackID)
+
+	return found
+}
+
+/*
+SiteMemoryDB stores launch sites in memory, it behaves like SiteDB
+*/
+type SiteMemoryDB struct {
+	mutex sync.RWMutex
+	sites []Site
+}
+
+/*
+Add adds a site, returns false if a site with the same ID is already added
+*/
+func (db *SiteMemoryDB) Add(site Site) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, s := range db.sites {
+		if s.ID == site.ID {
+			return false
+		}
+	}
+	db.sites = append(db.sites, site)
+
+	return true
+}
+
+/*
+Update replaces the stored site with the same ID, returns if the update was successful
+*/
+func (db *SiteMemoryDB) Update(site Site) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for i, s := range db.sites {
+		if s.ID == site.ID {
+			db.sites[i] = site
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Get returns the site with the given ID, and if it was found
+*/
+func (db *SiteMemoryDB) Get(ID int) (Site, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	for _, site := range db.sites {
+		if site.ID == ID {
+			return site, true
+		}
+	}
+
+	return Site{}, false
+}
+
+/*
+GetAll returns all the sites, sorted by ID
+*/
+func (db *SiteMemoryDB) GetAll() ([]Site, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	sites := make([]Site, len(db.sites))
+	copy(sites, db.sites)
+	sort.Slice(sites, func(i, j int) bool { return sites[i].ID < sites[j].ID })
+
+	return sites, nil
+}
+
+/*
+GetLastID returns the last site ID used, or -1 if there are no sites
+*/
+func (db *SiteMemoryDB) GetLastID() int {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	last := -1
+	for _, site := range db.sites {
+		last = Max(last, site.ID)
+	}
+
+	return last
+}
+
+/*
+PilotMemoryDB stores pilot profiles in memory, it behaves like PilotDB
+*/
+type PilotMemoryDB struct {
+	mutex  sync.RWMutex
+	pilots map[string]Pilot // By ID
+}
+
+/*
+AddTrack adds a track to the totals of its pilot, creating the pilot if it's the pilot's first track
+*/
+func (db *PilotMemoryDB) AddTrack(t TrackInfo) bool {
+	if t.PilotID == "" {
+		return false
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.pilots == nil {
+		db.pilots = make(map[string]Pilot)
+	}
+	pilot, found := db.pilots[t.PilotID]
+	if !found {
+		pilot = Pilot{ID: t.PilotID, Gliders: []string{}}
+	}
+	pilot.AddTrack(t)
+	db.pilots[t.PilotID] = pilot
+
+	return true
+}
+
+/*
+Set stores the pilot, replacing the stored profile
+*/
+func (db *PilotMemoryDB) Set(p Pilot) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.pilots == nil {
+		db.pilots = make(map[string]Pilot)
+	}
+	db.pilots[p.ID] = p
+
+	return true
+}
+
+/*
+Get returns the pilot with the given ID, and if it was found
+*/
+func (db *PilotMemoryDB) Get(ID string) (Pilot, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	pilot, found := db.pilots[ID]
+	return pilot, found
+}
+
+/*
+GetAll returns all the pilots, sorted by ID
+*/
+func (db *PilotMemoryDB) GetAll() ([]Pilot, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	pilots := []Pilot{}
+	for _, pilot := range db.pilots {
+		pilots = append(pilots, pilot)
+	}
+	sort.Slice(pilots, func(i, j int) bool { return pilots[i].ID < pilots[j].ID })
+
+	return pilots, nil
+}
+
+/*
+Delete deletes the pilot with the given ID
+*/
+func (db *PilotMemoryDB) Delete(ID string) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	_, found := db.pilots[ID]
+	delete(db.pilots, ID)
+
+	return found
+}
+
+/*
+GliderMemoryDB stores the glider registry in memory, it behaves like GliderDB
+*/
+type GliderMemoryDB struct {
+	mutex   sync.RWMutex
+	gliders map[string]Glider // By ID
+}
+
+/*
+AddTrack adds a track to the totals of its glider, creating the glider if it's the glider's first track
+*/
+func (db *GliderMemoryDB) AddTrack(t TrackInfo) bool {
+	id := NormalizeGliderID(t.GliderID)
+	if id == "" {
+		return false
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	glider, found := db.stored(id)
+	if !found {
+		glider.Model = strings.TrimSpace(t.Glider)
+	}
+	glider.Flights++
+	glider.Airtime += t.Airtime
+	glider.Distance += t.TrackLength
+	db.gliders[id] = glider
+
+	return true
+}
+
+/*
+Register sets the model, class and owner of a glider, creating the glider if it doesn't exist
+*/
+func (db *GliderMemoryDB) Register(id string, registration GliderRegistration) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	glider, _ := db.stored(id)
+	glider.Model, glider.Class, glider.Owner = registration.Model, registration.Class, registration.Owner
+	db.gliders[id] = glider
+
+	return true
+}
+
+/*
+SetTotals replaces the totals of a glider, the registered fields are only set if the glider doesn't exist
+*/
+func (db *GliderMemoryDB) SetTotals(g Glider) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	glider, found := db.stored(g.ID)
+	if !found {
+		glider = g
+	}
+	glider.Flights, glider.Airtime, glider.Distance = g.Flights, g.Airtime, g.Distance
+	db.gliders[g.ID] = glider
+
+	return true
+}
+
+/*
+Get returns the glider with the given ID, and if it was found
+*/
+func (db *GliderMemoryDB) Get(ID string) (Glider, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	glider, found := db.gliders[ID]
+	return glider, found
+}
+
+/*
+GetAll returns all the gliders, sorted by ID. If a class is given only gliders of that class are returned
+*/
+func (db *GliderMemoryDB) GetAll(class string) ([]Glider, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	gliders := []Glider{}
+	for _, glider := range db.gliders {
+		if class == "" || glider.Class == class {
+			gliders = append(gliders, glider)
+		}
+	}
+	sort.Slice(gliders, func(i, j int) bool { return gliders[i].ID < gliders[j].ID })
+
+	return gliders, nil
+}
+
+// stored returns the stored glider with the ID, or a new glider with the ID. The lock has to be held
+func (db *GliderMemoryDB) stored(id string) (Glider, bool) {
+	if db.gliders == nil {
+		db.gliders = make(map[string]Glider)
+	}
+	glider, found := db.gliders[id]
+	if !found {
+		glider = Glider{ID: id}
+	}
+
+	return glider, found
+}
+
+/*
+AuditMemoryDB stores the audit trail in memory, it behaves like AuditDB
+*/
+type AuditMemoryDB struct {
+	mutex   sync.RWMutex
+	entries []AuditEntry
+}
+
+/*
+Add adds an entry to the audit trail
+*/
+func (db *AuditMemoryDB) Add(entry AuditEntry) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.entries = append(db.entries, entry)
+	return true
+}
+
+/*
+GetAll returns the audit trail of a track, oldest first
+*/
+func (db *AuditMemoryDB) GetAll(trackID int) ([]AuditEntry, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	entries := []AuditEntry{}
+	for _, entry := range db.entries {
+		if entry.TrackID == trackID {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp < entries[j].Timestamp })
+
+	return entries, nil
+}
+
+/*
+JobMemoryDB stores the fetch jobs in memory, it behaves like JobDB. Jobs older than jobRetention are removed
+when jobs are added
+*/
+type JobMemoryDB struct {
+	mutex sync.RWMutex
+	jobs  []FetchJob
+}
+
+/*
+Add adds a job, returns false if a job with the same ID already exists
+*/
+func (db *JobMemoryDB) Add(job FetchJob) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	kept := []FetchJob{}
+	for _, stored := range db.jobs {
+		if stored.ID == job.ID {
+			return false
+		}
+		if time.Since(stored.CreatedAt) < jobRetention {
+			kept = append(kept, stored)
+		}
+	}
+	db.jobs = append(kept, job)
+
+	return true
+}
+
+/*
+Update replaces the stored job with the same ID, returns if the update was successful
+*/
+func (db *JobMemoryDB) Update(job FetchJob) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for i, stored := range db.jobs {
+		if stored.ID == job.ID {
+			db.jobs[i] = job
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Get returns the job with the given ID, and if it was found
+*/
+func (db *JobMemoryDB) Get(ID string) (FetchJob, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	for _, job := range db.jobs {
+		if job.ID == ID {
+			return job, true
+		}
+	}
+
+	return FetchJob{}, false
+}
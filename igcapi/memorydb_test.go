@@ -0,0 +1,19 @@
+package igcapi
+
+import (
+	"strconv"
+)
+
+// testTrackDB returns a memory store with the tracks, the tracks without a source URL get one from their ID
+// so they aren't refused as duplicates
+func testTrackDB(tracks ...TrackInfo) *TrackMemoryDB {
+	memoryDB := &TrackMemoryDB{}
+	for _, track := range tracks {
+		if track.TrackSourceURL == "" {
+			track.TrackSourceURL = "http://example.com/" + strconv.Itoa(track.ID) + ".igc"
+		}
+		memoryDB.Add(track)
+	}
+
+	return memoryDB
+}
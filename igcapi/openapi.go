@@ -0,0 +1,705 @@
+package igcapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+OpenAPISpec is an OpenAPI 3 document
+*/
+type OpenAPISpec struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+/*
+OpenAPIInfo describes the API
+*/
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+/*
+OpenAPIComponents contains the schemas of the named types, and how API keys are given
+*/
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes"`
+}
+
+/*
+OpenAPISecurityScheme is a way to give API keys
+*/
+type OpenAPISecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+/*
+OpenAPIOperation is a method of a path
+*/
+type OpenAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+}
+
+/*
+OpenAPIParameter is a path or query parameter
+*/
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required"`
+	Schema      *OpenAPISchema `json:"schema"`
+}
+
+/*
+OpenAPIRequestBody is the body of an operation, by content type
+*/
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+/*
+OpenAPIResponse is a response of an operation, by content type. Responses without a body have no content
+*/
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+/*
+OpenAPIMediaType has the schema of a body
+*/
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+/*
+OpenAPISchema is the schema of a value. Schemas of named types are references to the components
+*/
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+// operationDoc documents an operation, the schemas are made from the types of the Go values
+type operationDoc struct {
+	Summary  string
+	Role     string                 // The role of the API key needed, empty for public operations
+	Query    []queryDoc             // The query parameters
+	Body     map[string]interface{} // The request body by content type, a string is a text body
+	Status   int                    // The status of successful responses, 200 if not set
+	Response interface{}            // The response body, a string is a text body and nil no body
+	TextType string                 // The content type of text bodies, text/plain if not set
+	Stream   string                 // The content type of streamed responses, Response is the data of the events
+	Errors   []int                  // The statuses of errors, 429 is added for every operation
+
+	// The bodies in v2, when they aren't the v2 representation of Body and Response
+	BodyV2     map[string]interface{}
+	ResponseV2 interface{}
+}
+
+type queryDoc struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+var (
+	pageQuery = []queryDoc{
+		{"limit", "integer", "The amount of items on a page, at most 1000"},
+		{"sort", "string", "The field to sort by, prefixed with - for descending order"},
+		{"cursor", "string", "The cursor of the next page, from the Link header"},
+	}
+
+	trackQuery = append([]queryDoc{
+		{"pilot", "string", "The pilot"},
+		{"glider", "string", "The glider"},
+		{"glider_id", "string", "The glider ID"},
+		{"signature_status", "string", "valid, invalid, absent or unsupported"},
+		{"from", "string", "The earliest H_date, as YYYY-MM-DD or RFC 3339"},
+		{"to", "string", "The latest H_date, as YYYY-MM-DD or RFC 3339"},
+		{"min_length", "number", "The shortest track length in km"},
+		{"max_length", "number", "The longest track length in km"},
+		{"site", "integer", "The ID of the launch site"},
+		{"near", "string", "<lat>,<lng>, tracks starting near the point"},
+		{"radius", "number", "The radius of near in km, 5 by default"},
+		{"bbox", "string", "<minLng>,<minLat>,<maxLng>,<maxLat>, tracks going through the area"},
+	}, pageQuery...)
+
+	tickerQuery = append([]queryDoc{
+		{"since", "string", "The earliest time the tracks were added, as RFC 3339 or a unix timestamp"},
+		{"until", "string", "The time the tracks were added before, as RFC 3339 or a unix timestamp"},
+		{"pilot", "string", "The name or ID of the pilot"},
+		{"site", "integer", "The ID of the launch site"},
+	}, pageQuery...)
+
+	feedQuery = []queryDoc{
+		{"pilot", "string", "The name or ID of the pilot"},
+		{"site", "integer", "The ID of the launch site"},
+		{"limit", "integer", "The amount of tracks, 20 by default"},
+	}
+
+	jsonType = "application/json"
+	textType = "text/plain"
+
+	// The operations of the API by method and route pattern, every route has to be documented
+	operationDocs = map[string]operationDoc{
+		"GET /paragliding": {
+			Summary: "Redirects to /paragliding/api",
+			Status:  http.StatusMovedPermanently,
+		},
+		"GET /paragliding/api": {
+			Summary:  "Information about the API",
+			Response: APIInfo{},
+		},
+		"GET /paragliding/api/openapi.json": {
+			Summary:  "This document",
+			Response: OpenAPISpec{},
+		},
+		"GET /paragliding/api/track": {
+			Summary:  "The IDs of the tracks matching the filter, paged",
+			Query:    trackQuery,
+			Response: []int{},
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"POST /paragliding/api/track": {
+			Summary:  "Adds the IGC file at the URL as a track, and returns its ID",
+			Role:     RoleUploader,
+			Body:     map[string]interface{}{jsonType: TrackURL{}},
+			Response: map[string]int{},
+			Errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusBadGateway},
+		},
+		"GET /paragliding/api/track/jobs/{id}": {
+			Summary:  "The status and the attempts of the fetch of an added track, kept for a day. The response of adding the track links to it",
+			Role:     RoleUploader,
+			Response: FetchJob{},
+			Errors:   []int{http.StatusNotFound},
+		},
+		"GET /paragliding/api/track/{id:int}": {
+			Summary:  "The track",
+			Response: TrackInfo{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+		},
+		"PATCH /paragliding/api/track/{id:int}": {
+			Summary:  "Corrects the pilot, glider and glider ID of the track, and returns the edited track",
+			Role:     RoleUploader,
+			Body:     map[string]interface{}{jsonType: TrackEdit{}},
+			Response: TrackInfo{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		},
+		"DELETE /paragliding/api/track/{id:int}": {
+			Summary:  "Moves the track to the trash, and returns it",
+			Role:     RoleAdmin,
+			Response: TrackInfo{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/track/{id:int}/revisions": {
+			Summary:  "The revisions of the track",
+			Response: []TrackRevision{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/track/{id:int}/points": {
+			Summary: "The GPS fixes of the track",
+			Query: []queryDoc{
+				{"from", "string", "The earliest fix, RFC 3339 or unix time"},
+				{"to", "string", "The latest fix, RFC 3339 or unix time"},
+				{"resample", "number", "Seconds between the fixes"},
+				{"simplify", "number", "The tolerance of the simplification in meters"},
+			},
+			Response: []TrackPoint{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+		},
+		"GET /paragliding/api/track/{id:int}/audit": {
+			Summary:  "The audit trail of the track",
+			Response: []AuditEntry{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/track/{id:int}/{field}": {
+			Summary:  "A field of the track: H_date, pilot, glider, glider_id, track_length, track_src_url, signature_status or pilot_id",
+			Response: "",
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+		},
+		"GET /paragliding/api/ticker": {
+			Summary:  "The tracks in the order they were added, paged",
+			Query:    tickerQuery,
+			Response: Ticker{},
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/ticker/latest": {
+			Summary:  "The timestamp of the last added track",
+			Response: "",
+			Errors:   []int{http.StatusNotFound},
+		},
+		"GET /paragliding/api/ticker/stream": {
+			Summary:  "Server-Sent Events with the ID and timestamp of every added track. The ID of the events is <timestamp>-<track ID>, Last-Event-ID resumes after it",
+			Response: TickerEvent{},
+			Stream:   "text/event-stream",
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/live": {
+			Summary: "A WebSocket feed of the events of the subscribed topics: tracks, jobs, pilot:<ID> and site:<ID>",
+			Query:   []queryDoc{{"topics", "string", "The first topics, separated by commas"}},
+			Status:  http.StatusSwitchingProtocols,
+			Errors:  []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/ticker/{timestamp:int}": {
+			Summary:  "The tracks added after the timestamp, paged",
+			Query:    tickerQuery,
+			Response: Ticker{},
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/feed.atom": {
+			Summary:  "An Atom feed of the most recently added tracks",
+			Query:    feedQuery,
+			Response: "",
+			TextType: atomType,
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/feed.rss": {
+			Summary:  "An RSS feed of the most recently added tracks",
+			Query:    feedQuery,
+			Response: "",
+			TextType: rssType,
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"POST /paragliding/api/webhook/new_track": {
+			Summary:  "Registers a webhook called every minTriggerValue added tracks, and for the track events it opts in to",
+			Role:     RoleUploader,
+			Body:     map[string]interface{}{jsonType: Webhook{}},
+			Status:   http.StatusCreated,
+			Response: "",
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+
+			BodyV2:     map[string]interface{}{jsonType: WebhookRequestV2{}},
+			ResponseV2: map[string]int{},
+		},
+		"GET /paragliding/api/webhook/new_track/{id:int}": {
+			Summary:  "The webhook",
+			Role:     RoleReader,
+			Response: Webhook{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+		},
+		"DELETE /paragliding/api/webhook/new_track/{id:int}": {
+			Summary:  "Deletes the webhook, and returns it. Only the key that registered it and admins can delete it",
+			Role:     RoleUploader,
+			Response: Webhook{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+		},
+		"GET /paragliding/api/sites": {
+			Summary:  "The launch sites",
+			Response: []Site{},
+			Errors:   []int{http.StatusInternalServerError},
+		},
+		"POST /paragliding/api/sites": {
+			Summary: "Adds a named site",
+			Role:    RoleUploader,
+			Body: map[string]interface{}{jsonType: struct {
+				Name   string  `json:"name"`
+				Lat    float64 `json:"lat"`
+				Lng    float64 `json:"lng"`
+				Radius float64 `json:"radius,omitempty"` // Meters
+			}{}},
+			Status:   http.StatusCreated,
+			Response: Site{},
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"POST /paragliding/api/sites/import": {
+			Summary:  "Imports sites from a CSV or SeeYou CUP file, and returns the added sites",
+			Role:     RoleUploader,
+			Query:    []queryDoc{{"format", "string", "csv (the default) or cup"}},
+			Body:     map[string]interface{}{textType: ""},
+			Response: []Site{},
+			Errors:   []int{http.StatusBadRequest},
+		},
+		"GET /paragliding/api/sites/{id:int}": {
+			Summary:  "The site with the statistics of its flights",
+			Response: SiteDetails{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/sites/{id:int}/tracks": {
+			Summary:  "The IDs of the tracks from the site, paged",
+			Query:    pageQuery,
+			Response: []int{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/pilots": {
+			Summary:  "The pilots with the totals of their flights",
+			Response: []Pilot{},
+			Errors:   []int{http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/pilots/{id}": {
+			Summary:  "The pilot",
+			Response: Pilot{},
+			Errors:   []int{http.StatusNotFound},
+		},
+		"GET /paragliding/api/pilots/{id}/tracks": {
+			Summary:  "The IDs of the pilot's tracks, paged",
+			Query:    pageQuery,
+			Response: []int{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/gliders": {
+			Summary:  "The glider registry",
+			Query:    []queryDoc{{"class", "string", "EN-A, EN-B, EN-C, EN-D or CCC"}},
+			Response: []Glider{},
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/gliders/{id}": {
+			Summary:  "The glider",
+			Response: Glider{},
+			Errors:   []int{http.StatusNotFound},
+		},
+		"PUT /paragliding/api/gliders/{id}": {
+			Summary:  "Registers the model, class and owner of the glider, and returns it. Changing the class needs the role admin",
+			Role:     RoleUploader,
+			Body:     map[string]interface{}{jsonType: GliderRegistration{}},
+			Response: Glider{},
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"GET /paragliding/api/leaderboard": {
+			Summary: "The ranking of the pilots in a season by the sum of their best flights",
+			Query: []queryDoc{
+				{"season", "integer", "The year, the current year by default"},
+				{"site", "integer", "The ID of the launch site"},
+				{"class", "string", "EN-A, EN-B, EN-C, EN-D or CCC"},
+				{"metric", "string", "score (the default), distance or airtime"},
+			},
+			Response: Leaderboard{},
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"POST /paragliding/api/validate": {
+			Summary: "Validates an IGC file without storing it",
+			Body: map[string]interface{}{
+				textType: "",
+				jsonType: TrackURL{},
+				"multipart/form-data": struct {
+					File string `json:"file"`
+				}{},
+			},
+			Response: ValidationReport{},
+			Errors:   []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusBadGateway},
+		},
+		"GET /paragliding/admin/api/tracks_count": {
+			Summary:  "The amount of tracks",
+			Role:     RoleAdmin,
+			Response: "",
+		},
+		"DELETE /paragliding/admin/api/tracks": {
+			Summary:  "Moves every track to the trash",
+			Role:     RoleAdmin,
+			Response: "",
+			Errors:   []int{http.StatusInternalServerError},
+		},
+		"GET /paragliding/admin/api/trash": {
+			Summary:  "The deleted tracks, paged",
+			Role:     RoleAdmin,
+			Query:    pageQuery,
+			Response: []TrashedTrack{},
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"DELETE /paragliding/admin/api/trash": {
+			Summary:  "Purges every deleted track",
+			Role:     RoleAdmin,
+			Response: "",
+		},
+		"GET /paragliding/admin/api/trash/{id:int}": {
+			Summary:  "The deleted track",
+			Role:     RoleAdmin,
+			Response: TrashedTrack{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		},
+		"POST /paragliding/admin/api/trash/{id:int}/restore": {
+			Summary:  "Restores the deleted track, and returns it",
+			Role:     RoleAdmin,
+			Response: TrashedTrack{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		},
+		"GET /paragliding/admin/api/keys": {
+			Summary:  "The API keys, without the keys themselves",
+			Role:     RoleAdmin,
+			Response: []APIKey{},
+			Errors:   []int{http.StatusInternalServerError},
+		},
+		"POST /paragliding/admin/api/keys": {
+			Summary:  "Creates an API key, the key is only shown in this response",
+			Role:     RoleAdmin,
+			Body:     map[string]interface{}{jsonType: APIKeyRequest{}},
+			Status:   http.StatusCreated,
+			Response: CreatedAPIKey{},
+			Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		},
+		"DELETE /paragliding/admin/api/keys/{id}": {
+			Summary: "Revokes the API key",
+			Role:    RoleAdmin,
+			Status:  http.StatusNoContent,
+			Errors:  []int{http.StatusNotFound},
+		},
+	}
+)
+
+/*
+BuildOpenAPI creates the OpenAPI document of the API. The public routes are documented both as
+the deprecated v1 and as v2
+*/
+func BuildOpenAPI() OpenAPISpec {
+	spec := OpenAPISpec{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title:       "Paragliding API",
+			Description: "Service for IGC tracks",
+			Version:     strings.ToUpper(Version2),
+		},
+		Paths: make(map[string]map[string]*OpenAPIOperation),
+		Components: OpenAPIComponents{
+			Schemas: make(map[string]*OpenAPISchema),
+			SecuritySchemes: map[string]OpenAPISecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer"},
+				"apiKey": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+	}
+	generator := schemaGenerator{schemas: spec.Components.Schemas}
+
+	add := func(method, pattern string, operation *OpenAPIOperation) {
+		path := strings.Replace(pattern, ":int}", "}", -1)
+		if spec.Paths[path] == nil {
+			spec.Paths[path] = make(map[string]*OpenAPIOperation)
+		}
+		spec.Paths[path][strings.ToLower(method)] = operation
+	}
+
+	for route, doc := range operationDocs {
+		parts := strings.SplitN(route, " ", 2)
+		method, pattern := parts[0], parts[1]
+
+		v2, versioned := v2Pattern(pattern)
+		if !versioned {
+			add(method, pattern, generator.operation(pattern, doc, Version1))
+			continue
+		}
+
+		v1Operation := generator.operation(pattern, doc, Version1)
+		v1Operation.Deprecated = true
+		add(method, pattern, v1Operation)
+		add(method, v2, generator.operation(v2, doc, Version2))
+	}
+
+	return spec
+}
+
+// operation makes the operation of a route in the version
+func (g schemaGenerator) operation(pattern string, doc operationDoc, version string) *OpenAPIOperation {
+	operation := &OpenAPIOperation{Summary: doc.Summary, Responses: make(map[string]OpenAPIResponse)}
+
+	for _, segment := range strings.Split(pattern, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name, schema := segment[1:len(segment)-1], &OpenAPISchema{Type: "string"}
+			if i := strings.Index(name, ":"); i != -1 {
+				name, schema = name[:i], &OpenAPISchema{Type: "integer", Format: "int64"}
+			}
+			operation.Parameters = append(operation.Parameters, OpenAPIParameter{Name: name, In: "path", Required: true, Schema: schema})
+		}
+	}
+	for _, query := range doc.Query {
+		operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+			Name: query.Name, In: "query", Description: query.Description, Schema: &OpenAPISchema{Type: query.Type},
+		})
+	}
+
+	body, responseBody := doc.Body, doc.Response
+	if version == Version2 {
+		if doc.BodyV2 != nil {
+			body = doc.BodyV2
+		}
+		responseBody = Represent(Version2, responseBody)
+		if doc.ResponseV2 != nil {
+			responseBody = doc.ResponseV2
+		}
+	}
+
+	if body != nil {
+		operation.RequestBody = &OpenAPIRequestBody{Required: true, Content: make(map[string]OpenAPIMediaType)}
+		for contentType, value := range body {
+			operation.RequestBody.Content[contentType] = OpenAPIMediaType{Schema: g.schema(reflect.TypeOf(value))}
+		}
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := OpenAPIResponse{Description: http.StatusText(status)}
+	switch value := responseBody.(type) {
+	case nil:
+	case string:
+		contentType := textType
+		if doc.TextType != "" {
+			contentType = doc.TextType
+		}
+		response.Content = map[string]OpenAPIMediaType{contentType: {Schema: &OpenAPISchema{Type: "string"}}}
+	default:
+		if doc.Stream != "" {
+			response.Content = map[string]OpenAPIMediaType{doc.Stream: {Schema: g.schema(reflect.TypeOf(value))}}
+			break
+		}
+		response.Content = map[string]OpenAPIMediaType{jsonType: {Schema: g.schema(reflect.TypeOf(value))}}
+	}
+	operation.Responses[strconv.Itoa(status)] = response
+
+	statuses := append([]int{}, doc.Errors...)
+	if status != http.StatusMovedPermanently { // Every route but the redirect is rate limited
+		statuses = append(statuses, http.StatusTooManyRequests)
+	}
+	if doc.Role != "" {
+		operation.Description = "Needs an API key with the role " + doc.Role
+		operation.Security = []map[string][]string{{"bearer": {}}, {"apiKey": {}}}
+		statuses = append(statuses, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	for _, status := range statuses {
+		operation.Responses[strconv.Itoa(status)] = OpenAPIResponse{
+			Description: http.StatusText(status),
+			Content:     map[string]OpenAPIMediaType{"application/problem+json": {Schema: g.schema(reflect.TypeOf(APIError{}))}},
+		}
+	}
+
+	return operation
+}
+
+/*
+HandlerOpenAPI handles GET /paragliding/api/openapi.json
+*/
+func HandlerOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, BuildOpenAPI())
+}
+
+// schemaGenerator makes schemas from Go types the way encoding/json encodes them. Named structs are
+// added to the schemas and referenced
+type schemaGenerator struct {
+	schemas map[string]*OpenAPISchema
+}
+
+func (g schemaGenerator) schema(t reflect.Type) *OpenAPISchema {
+	if t == reflect.TypeOf(time.Time{}) {
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := *g.schema(t.Elem())
+		if schema.Ref != "" { // Siblings of $ref are ignored, pointers are only used for optional fields anyway
+			return &schema
+		}
+		schema.Nullable = true
+		return &schema
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = &OpenAPISchema{} // Set before making the schema, so recursive types reference it
+			*g.schemas[t.Name()] = *g.object(t)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: g.schema(t.Elem()), Nullable: t.Kind() == reflect.Slice}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: g.schema(t.Elem()), Nullable: true}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &OpenAPISchema{Type: "number"}
+	default: // interface{}, anything
+		return &OpenAPISchema{}
+	}
+}
+
+// object makes the schema of a struct, fields of embedded structs are fields of the struct
+func (g schemaGenerator) object(t reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: make(map[string]*OpenAPISchema)}
+
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+
+		name, options := tag, ""
+		if i := strings.Index(tag, ","); i != -1 {
+			name, options = tag[:i], tag[i+1:]
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = g.schema(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	for _, embeddedType := range embedded { // The fields of the struct itself take precedence
+		fields := g.object(embeddedType)
+		for name, property := range fields.Properties {
+			if _, ok := schema.Properties[name]; !ok {
+				schema.Properties[name] = property
+			}
+		}
+		for _, name := range fields.Required {
+			if !containsString(schema.Required, name) {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+	}
+	sort.Strings(schema.Required)
+
+	return schema
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+package igcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that every registered route is in the document, and that every documented operation is a route
+// in both versions of the public API
+func Test_openAPIRoutes(t *testing.T) {
+	spec := BuildOpenAPI()
+
+	routes := make(map[string]bool)
+	for _, route := range NewRouter().Routes() {
+		key := route.Method + " " + route.Pattern
+		routes[key] = true
+		if specOperation(spec, key) == nil {
+			t.Errorf("The route %s isn't in the OpenAPI document", key)
+		}
+
+		role, _ := route.Roles.Required(route.Method)
+		v1 := strings.Replace(route.Pattern, apiPrefix+"/"+Version2, apiPrefix, 1)
+		if doc, ok := operationDocs[route.Method+" "+v1]; ok && doc.Role != role {
+			t.Errorf("The route %s needs the role '%s', but the document says '%s'", key, role, doc.Role)
+		}
+	}
+
+	for key := range operationDocs {
+		if !routes[key] {
+			t.Errorf("The documented operation %s isn't a route", key)
+		}
+
+		parts := strings.SplitN(key, " ", 2)
+		if v2, ok := v2Pattern(parts[1]); ok {
+			if !routes[parts[0]+" "+v2] {
+				t.Errorf("The documented operation %s isn't a v2 route", key)
+			}
+			if !specOperation(spec, key).Deprecated || specOperation(spec, parts[0]+" "+v2).Deprecated {
+				t.Errorf("Only the v1 operation of %s should be deprecated", key)
+			}
+		}
+	}
+
+	for _, path := range []string{"/paragliding/api/track/{id}", "/paragliding/api/v2/ticker/{timestamp}", "/paragliding/admin/api/keys/{id}"} {
+		if spec.Paths[path] == nil {
+			t.Errorf("The path %s isn't in the document", path)
+		}
+	}
+	if spec.Paths["/paragliding/admin/api/v2/keys/{id}"] != nil {
+		t.Error("The admin routes shouldn't be versioned")
+	}
+}
+
+// Tests that the responses of the handlers have the status, content type and shape in the document.
+// Only the routes that can run without a database are requested, the others share the types of their responses
+func Test_openAPIResponses(t *testing.T) {
+	defer func(storage TrackStorage) { db = storage }(db)
+	defer func(storage APIKeyStorage) { keyDB = storage }(keyDB)
+	defer SetAdminKey("")
+
+	memoryDB := &TrackMemoryDB{}
+	memoryDB.Add(TrackInfo{ID: 1, Pilot: "John Doe", PilotID: "john-doe", GliderID: "X1", HDate: time.Now().UTC(), Timestamp: 1001, Score: 10})
+	memoryDB.Add(TrackInfo{ID: 2, Pilot: "Jane Doe", PilotID: "jane-doe", HDate: time.Now().UTC(), Timestamp: 1002, TrackSourceURL: "b"})
+	memoryDB.Add(TrackInfo{ID: 3, Pilot: "Jane Doe", PilotID: "jane-doe", Timestamp: 1003, TrackSourceURL: "c", DeletedAt: 1004})
+	db = memoryDB
+	keyDB = &APIKeyMemoryDB{}
+	SetAdminKey("admin-key")
+	InvalidateLeaderboards()
+	defer InvalidateLeaderboards()
+
+	tests := []struct {
+		method string
+		path   string
+		route  string
+		admin  bool
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/paragliding/api/", "GET /paragliding/api", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/openapi.json", "GET /paragliding/api/openapi.json", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/track/", "GET /paragliding/api/track", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/track/1", "GET /paragliding/api/track/{id:int}", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/track/9", "GET /paragliding/api/track/{id:int}", false, "", http.StatusNotFound},
+		{http.MethodGet, "/paragliding/api/track/x", "GET /paragliding/api/track/{id:int}", false, "", http.StatusBadRequest},
+		{http.MethodDelete, "/paragliding/api/track/1", "DELETE /paragliding/api/track/{id:int}", false, "", http.StatusUnauthorized},
+		{http.MethodGet, "/paragliding/api/track/1/pilot", "GET /paragliding/api/track/{id:int}/{field}", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/ticker/", "GET /paragliding/api/ticker", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/ticker/1001", "GET /paragliding/api/ticker/{timestamp:int}", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/ticker/latest", "GET /paragliding/api/ticker/latest", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/leaderboard", "GET /paragliding/api/leaderboard", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/feed.atom", "GET /paragliding/api/feed.atom", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/feed.rss?site=x", "GET /paragliding/api/feed.rss", false, "", http.StatusBadRequest},
+		{http.MethodGet, "/paragliding/api/v2/feed.rss", "GET /paragliding/api/v2/feed.rss", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/leaderboard?metric=x", "GET /paragliding/api/leaderboard", false, "", http.StatusBadRequest},
+		{http.MethodPost, "/paragliding/api/validate", "POST /paragliding/api/validate", false, validIGC, http.StatusOK},
+		{http.MethodGet, "/paragliding/api/v2/", "GET /paragliding/api/v2", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/v2/track/", "GET /paragliding/api/v2/track", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/v2/track/1", "GET /paragliding/api/v2/track/{id:int}", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/v2/track/1/date", "GET /paragliding/api/v2/track/{id:int}/{field}", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/v2/ticker/", "GET /paragliding/api/v2/ticker", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/v2/ticker/2000", "GET /paragliding/api/v2/ticker/{timestamp:int}", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/api/v2/leaderboard", "GET /paragliding/api/v2/leaderboard", false, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/admin/api/tracks_count", "GET /paragliding/admin/api/tracks_count", true, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/admin/api/trash", "GET /paragliding/admin/api/trash", true, "", http.StatusOK},
+		{http.MethodGet, "/paragliding/admin/api/trash/3", "GET /paragliding/admin/api/trash/{id:int}", true, "", http.StatusOK},
+		{http.MethodPost, "/paragliding/admin/api/keys", "POST /paragliding/admin/api/keys", true, `{"name": "test", "role": "reader"}`, http.StatusCreated},
+		{http.MethodGet, "/paragliding/admin/api/keys", "GET /paragliding/admin/api/keys", true, "", http.StatusOK},
+	}
+
+	spec := BuildOpenAPI()
+	router := NewRouter()
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.admin {
+			r.Header.Set("Authorization", "Bearer admin-key")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		name := test.method + " " + test.path
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", name, test.status, w.Code)
+			continue
+		}
+
+		operation := specOperation(spec, test.route)
+		response, ok := operation.Responses[strconv.Itoa(w.Code)]
+		if !ok {
+			t.Errorf("%s: the status %d isn't documented", name, w.Code)
+			continue
+		}
+
+		contentType := strings.Split(w.Header().Get("content-type"), ";")[0]
+		media, ok := response.Content[contentType]
+		if !ok {
+			t.Errorf("%s: the content type '%s' isn't documented for %d", name, contentType, w.Code)
+			continue
+		}
+		if media.Schema.Type == "string" { // Text and feeds
+			continue
+		}
+
+		var body interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s: couldn't decode the response: %s", name, err.Error())
+			continue
+		}
+		if err := validateSchema(spec, media.Schema, body, "body"); err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+		}
+	}
+}
+
+// specOperation returns the operation of the route in the document
+func specOperation(spec OpenAPISpec, route string) *OpenAPIOperation {
+	parts := strings.SplitN(route, " ", 2)
+	path := strings.Replace(parts[1], ":int}", "}", -1)
+
+	return spec.Paths[path][strings.ToLower(parts[0])]
+}
+
+// validateSchema returns an error if the decoded JSON value doesn't match the schema. Objects with properties
+// can't have other properties
+func validateSchema(spec OpenAPISpec, schema *OpenAPISchema, value interface{}, at string) error {
+	if schema.Ref != "" {
+		resolved, ok := spec.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("%s: unknown reference %s", at, schema.Ref)
+		}
+		return validateSchema(spec, resolved, value, at)
+	}
+
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s: null isn't allowed", at)
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %v", at, value)
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s: the required property %s is missing", at, name)
+			}
+		}
+
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				property = schema.AdditionalProperties
+			}
+			if property == nil {
+				return fmt.Errorf("%s: the property %s isn't in the document", at, name)
+			}
+			if err := validateSchema(spec, property, object[name], at+"."+name); err != nil {
+				return err
+			}
+		}
+
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %v", at, value)
+		}
+		for i, item := range array {
+			if err := validateSchema(spec, schema.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected a string, got %v", at, value)
+		}
+
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s: expected an integer, got %v", at, value)
+		}
+
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: expected a number, got %v", at, value)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean, got %v", at, value)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,279 @@
+package igcapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// DefaultPageLimit is the amount of items on a page when no limit is given
+	DefaultPageLimit = 100
+	// MaxPageLimit is the largest limit a client can ask for
+	MaxPageLimit = 1000
+)
+
+var (
+	// ErrInvalidCursor is returned when a cursor can't be decoded, or was made for another sort order
+	ErrInvalidCursor = errors.New("invalid cursor given")
+)
+
+/*
+sortField describes a field tracks can be sorted by
+*/
+type sortField struct {
+	key     string                                         // The field name in mongo
+	value   func(t TrackInfo) interface{}                  // The value stored in cursors and used in mongo queries
+	compare func(a, b TrackInfo) int                       // Used by the storage backends without a query language
+	decode  func(raw json.RawMessage) (interface{}, error) // Decodes the value of a cursor
+}
+
+// sortFields are the fields listings can be sorted by, with the name used in the "sort" parameter
+var sortFields = map[string]sortField{
+	"id": {
+		key:     "id",
+		value:   func(t TrackInfo) interface{} { return t.ID },
+		compare: func(a, b TrackInfo) int { return compareFloat(float64(a.ID), float64(b.ID)) },
+		decode: func(raw json.RawMessage) (interface{}, error) {
+			var v int
+			err := json.Unmarshal(raw, &v)
+			return v, err
+		},
+	},
+	"timestamp": {
+		key:     "timestamp",
+		value:   func(t TrackInfo) interface{} { return t.Timestamp },
+		compare: func(a, b TrackInfo) int { return compareFloat(float64(a.Timestamp), float64(b.Timestamp)) },
+		decode: func(raw json.RawMessage) (interface{}, error) {
+			var v int64
+			err := json.Unmarshal(raw, &v)
+			return v, err
+		},
+	},
+	"date": {
+		key:   "hdate",
+		value: func(t TrackInfo) interface{} { return t.HDate },
+		compare: func(a, b TrackInfo) int {
+			return compareFloat(float64(a.HDate.UnixNano()), float64(b.HDate.UnixNano()))
+		},
+		decode: func(raw json.RawMessage) (interface{}, error) {
+			var v time.Time
+			err := json.Unmarshal(raw, &v)
+			return v, err
+		},
+	},
+	"length": {
+		key:     "tracklength",
+		value:   func(t TrackInfo) interface{} { return t.TrackLength },
+		compare: func(a, b TrackInfo) int { return compareFloat(a.TrackLength, b.TrackLength) },
+		decode: func(raw json.RawMessage) (interface{}, error) {
+			var v float64
+			err := json.Unmarshal(raw, &v)
+			return v, err
+		},
+	},
+}
+
+/*
+PageRequest describes which page of a listing to return
+*/
+type PageRequest struct {
+	Limit      int
+	Sort       string // One of id, timestamp, date and length
+	Descending bool
+	Cursor     *PageCursor // The position to continue after, nil for the first page
+}
+
+/*
+PageCursor is the position of the last item on a page. It's given to clients as an opaque string
+*/
+type PageCursor struct {
+	Sort       string          `json:"s"`
+	Descending bool            `json:"d,omitempty"`
+	ID         int             `json:"i"`
+	Value      json.RawMessage `json:"v"`
+}
+
+/*
+ParsePageRequest creates a page request from the query parameters limit, sort and cursor.
+The sort can be prefixed with "-" for descending order
+*/
+func ParsePageRequest(query url.Values, defaultLimit int, defaultSort string) (PageRequest, error) {
+	page := PageRequest{Limit: defaultLimit, Sort: defaultSort}
+
+	if param := query.Get("limit"); param != "" {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit < 1 {
+			return page, fmt.Errorf("invalid 'limit' given")
+		}
+		page.Limit = Min(limit, MaxPageLimit)
+	}
+
+	if param := query.Get("sort"); param != "" {
+		page.Descending = strings.HasPrefix(param, "-")
+		page.Sort = strings.TrimPrefix(param, "-")
+	}
+	if _, ok := sortFields[page.Sort]; !ok {
+		return page, fmt.Errorf("invalid 'sort' given, has to be one of id, timestamp, date and length")
+	}
+
+	if param := query.Get("cursor"); param != "" {
+		cursor, err := DecodeCursor(param)
+		if err != nil || cursor.Sort != page.Sort || cursor.Descending != page.Descending {
+			return page, ErrInvalidCursor
+		}
+		if _, err := sortFields[page.Sort].decode(cursor.Value); err != nil { // The value has to match the sort field
+			return page, ErrInvalidCursor
+		}
+		page.Cursor = &cursor
+	}
+
+	return page, nil
+}
+
+/*
+NewCursor returns the cursor positioned at the given track
+*/
+func (p PageRequest) NewCursor(t TrackInfo) string {
+	value, _ := json.Marshal(sortFields[p.Sort].value(t))
+	raw, _ := json.Marshal(PageCursor{Sort: p.Sort, Descending: p.Descending, ID: t.ID, Value: value})
+
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+/*
+DecodeCursor decodes a cursor given by a client
+*/
+func DecodeCursor(s string) (PageCursor, error) {
+	var cursor PageCursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err = json.Unmarshal(raw, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+/*
+Query returns the mongo query selecting the items after the cursor, and the sort order to use
+*/
+func (p PageRequest) Query(filter TrackFilter) (bson.M, []string, error) {
+	field := sortFields[p.Sort]
+
+	order := []string{field.key, "id"}
+	comparison := "$gt"
+	if p.Descending {
+		order = []string{"-" + field.key, "-id"}
+		comparison = "$lt"
+	}
+
+	if p.Cursor == nil {
+		return filter.Query(), order, nil
+	}
+
+	value, err := field.decode(p.Cursor.Value)
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	// Items with the same value as the cursor are ordered by ID, so the ID breaks the tie
+	after := bson.M{"$or": []bson.M{
+		{field.key: bson.M{comparison: value}},
+		{field.key: value, "id": bson.M{comparison: p.Cursor.ID}},
+	}}
+
+	return bson.M{"$and": []bson.M{filter.Query(), after}}, order, nil
+}
+
+/*
+Compare orders two tracks according to the page's sort, returns a negative number if a comes first
+*/
+func (p PageRequest) Compare(a, b TrackInfo) int {
+	c := sortFields[p.Sort].compare(a, b)
+	if c == 0 {
+		c = compareFloat(float64(a.ID), float64(b.ID))
+	}
+	if p.Descending {
+		c = -c
+	}
+
+	return c
+}
+
+/*
+After returns if the track comes after the cursor of the page
+*/
+func (p PageRequest) After(t TrackInfo) (bool, error) {
+	if p.Cursor == nil {
+		return true, nil
+	}
+
+	value, err := sortFields[p.Sort].decode(p.Cursor.Value)
+	if err != nil {
+		return false, ErrInvalidCursor
+	}
+
+	// Create a track at the cursor position, so the normal comparison can be used
+	cursorTrack := TrackInfo{ID: p.Cursor.ID}
+	switch v := value.(type) {
+	case int:
+		cursorTrack.ID = v
+	case int64:
+		cursorTrack.Timestamp = v
+	case time.Time:
+		cursorTrack.HDate = v
+	case float64:
+		cursorTrack.TrackLength = v
+	}
+
+	return p.Compare(t, cursorTrack) > 0, nil
+}
+
+// cut removes the item fetched to know if there is a next page, and returns the cursor of the next page
+func (p PageRequest) cut(tracks []TrackInfo) ([]TrackInfo, string) {
+	if len(tracks) <= p.Limit {
+		return tracks, ""
+	}
+
+	tracks = tracks[:p.Limit]
+	return tracks, p.NewCursor(tracks[len(tracks)-1])
+}
+
+/*
+SetLinkHeader adds a Link header pointing to the next page, if there is one
+*/
+func SetLinkHeader(w http.ResponseWriter, r *http.Request, nextCursor string) {
+	if nextCursor == "" {
+		return
+	}
+
+	query := r.URL.Query()
+	query.Set("cursor", nextCursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
+}
+
+// compareFloat returns -1, 0 or 1 if a is smaller than, equal to or larger than b
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,206 @@
+package igcapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// collectPages follows the cursors through every page, and returns the IDs in the order they were returned
+func collectPages(t *testing.T, storage TrackStorage, rawQuery string) []int {
+	IDs := []int{}
+	cursor := ""
+
+	for pages := 0; pages < 10; pages++ {
+		query, _ := url.ParseQuery(rawQuery)
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+
+		page, err := ParsePageRequest(query, 2, "id")
+		if err != nil {
+			t.Errorf("Couldn't parse '%s': %s", rawQuery, err)
+			return IDs
+		}
+
+		tracks, next, err := storage.FindPage(TrackFilter{}, page)
+		if err != nil {
+			t.Errorf("Couldn't get the page: %s", err)
+			return IDs
+		}
+		for _, track := range tracks {
+			IDs = append(IDs, track.ID)
+		}
+
+		if next == "" {
+			return IDs
+		}
+		cursor = next
+	}
+
+	t.Error("The pages never ended")
+	return IDs
+}
+
+// Tests that following the cursors returns every track once, in the right order
+func Test_findPage_sorting(t *testing.T) {
+	memoryDB := testTrackDB(filterTestTracks...)
+	memoryDB.Add(TrackInfo{ID: 4, Pilot: "Carl", TrackLength: 80, TrackSourceURL: "d"}) // Same length as track 3
+
+	tests := map[string][]int{
+		"":                   {1, 2, 3, 4},
+		"sort=-id":           {4, 3, 2, 1},
+		"sort=length":        {1, 3, 4, 2},
+		"sort=-length":       {2, 4, 3, 1},
+		"sort=date":          {4, 1, 2, 3},
+		"limit=1":            {1, 2, 3, 4},
+		"limit=3&sort=-date": {3, 2, 1, 4},
+	}
+
+	for rawQuery, expected := range tests {
+		if IDs := collectPages(t, memoryDB, rawQuery); !reflect.DeepEqual(IDs, expected) {
+			t.Errorf("'%s': expected %v, got %v", rawQuery, expected, IDs)
+		}
+	}
+}
+
+// Tests that invalid limits, sorts and cursors are refused
+func Test_parsePageRequest_invalid(t *testing.T) {
+	page := PageRequest{Limit: 1, Sort: "length"}
+	lengthCursor := page.NewCursor(TrackInfo{ID: 1, TrackLength: 10})
+
+	for _, rawQuery := range []string{"limit=0", "limit=many", "sort=pilot", "cursor=garbage", "sort=id&cursor=" + lengthCursor} {
+		query, _ := url.ParseQuery(rawQuery)
+		if _, err := ParsePageRequest(query, 5, "id"); err == nil {
+			t.Errorf("'%s' was accepted", rawQuery)
+		}
+	}
+
+	query, _ := url.ParseQuery("limit=100000")
+	if page, _ := ParsePageRequest(query, 5, "id"); page.Limit != MaxPageLimit {
+		t.Errorf("Expected the limit to be capped at %d, got %d", MaxPageLimit, page.Limit)
+	}
+}
+
+// Tests that a cursor with a value of the wrong type for the sort gives 400 instead of an error when searching
+func Test_handlerTrack_invalidCursor(t *testing.T) {
+	db = testTrackDB(filterTestTracks...)
+	defer func() { db = nil }()
+
+	cursor := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","i":1,"v":"x"}`))
+	w := httptest.NewRecorder()
+	NewRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/paragliding/api/track/?cursor="+cursor, nil))
+
+	var problem APIError
+	json.NewDecoder(w.Body).Decode(&problem)
+	if w.Code != http.StatusBadRequest || problem.Code != CodeInvalidParameter {
+		t.Errorf("Expected 400 with the code %s, got %d with '%s'", CodeInvalidParameter, w.Code, problem.Code)
+	}
+}
+
+// Tests that /paragliding/api/track/ is paged, with a Link header to the next page
+func Test_handlerTrack_paging(t *testing.T) {
+	db = testTrackDB(filterTestTracks...)
+	defer func() { db = nil }()
+
+	testServer := httptest.NewServer(NewRouter())
+	defer testServer.Close()
+
+	response, err := http.Get(testServer.URL + "/paragliding/api/track/?limit=2")
+	if err != nil {
+		t.Errorf("Error with constructing GET method. %s", err)
+		return
+	}
+
+	var IDs []int
+	json.NewDecoder(response.Body).Decode(&IDs)
+	if !reflect.DeepEqual(IDs, []int{1, 2}) {
+		t.Errorf("Expected [1 2], got %v", IDs)
+	}
+
+	link := response.Header.Get("Link")
+	if link == "" {
+		t.Error("No Link header on the first page")
+		return
+	}
+
+	next := link[1 : len(link)-len(`>; rel="next"`)]
+	response, err = http.Get(testServer.URL + next)
+	if err != nil {
+		t.Errorf("Error with constructing GET method. %s", err)
+		return
+	}
+
+	IDs = nil
+	json.NewDecoder(response.Body).Decode(&IDs)
+	if !reflect.DeepEqual(IDs, []int{3}) {
+		t.Errorf("Expected [3], got %v", IDs)
+	}
+	if response.Header.Get("Link") != "" {
+		t.Error("Link header on the last page")
+	}
+}
+
+// Tests that the ticker pages through the tracks added after a timestamp
+func Test_handlerTicker_paging(t *testing.T) {
+	memoryDB := &TrackMemoryDB{}
+	for i := 1; i <= 7; i++ {
+		memoryDB.Add(TrackInfo{ID: i, Timestamp: int64(1000 + i)})
+	}
+	db = memoryDB
+	defer func() { db = nil }()
+
+	testServer := httptest.NewServer(NewRouter())
+	defer testServer.Close()
+
+	response, err := http.Get(testServer.URL + "/paragliding/api/ticker/1001")
+	if err != nil {
+		t.Errorf("Error with constructing GET method. %s", err)
+		return
+	}
+
+	ticker := make(map[string]interface{})
+	json.NewDecoder(response.Body).Decode(&ticker)
+
+	if !reflect.DeepEqual(ticker["tracks"], []interface{}{2.0, 3.0, 4.0, 5.0, 6.0}) {
+		t.Errorf("Expected tracks 2 to 6, got %v", ticker["tracks"])
+	}
+	if ticker["t_latest"] != 1007.0 || ticker["t_start"] != 1002.0 || ticker["t_stop"] != 1006.0 {
+		t.Errorf("Unexpected timestamps: %v", ticker)
+	}
+	if response.Header.Get("Link") == "" {
+		t.Error("No Link header to the last track")
+	}
+}
+
+// Tests that the ticker returns an empty ticker instead of text when no tracks are in the window
+func Test_handlerTicker_empty(t *testing.T) {
+	memoryDB := &TrackMemoryDB{}
+	memoryDB.Add(TrackInfo{ID: 1, Timestamp: 1001})
+	db = memoryDB
+	defer func() { db = nil }()
+
+	for _, path := range []string{"/paragliding/api/ticker/1001", "/paragliding/api/ticker/?since=2000", "/paragliding/api/ticker/?until=1000&pilot=anna"} {
+		w := httptest.NewRecorder()
+		NewRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var ticker Ticker
+		if err := json.NewDecoder(w.Body).Decode(&ticker); err != nil || w.Code != http.StatusOK {
+			t.Errorf("%s: expected a JSON ticker, got %d (%v)", path, w.Code, err)
+			continue
+		}
+		if ticker.Tracks == nil || len(ticker.Tracks) != 0 || ticker.TLatest != 1001 {
+			t.Errorf("%s: expected no tracks and the latest timestamp, got %+v", path, ticker)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	NewRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/paragliding/api/ticker/?since=later", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid since, got %d", w.Code)
+	}
+}
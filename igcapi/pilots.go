@@ -0,0 +1,135 @@
+package igcapi
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+var pilotAliases = make(map[string]string) // Normalized alias -> normalized name
+
+/*
+Pilot is the profile of a pilot, aggregated from the pilot's tracks
+*/
+type Pilot struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Flights   int      `json:"flights"`
+	Airtime   int64    `json:"airtime"`  // Seconds
+	Distance  float64  `json:"distance"` // The sum of the track lengths, in km
+	BestScore float64  `json:"best_score"`
+	Gliders   []string `json:"gliders"`
+}
+
+/*
+NormalizePilotName lowercases the name and collapses whitespace, and replaces it with the name it's an alias of
+*/
+func NormalizePilotName(name string) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	if alias, ok := pilotAliases[normalized]; ok {
+		return alias
+	}
+
+	return normalized
+}
+
+/*
+PilotID returns the ID of the pilot with the given name, made from the normalized name ("Miguel  Angel" -> "miguel-angel")
+*/
+func PilotID(name string) string {
+	normalized := NormalizePilotName(name)
+	if normalized == "" {
+		return ""
+	}
+
+	id := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '-'
+	}, normalized)
+
+	return strings.Trim(id, "-")
+}
+
+/*
+ParsePilotAliases parses aliases given as "alias=name;alias=name", and returns them normalized
+*/
+func ParsePilotAliases(s string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid alias '%s', has to be alias=name", pair)
+		}
+
+		alias := strings.Join(strings.Fields(strings.ToLower(parts[0])), " ")
+		name := strings.Join(strings.Fields(strings.ToLower(parts[1])), " ")
+		aliases[alias] = name
+	}
+
+	return aliases, nil
+}
+
+/*
+AddTrack adds a track to the pilot's totals
+*/
+func (p *Pilot) AddTrack(t TrackInfo) {
+	if p.Name == "" {
+		p.Name = strings.Join(strings.Fields(t.Pilot), " ")
+	}
+
+	p.Flights++
+	p.Airtime += t.Airtime
+	p.Distance += t.TrackLength
+	p.BestScore = math.Max(p.BestScore, t.Score)
+
+	if t.Glider == "" {
+		return
+	}
+	for _, glider := range p.Gliders {
+		if glider == t.Glider {
+			return
+		}
+	}
+	p.Gliders = append(p.Gliders, t.Glider)
+}
+
+/*
+CalculatePilot calculates the profile of a pilot from all the pilot's tracks
+*/
+func CalculatePilot(id string, tracks []TrackInfo) Pilot {
+	pilot := Pilot{ID: id, Gliders: []string{}}
+	for _, track := range tracks {
+		pilot.AddTrack(track)
+	}
+
+	return pilot
+}
+
+/*
+RecalculatePilot recalculates and stores the profile of a pilot from the stored tracks,
+used when tracks are changed and the totals can't be updated incrementally
+*/
+func RecalculatePilot(id string) {
+	if id == "" {
+		return
+	}
+
+	tracks, err := db.Find(TrackFilter{PilotID: id})
+	if err != nil {
+		fmt.Printf("Couldn't retrieve the tracks of pilot %s: %s\n", id, err.Error())
+		return
+	}
+
+	if len(tracks) == 0 {
+		pilotDB.Delete(id)
+		return
+	}
+	pilotDB.Set(CalculatePilot(id, tracks))
+}
@@ -0,0 +1,70 @@
+package igcapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Tests that differently written names of a pilot give the same ID
+func Test_pilotID(t *testing.T) {
+	defer func(aliases map[string]string) { pilotAliases = aliases }(pilotAliases)
+
+	aliases, err := ParsePilotAliases("J. Doe = John Doe; jd=john doe")
+	if err != nil {
+		t.Errorf("Couldn't parse the aliases: %s", err)
+		return
+	}
+	pilotAliases = aliases
+
+	for _, name := range []string{"John Doe", "  JOHN   doe ", "J. Doe", "jd"} {
+		if id := PilotID(name); id != "john-doe" {
+			t.Errorf("'%s': expected the ID john-doe, got '%s'", name, id)
+		}
+	}
+	if id := PilotID("Miguel Ángel"); id != "miguel-ángel" {
+		t.Errorf("Expected the ID miguel-ángel, got '%s'", id)
+	}
+	if id := PilotID("   "); id != "" {
+		t.Errorf("Expected an empty ID, got '%s'", id)
+	}
+
+	if _, err = ParsePilotAliases("no equals sign"); err == nil {
+		t.Error("An alias without a name was accepted")
+	}
+}
+
+// Tests the totals of a pilot
+func Test_calculatePilot(t *testing.T) {
+	tracks := []TrackInfo{
+		{Pilot: "John  Doe", Glider: "Ozone Rush", TrackLength: 40, Airtime: 3600, Score: 35},
+		{Pilot: "john doe", Glider: "Gin Bolero", TrackLength: 80, Airtime: 7200, Score: 90},
+		{Pilot: "JOHN DOE", Glider: "Ozone Rush", TrackLength: 10, Airtime: 600, Score: 8},
+	}
+
+	pilot := CalculatePilot("john-doe", tracks)
+	expected := Pilot{
+		ID:        "john-doe",
+		Name:      "John Doe",
+		Flights:   3,
+		Airtime:   11400,
+		Distance:  130,
+		BestScore: 90,
+		Gliders:   []string{"Ozone Rush", "Gin Bolero"},
+	}
+	if !reflect.DeepEqual(pilot, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, pilot)
+	}
+}
+
+// Tests searching for the tracks of a pilot
+func Test_findIDs_pilot(t *testing.T) {
+	memoryDB := &TrackMemoryDB{}
+	memoryDB.Add(TrackInfo{ID: 1, TrackSourceURL: "a", PilotID: "john-doe"})
+	memoryDB.Add(TrackInfo{ID: 2, TrackSourceURL: "b", PilotID: "jane-doe"})
+	memoryDB.Add(TrackInfo{ID: 3, TrackSourceURL: "c", PilotID: "john-doe"})
+
+	IDs, _ := memoryDB.FindIDs(TrackFilter{PilotID: "john-doe"})
+	if !reflect.DeepEqual(IDs, []int{1, 3}) {
+		t.Errorf("Expected [1 3], got %v", IDs)
+	}
+}
@@ -0,0 +1,162 @@
+package igcapi
+
+import (
+	"math"
+	"time"
+
+	igc "github.com/marni/goigc"
+)
+
+const earthRadiusMeters = 6371000.0
+
+/*
+TrackPoint is a single GPS fix of a track
+*/
+type TrackPoint struct {
+	Time     time.Time `json:"time"`
+	Lat      float64   `json:"lat"`
+	Lng      float64   `json:"lng"`
+	Altitude int64     `json:"altitude"`
+}
+
+/*
+TrackPoints contains all the fixes of a track, stored separately from the track information
+*/
+type TrackPoints struct {
+	TrackID int          `json:"track_id"`
+	Points  []TrackPoint `json:"points"`
+}
+
+/*
+NewTrackPoints converts the fixes of a parsed track. The pressure altitude is used if it's
+recorded, otherwise the GNSS altitude. The fixes only have the time of day, so they are dated
+with the date of the track, and a day later for each time the flight passes midnight (UTC)
+*/
+func NewTrackPoints(parsedTrack igc.Track) []TrackPoint {
+	day := parsedTrack.Date
+	var previous time.Time
+
+	points := make([]TrackPoint, 0, len(parsedTrack.Points))
+	for _, p := range parsedTrack.Points {
+		altitude := p.PressureAltitude
+		if altitude == 0 {
+			altitude = p.GNSSAltitude
+		}
+
+		fixTime := time.Date(day.Year(), day.Month(), day.Day(), p.Time.Hour(), p.Time.Minute(), p.Time.Second(), p.Time.Nanosecond(), time.UTC)
+		if !previous.IsZero() && previous.Sub(fixTime) > 12*time.Hour { // Passed midnight, not just a fix out of order
+			day = day.AddDate(0, 0, 1)
+			fixTime = fixTime.AddDate(0, 0, 1)
+		}
+		previous = fixTime
+
+		points = append(points, TrackPoint{
+			Time:     fixTime,
+			Lat:      p.Lat.Degrees(),
+			Lng:      p.Lng.Degrees(),
+			Altitude: altitude,
+		})
+	}
+
+	return points
+}
+
+/*
+FilterPointsByTime returns the points in the time window [from, to]. A zero time means no limit
+*/
+func FilterPointsByTime(points []TrackPoint, from, to time.Time) []TrackPoint {
+	filtered := []TrackPoint{}
+	for _, p := range points {
+		if (!from.IsZero() && p.Time.Before(from)) || (!to.IsZero() && p.Time.After(to)) {
+			continue
+		}
+		filtered = append(filtered, p)
+	}
+
+	return filtered
+}
+
+/*
+ResamplePoints returns the points so that there is at least interval between each of them.
+The first and last point is always kept
+*/
+func ResamplePoints(points []TrackPoint, interval time.Duration) []TrackPoint {
+	if len(points) <= 2 || interval <= 0 {
+		return points
+	}
+
+	resampled := []TrackPoint{points[0]}
+	for _, p := range points[1 : len(points)-1] {
+		if p.Time.Sub(resampled[len(resampled)-1].Time) >= interval {
+			resampled = append(resampled, p)
+		}
+	}
+
+	return append(resampled, points[len(points)-1])
+}
+
+/*
+SimplifyPoints simplifies the path with the Douglas-Peucker algorithm, removing points closer
+than tolerance (in meters) to the simplified path. The first and last point is always kept
+*/
+func SimplifyPoints(points []TrackPoint, tolerance float64) []TrackPoint {
+	if len(points) <= 2 || tolerance <= 0 {
+		return points
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	// An explicit stack is used instead of recursion, as tracks can have tens of thousands of points
+	type segment struct{ first, last int }
+	stack := []segment{{0, len(points) - 1}}
+
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		maxDistance, index := 0.0, -1
+		for i := s.first + 1; i < s.last; i++ {
+			d := distanceToSegment(points[i], points[s.first], points[s.last])
+			if d > maxDistance {
+				maxDistance, index = d, i
+			}
+		}
+
+		if index != -1 && maxDistance > tolerance {
+			keep[index] = true
+			stack = append(stack, segment{s.first, index}, segment{index, s.last})
+		}
+	}
+
+	simplified := []TrackPoint{}
+	for i, p := range points {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+
+	return simplified
+}
+
+// distanceToSegment returns the distance in meters from p to the line segment between a and b.
+// An equirectangular projection around a is used, which is accurate enough for the short segments of a track
+func distanceToSegment(p, a, b TrackPoint) float64 {
+	toXY := func(q TrackPoint) (float64, float64) {
+		x := (q.Lng - a.Lng) * math.Pi / 180 * math.Cos(a.Lat*math.Pi/180) * earthRadiusMeters
+		y := (q.Lat - a.Lat) * math.Pi / 180 * earthRadiusMeters
+		return x, y
+	}
+
+	px, py := toXY(p)
+	bx, by := toXY(b)
+
+	lengthSquared := bx*bx + by*by
+	if lengthSquared == 0 {
+		return math.Hypot(px, py)
+	}
+
+	// Project p onto the segment, clamped to the end points
+	t := math.Max(0, math.Min(1, (px*bx+py*by)/lengthSquared))
+	return math.Hypot(px-t*bx, py-t*by)
+}
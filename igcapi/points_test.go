@@ -0,0 +1,121 @@
+package igcapi
+
+import (
+	"testing"
+	"time"
+
+	igc "github.com/marni/goigc"
+)
+
+// testPoints returns a straight line north with one fix every second, and a detour east in the middle
+func testPoints() []TrackPoint {
+	start := time.Date(2016, 2, 19, 11, 0, 0, 0, time.UTC)
+	points := []TrackPoint{}
+	for i := 0; i < 11; i++ {
+		p := TrackPoint{Time: start.Add(time.Duration(i) * time.Second), Lat: 52.0 + float64(i)*0.001, Lng: 0}
+		if i == 5 {
+			p.Lng = 0.01 // About 685 meters east of the line
+		}
+		points = append(points, p)
+	}
+
+	return points
+}
+
+// Tests that points on a straight line are removed, and that the detour is kept
+func Test_simplifyPoints(t *testing.T) {
+	simplified := SimplifyPoints(testPoints(), 100)
+
+	// The first and last point, the detour and the points on each side of it
+	if len(simplified) != 5 {
+		t.Errorf("Expected 5 points, got %d", len(simplified))
+		return
+	}
+	if simplified[2].Lng != 0.01 {
+		t.Errorf("The detour was not kept: %+v", simplified[2])
+	}
+
+	if len(SimplifyPoints(testPoints(), 1000)) != 2 { // The detour is within the tolerance
+		t.Error("Expected only the first and last point with a large tolerance")
+	}
+}
+
+// Tests that resampling keeps one point per interval, including the first and last point
+func Test_resamplePoints(t *testing.T) {
+	resampled := ResamplePoints(testPoints(), 3*time.Second)
+
+	expected := []int{0, 3, 6, 9, 10}
+	if len(resampled) != len(expected) {
+		t.Errorf("Expected %d points, got %d", len(expected), len(resampled))
+		return
+	}
+
+	start := testPoints()[0].Time
+	for i, p := range resampled {
+		if p.Time.Sub(start) != time.Duration(expected[i])*time.Second {
+			t.Errorf("Point %d is at %v, expected %ds", i, p.Time.Sub(start), expected[i])
+		}
+	}
+}
+
+// testIGCPoints is a flight on 19 February 2016 that lands after midnight
+const testIGCPoints = `AXXXABCFLIGHT:1
+HFDTE190216
+HFPLTPILOT:Test Pilot
+B2358005206343N00006198WA0058700558
+B2359005206443N00006198WA0058700558
+B2359305206543N00006198WA0058700558
+B0000005206643N00006198WA0058700558
+B0001005206743N00006198WA0058700558
+`
+
+// Tests that the fixes are dated with the date of the track, and the next day after midnight
+func Test_newTrackPoints(t *testing.T) {
+	parsedTrack, err := igc.Parse(testIGCPoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := NewTrackPoints(parsedTrack)
+
+	expected := []time.Time{
+		time.Date(2016, 2, 19, 23, 58, 0, 0, time.UTC),
+		time.Date(2016, 2, 19, 23, 59, 0, 0, time.UTC),
+		time.Date(2016, 2, 19, 23, 59, 30, 0, time.UTC),
+		time.Date(2016, 2, 20, 0, 0, 0, 0, time.UTC),
+		time.Date(2016, 2, 20, 0, 1, 0, 0, time.UTC),
+	}
+	if len(points) != len(expected) {
+		t.Fatalf("Expected %d points, got %d", len(expected), len(points))
+	}
+	for i, p := range points {
+		if !p.Time.Equal(expected[i]) {
+			t.Errorf("Expected point %d at %v, got %v", i, expected[i], p.Time)
+		}
+	}
+
+	if airtime := Airtime(points); airtime != 180 {
+		t.Errorf("Expected 180 seconds of airtime, got %d", airtime)
+	}
+}
+
+// Tests that only the points within the time window are returned
+func Test_filterPointsByTime(t *testing.T) {
+	parsedTrack, err := igc.Parse(testIGCPoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := NewTrackPoints(parsedTrack)
+
+	from := time.Date(2016, 2, 19, 23, 59, 0, 0, time.UTC)
+	to := time.Date(2016, 2, 20, 0, 0, 0, 0, time.UTC)
+	if filtered := FilterPointsByTime(points, from, to); len(filtered) != 3 {
+		t.Errorf("Expected 3 points, got %d", len(filtered))
+	}
+	if filtered := FilterPointsByTime(points, to, time.Time{}); len(filtered) != 2 {
+		t.Errorf("Expected the 2 points after midnight, got %d", len(filtered))
+	}
+
+	if len(FilterPointsByTime(points, time.Time{}, time.Time{})) != len(points) {
+		t.Error("Points were removed without a time window")
+	}
+}
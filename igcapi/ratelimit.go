@@ -0,0 +1,237 @@
+package igcapi
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxMemoryBuckets = 10000 // Full buckets are removed from memory when there are more buckets than this
+)
+
+/*
+The budgets requests are counted against, every client has a bucket for each budget
+*/
+const (
+	BudgetRead    = "read"
+	BudgetUpload  = "upload"  // Uploads make the server fetch the URL, so they get a smaller budget
+	BudgetWebhook = "webhook" // Webhook registrations
+)
+
+var (
+	rateLimits = map[string]RateLimit{
+		BudgetRead:    {Requests: 120, Per: time.Minute},
+		BudgetUpload:  {Requests: 10, Per: time.Minute},
+		BudgetWebhook: {Requests: 5, Per: time.Hour},
+	}
+	rateLimitStore  RateLimitStore = &RateLimitMemoryStore{}
+	trustedProxies  int            // The amount of proxies in front of the server adding to X-Forwarded-For (1 on Heroku), 0 ignores the header
+	rateLimitsMutex sync.RWMutex
+)
+
+/*
+RateLimit is a token bucket which holds Requests tokens, and is refilled with Requests tokens every Per
+*/
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+/*
+MethodBudgets maps request methods to the budget they are counted against, "*" is used for the
+methods that aren't in the map. Without "*" the methods that aren't in the map aren't limited
+*/
+type MethodBudgets map[string]string
+
+/*
+RateLimitStore stores the token buckets. Take takes a token from the bucket, and returns if there was one,
+and if not how long it takes until there is
+*/
+type RateLimitStore interface {
+	Take(key string, limit RateLimit, now time.Time) (bool, time.Duration)
+}
+
+/*
+ParseRateLimit parses a limit given as "<requests>/<duration>", e.g "10/1m"
+*/
+func ParseRateLimit(s string) (RateLimit, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit '%s', has to be <requests>/<duration>", s)
+	}
+
+	requests, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || requests < 1 {
+		return RateLimit{}, fmt.Errorf("invalid amount of requests in '%s'", s)
+	}
+	per, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || per <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid duration in '%s'", s)
+	}
+
+	return RateLimit{Requests: requests, Per: per}, nil
+}
+
+/*
+SetRateLimit sets the limit of a budget
+*/
+func SetRateLimit(budget string, limit RateLimit) {
+	rateLimitsMutex.Lock()
+	defer rateLimitsMutex.Unlock()
+
+	rateLimits[budget] = limit
+}
+
+/*
+Refill returns the amount of tokens in a bucket with the given tokens after the elapsed time
+*/
+func (l RateLimit) Refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	return math.Min(float64(l.Requests), tokens+elapsed.Seconds()*float64(l.Requests)/l.Per.Seconds())
+}
+
+/*
+Wait returns how long it takes until a bucket with the given tokens has a whole token
+*/
+func (l RateLimit) Wait(tokens float64) time.Duration {
+	return time.Duration((1 - tokens) * float64(l.Per) / float64(l.Requests))
+}
+
+/*
+ClientKey returns what the client is identified by: the ID of its API key, or its IP address
+*/
+func ClientKey(r *http.Request) string {
+	if key, ok := RequestAPIKey(r); ok {
+		return "key:" + key.ID
+	}
+
+	if client, ok := ForwardedClient(r, trustedProxies); ok {
+		return "ip:" + client
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+/*
+ForwardedClient returns the client address X-Forwarded-For was given by the trusted proxies. Every proxy appends
+the address it got the request from, so the client is the entry added by the outermost proxy, counted from
+the right. The entries before it are set by the client and can't be trusted
+*/
+func ForwardedClient(r *http.Request, proxies int) (string, bool) {
+	if proxies < 1 {
+		return "", false
+	}
+
+	var entries []string
+	for _, header := range r.Header["X-Forwarded-For"] { // Proxies can add their own header instead of appending
+		for _, entry := range strings.Split(header, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if len(entries) < proxies {
+		return "", false
+	}
+
+	return entries[len(entries)-proxies], true
+}
+
+/*
+RateLimited wraps a handler so requests are counted against the budget of their method.
+Requests over the budget get 429, with Retry-After set to the seconds until the next request is allowed
+*/
+func RateLimited(budgets MethodBudgets, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = WithAPIKey(r) // Kept for RequireRoles
+		budget, ok := budgets[r.Method]
+		if !ok {
+			budget, ok = budgets["*"]
+		}
+
+		rateLimitsMutex.RLock()
+		limit, limited := rateLimits[budget]
+		rateLimitsMutex.RUnlock()
+
+		if !ok || !limited {
+			next(w, r)
+			return
+		}
+
+		if allowed, wait := rateLimitStore.Take(budget+":"+ClientKey(r), limit, time.Now()); !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			WriteError(w, r, NewAPIError(http.StatusTooManyRequests, CodeRateLimited, "Too many requests, the budget '"+budget+"' is used up").
+				WithDetails(map[string]int{"retry_after": retryAfter}))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+/*
+RateLimitMemoryStore stores the token buckets in memory. It's only correct with one server, as the other
+servers have their own buckets
+*/
+type RateLimitMemoryStore struct {
+	mutex   sync.Mutex
+	buckets map[string]tokenBucket
+}
+
+type tokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+	Limit   RateLimit
+}
+
+/*
+Take takes a token from the bucket with the key
+*/
+func (s *RateLimitMemoryStore) Take(key string, limit RateLimit, now time.Time) (bool, time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.buckets == nil {
+		s.buckets = make(map[string]tokenBucket)
+	}
+	if len(s.buckets) > maxMemoryBuckets { // Full buckets are the same as new ones, so they can be removed
+		for k, b := range s.buckets {
+			if b.Limit.Refill(b.Tokens, now.Sub(b.Updated)) >= float64(b.Limit.Requests) {
+				delete(s.buckets, k)
+			}
+		}
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = tokenBucket{Tokens: float64(limit.Requests), Updated: now}
+	}
+	bucket.Tokens = limit.Refill(bucket.Tokens, now.Sub(bucket.Updated))
+	bucket.Updated = now
+	bucket.Limit = limit
+
+	if bucket.Tokens < 1 {
+		s.buckets[key] = bucket
+		return false, limit.Wait(bucket.Tokens)
+	}
+
+	bucket.Tokens--
+	s.buckets[key] = bucket
+
+	return true, 0
+}
@@ -0,0 +1,129 @@
+package igcapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Tests that the bucket is emptied by a burst, and refilled over time
+func Test_rateLimitMemoryStore(t *testing.T) {
+	store := &RateLimitMemoryStore{}
+	limit := RateLimit{Requests: 3, Per: 3 * time.Second}
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := store.Take("client", limit, now); !allowed {
+			t.Errorf("Request %d of the burst was refused", i+1)
+		}
+	}
+
+	allowed, wait := store.Take("client", limit, now)
+	if allowed || wait != time.Second {
+		t.Errorf("Expected the 4th request to wait 1s, got allowed: %v, wait: %v", allowed, wait)
+	}
+	if allowed, _ := store.Take("other client", limit, now); !allowed {
+		t.Error("Another client shared the bucket")
+	}
+
+	if allowed, _ := store.Take("client", limit, now.Add(time.Second)); !allowed {
+		t.Error("The bucket wasn't refilled after 1s")
+	}
+}
+
+// Tests that requests over the budget get 429 with Retry-After, and that budgets are separate
+func Test_rateLimited(t *testing.T) {
+	defer func(store RateLimitStore) { rateLimitStore = store }(rateLimitStore)
+	defer func(upload RateLimit) { SetRateLimit(BudgetUpload, upload) }(rateLimits[BudgetUpload])
+	rateLimitStore = &RateLimitMemoryStore{}
+	SetRateLimit(BudgetUpload, RateLimit{Requests: 1, Per: time.Minute})
+
+	handler := RateLimited(MethodBudgets{http.MethodPost: BudgetUpload, "*": BudgetRead}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	request := func(method string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/paragliding/api/track/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	if w := request(http.MethodPost); w.Code != http.StatusOK {
+		t.Errorf("Expected the first upload to be allowed, got %d", w.Code)
+	}
+	w := request(http.MethodPost)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected 429 with Retry-After 60, got %d with '%s'", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := request(http.MethodGet); w.Code != http.StatusOK {
+		t.Errorf("Expected reads to have their own budget, got %d", w.Code)
+	}
+}
+
+// Tests parsing limits
+func Test_parseRateLimit(t *testing.T) {
+	if limit, err := ParseRateLimit("10/1m"); err != nil || limit != (RateLimit{Requests: 10, Per: time.Minute}) {
+		t.Errorf("Unexpected limit %+v (error: %v)", limit, err)
+	}
+
+	for _, s := range []string{"10", "0/1m", "a/1m", "10/soon", "10/-1s"} {
+		if _, err := ParseRateLimit(s); err == nil {
+			t.Errorf("'%s' was accepted", s)
+		}
+	}
+}
+
+// Tests that clients are identified by the address the trusted proxies saw, not by the addresses they send themselves
+func Test_clientKey(t *testing.T) {
+	defer func(proxies int) { trustedProxies = proxies }(trustedProxies)
+
+	request := func(forwarded ...string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/paragliding/api/track/", nil)
+		r.RemoteAddr = "10.0.0.1:1234" // The proxy
+		for _, header := range forwarded {
+			r.Header.Add("X-Forwarded-For", header)
+		}
+		return r
+	}
+
+	tests := []struct {
+		proxies   int
+		forwarded []string
+		expected  string
+	}{
+		{0, []string{"192.0.2.1"}, "ip:10.0.0.1"},                          // The header isn't trusted
+		{1, []string{"192.0.2.1"}, "ip:192.0.2.1"},                         // Set by the proxy
+		{1, []string{"198.51.100.7, 192.0.2.1"}, "ip:192.0.2.1"},           // Spoofed by the client, then appended by the proxy
+		{1, []string{"198.51.100.7", "192.0.2.1"}, "ip:192.0.2.1"},         // The proxy added its own header
+		{2, []string{"198.51.100.7, 192.0.2.1, 10.0.0.2"}, "ip:192.0.2.1"}, // Two proxies
+		{2, []string{"192.0.2.1"}, "ip:10.0.0.1"},                          // Fewer entries than proxies
+		{1, nil, "ip:10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		trustedProxies = test.proxies
+		if key := ClientKey(request(test.forwarded...)); key != test.expected {
+			t.Errorf("Expected %s for %v with %d proxies, got %s", test.expected, test.forwarded, test.proxies, key)
+		}
+	}
+
+	// Spoofing the header doesn't give the client a new budget
+	defer func(store RateLimitStore) { rateLimitStore = store }(rateLimitStore)
+	defer func(upload RateLimit) { SetRateLimit(BudgetUpload, upload) }(rateLimits[BudgetUpload])
+	rateLimitStore = &RateLimitMemoryStore{}
+	SetRateLimit(BudgetUpload, RateLimit{Requests: 1, Per: time.Minute})
+	trustedProxies = 1
+
+	handler := RateLimited(MethodBudgets{"*": BudgetUpload}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for i, spoofed := range []string{"198.51.100.1, 192.0.2.1", "198.51.100.2, 192.0.2.1"} {
+		w := httptest.NewRecorder()
+		handler(w, request(spoofed))
+		if expected := []int{http.StatusOK, http.StatusTooManyRequests}[i]; w.Code != expected {
+			t.Errorf("Expected %d for request %d, got %d", expected, i+1, w.Code)
+		}
+	}
+}
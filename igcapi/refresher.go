@@ -0,0 +1,158 @@
+package igcapi
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+TrackRefresher re-fetches the source of every track periodically, and stores a new
+revision of the tracks whose file has changed. The interval can be set with the
+environment variable TRACK_REFRESH_INTERVAL (e.g "30m"), the default is 6 hours
+*/
+func TrackRefresher() {
+	delay := time.Hour * 6
+	if interval, ok := os.LookupEnv("TRACK_REFRESH_INTERVAL"); ok {
+		if d, err := time.ParseDuration(interval); err == nil && d > 0 {
+			delay = d
+		} else {
+			fmt.Println("Invalid TRACK_REFRESH_INTERVAL, using the default:", delay)
+		}
+	}
+
+	for {
+		time.Sleep(delay)
+		RefreshTracks()
+	}
+}
+
+/*
+RefreshTracks checks the source URL of every track once, and returns how many tracks got a new revision
+*/
+func RefreshTracks() int {
+	tracks, err := db.GetAll()
+	if err != nil {
+		fmt.Println("Error retrieving tracks to refresh:", err.Error())
+		return 0
+	}
+
+	updated := 0
+	for _, track := range tracks {
+		newTrack, points, changed, err := RefreshTrack(&fetcher, track)
+		if err != nil {
+			fmt.Printf("Couldn't refresh track %d: %s\n", track.ID, err.Error())
+			continue
+		}
+		if !changed {
+			// The same file with new validators, stored so the next refresh can be conditional
+			if newTrack.ETag != track.ETag || newTrack.LastModified != track.LastModified {
+				db.Update(newTrack)
+			}
+			continue
+		}
+
+		// The corrections made with PATCH are kept, the file has the same mistakes
+		edits, err := TrackEdits(track.ID)
+		if err != nil {
+			fmt.Printf("Couldn't retrieve the edits of track %d: %s\n", track.ID, err.Error())
+			continue
+		}
+		newTrack, _ = edits.Apply(newTrack)
+
+		if !storeOldRevision(track) {
+			fmt.Printf("Couldn't store the old revision of track %d\n", track.ID)
+			continue
+		}
+		if db.Update(newTrack) && revisionDB.Add(TrackRevision{
+			TrackID:     newTrack.ID,
+			Revision:    newTrack.Revision,
+			ContentHash: newTrack.ContentHash,
+			Timestamp:   time.Now().Unix(),
+			Track:       newTrack,
+		}) {
+			pointsDB.Set(newTrack.ID, points)
+			events.Publish(TrackUpdated{Before: track, After: newTrack})
+			updated++
+		}
+	}
+
+	return updated
+}
+
+// storeOldRevision stores the revision of the track before it's refreshed, if it isn't already.
+// Tracks added before revisions were kept have revision 0 and no stored revision, their file is revision 1
+func storeOldRevision(track TrackInfo) bool {
+	track.Revision = currentRevision(track)
+	revisions, err := revisionDB.GetAll(track.ID)
+	if err != nil {
+		return false
+	}
+	for _, revision := range revisions {
+		if revision.Revision == track.Revision {
+			return true
+		}
+	}
+
+	return revisionDB.Add(TrackRevision{
+		TrackID:     track.ID,
+		Revision:    track.Revision,
+		ContentHash: track.ContentHash,
+		Timestamp:   track.Timestamp,
+		Track:       track,
+	})
+}
+
+// currentRevision returns the revision of the track, revision 1 for tracks added before revisions were kept
+func currentRevision(track TrackInfo) int {
+	if track.Revision == 0 {
+		return 1
+	}
+	return track.Revision
+}
+
+/*
+RefreshTrack does a conditional fetch of the track's source URL. If the content has changed
+the re-parsed track is returned with the next revision number, along with its points. If only the validators
+changed, the track is returned with the new ETag and Last-Modified, and not as changed. Nothing is stored
+*/
+func RefreshTrack(f *Fetcher, track TrackInfo) (TrackInfo, []TrackPoint, bool, error) {
+	job := FetchJob{
+		URL:          track.TrackSourceURL,
+		ETag:         track.ETag,
+		LastModified: track.LastModified,
+	}
+
+	parsedTrack, content, err := f.FetchTrack(&job)
+	if err != nil {
+		return track, nil, false, fmt.Errorf("%s", strings.Join(job.Failures, "; "))
+	}
+
+	if job.Status == JobNotModified {
+		return track, nil, false, nil
+	}
+	// Servers without support for validators always send the file, so the hash decides if it changed
+	if job.ContentHash == track.ContentHash {
+		track.ETag = job.ETag
+		track.LastModified = job.LastModified
+		return track, nil, false, nil
+	}
+
+	newTrack := NewTrackInfo(parsedTrack, track.TrackSourceURL)
+	newTrack.ID = track.ID
+	newTrack.Timestamp = track.Timestamp // The ticker uses the timestamp of when the track was first added
+	newTrack.Revision = currentRevision(track) + 1
+	newTrack.ContentHash = job.ContentHash
+	newTrack.ETag = job.ETag
+	newTrack.LastModified = job.LastModified
+	newTrack.SignatureStatus = VerifySignature(content)
+
+	points := NewTrackPoints(parsedTrack)
+	SetGeometry(&newTrack, points)
+	newTrack.SiteID = track.SiteID // A corrected file rarely has another takeoff, so the site is kept
+	newTrack.Airtime = Airtime(points)
+	newTrack.Score = ScoreTrack(points)
+
+	return newTrack, points, true, nil
+}
@@ -0,0 +1,185 @@
+package igcapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Tests that an unchanged file gives no new revision, and that a changed file does
+func Test_refreshTrack(t *testing.T) {
+	content := testIGC
+	etag := `"v1"`
+	conditionalRequests := 0
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			conditionalRequests++
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, content)
+	}))
+	defer testServer.Close()
+
+	f := newTestFetcher()
+	job := FetchJob{URL: testServer.URL}
+	parsedTrack, _, err := f.FetchTrack(&job)
+	if err != nil {
+		t.Errorf("Fetching failed: %s", err)
+		return
+	}
+
+	track := NewTrackInfo(parsedTrack, testServer.URL)
+	track.ID = 3
+	track.Revision = 1
+	track.ContentHash = job.ContentHash
+	track.ETag = job.ETag
+
+	_, _, changed, err := RefreshTrack(f, track)
+	if err != nil || changed {
+		t.Errorf("Unchanged track was refreshed (changed: %v, err: %v)", changed, err)
+	}
+	if conditionalRequests != 1 {
+		t.Errorf("Expected 1 conditional request, got %d", conditionalRequests)
+	}
+
+	content = "AXXXABCFLIGHT:1\nHFDTE190216\nHFPLTPILOT:Corrected Pilot\nB1101355206343N00006198WA0058700558\n"
+	etag = `"v2"`
+
+	newTrack, points, changed, err := RefreshTrack(f, track)
+	if err != nil || !changed {
+		t.Errorf("Changed track was not refreshed (changed: %v, err: %v)", changed, err)
+		return
+	}
+
+	if newTrack.ID != 3 || newTrack.Revision != 2 || newTrack.ETag != `"v2"` {
+		t.Errorf("Unexpected refreshed track: %+v", newTrack)
+	}
+	if newTrack.Pilot != "Corrected Pilot" {
+		t.Errorf("Expected pilot 'Corrected Pilot', got '%s'", newTrack.Pilot)
+	}
+	if len(points) != 1 {
+		t.Errorf("Expected 1 point, got %d", len(points))
+	}
+	if newTrack.ContentHash == track.ContentHash {
+		t.Error("Content hash did not change")
+	}
+}
+
+// Tests that new validators of an unchanged file are stored, and that refreshing a track from before
+// revisions were kept stores its file as revision 1
+func Test_refreshTracks(t *testing.T) {
+	defer func(tracks TrackStorage, revisions RevisionStorage, points PointsStorage, f Fetcher) {
+		db, revisionDB, pointsDB, fetcher = tracks, revisions, points, f
+	}(db, revisionDB, pointsDB, fetcher)
+
+	content := testIGC
+	etag := `"v1"`
+	deleteWhileFetching := false
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if deleteWhileFetching {
+			db.Delete(3, 1000)
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, content)
+	}))
+	defer testServer.Close()
+
+	fetcher = *newTestFetcher()
+	job := FetchJob{URL: testServer.URL}
+	parsedTrack, _, err := fetcher.FetchTrack(&job)
+	if err != nil {
+		t.Fatalf("Fetching failed: %s", err)
+	}
+
+	track := NewTrackInfo(parsedTrack, testServer.URL)
+	track.ID = 3
+	track.ContentHash = job.ContentHash // Revision 0, no ETag
+	db = &TrackMemoryDB{}
+	db.Add(track)
+	revisionDB = &RevisionMemoryDB{}
+	pointsDB = &PointsMemoryDB{}
+
+	if updated := RefreshTracks(); updated != 0 {
+		t.Errorf("Expected the unchanged track not to be updated, got %d", updated)
+	}
+	if stored, _ := db.Get(3); stored.ETag != `"v1"` || stored.Revision != 0 {
+		t.Errorf("Expected the ETag \"v1\" to be stored, got %+v", stored)
+	}
+
+	content = "AXXXABCFLIGHT:1\nHFDTE190216\nHFPLTPILOT:Corrected Pilot\nB1101355206343N00006198WA0058700558\n"
+	etag = `"v2"`
+	if updated := RefreshTracks(); updated != 1 {
+		t.Errorf("Expected the changed track to be updated, got %d", updated)
+	}
+
+	revisions, _ := revisionDB.GetAll(3)
+	if len(revisions) != 2 || revisions[0].Revision != 1 || revisions[0].ContentHash != track.ContentHash ||
+		revisions[1].Revision != 2 || revisions[1].Track.Pilot != "Corrected Pilot" {
+		t.Errorf("Expected the revisions 1 and 2, got %+v", revisions)
+	}
+	if stored, _ := db.Get(3); stored.Revision != 2 || stored.ETag != `"v2"` {
+		t.Errorf("Expected revision 2 with the ETag \"v2\", got %+v", stored)
+	}
+
+	content = "AXXXABCFLIGHT:1\nHFDTE190216\nHFPLTPILOT:Third Pilot\nB1101355206343N00006198WA0058700558\n"
+	deleteWhileFetching = true
+	if updated := RefreshTracks(); updated != 0 {
+		t.Errorf("Expected the track deleted while fetching not to be updated, got %d", updated)
+	}
+	if _, found := db.Get(3); found {
+		t.Error("The track deleted while fetching was restored")
+	}
+}
+
+// Tests that the corrections made with PATCH are kept when a new revision of the file is fetched
+func Test_refreshTracks_edits(t *testing.T) {
+	defer func(tracks TrackStorage, revisions RevisionStorage, points PointsStorage, audit AuditStorage, f Fetcher) {
+		db, revisionDB, pointsDB, auditDB, fetcher = tracks, revisions, points, audit, f
+	}(db, revisionDB, pointsDB, auditDB, fetcher)
+
+	content := testIGC
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, content)
+	}))
+	defer testServer.Close()
+
+	fetcher = *newTestFetcher()
+	job := FetchJob{URL: testServer.URL}
+	parsedTrack, _, err := fetcher.FetchTrack(&job)
+	if err != nil {
+		t.Fatalf("Fetching failed: %s", err)
+	}
+
+	track := NewTrackInfo(parsedTrack, testServer.URL)
+	track.ID = 3
+	track.Revision = 1
+	track.ContentHash = job.ContentHash
+	db = &TrackMemoryDB{}
+	revisionDB = &RevisionMemoryDB{}
+	pointsDB = &PointsMemoryDB{}
+	auditDB = &AuditMemoryDB{}
+
+	pilot, gliderID := "Jane Doe", "LN-ABC"
+	edited, changes := TrackEdit{Pilot: &pilot, GliderID: &gliderID}.Apply(track)
+	db.Add(edited)
+	auditDB.Add(NewAuditEntry(3, AuditEdit, changes))
+
+	content = "AXXXABCFLIGHT:1\nHFDTE190216\nHFPLTPILOT:Corrected Pilot\nHFGTYGLIDERTYPE:Gin\nB1101355206343N00006198WA0058700558\n"
+	if updated := RefreshTracks(); updated != 1 {
+		t.Fatalf("Expected the changed track to be updated, got %d", updated)
+	}
+
+	stored, _ := db.Get(3)
+	if stored.Pilot != "Jane Doe" || stored.PilotID != "jane-doe" || stored.GliderID != "LN-ABC" || stored.GliderKey != NormalizeGliderID("LN-ABC") {
+		t.Errorf("Expected the edited pilot and glider ID to be kept, got %+v", stored)
+	}
+	if stored.Glider != "Gin" || stored.Revision != 2 {
+		t.Errorf("Expected the glider of revision 2, got %+v", stored)
+	}
+}
@@ -0,0 +1,252 @@
+package igcapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/*
+Router routes requests by method and path. Patterns are paths where segments can be parameters, "{name}"
+matches any segment and "{name:int}" only integers. Fixed segments are preferred over parameters, so the
+order routes are registered in doesn't matter. Trailing slashes are ignored, "/track/" and "/track" are the same.
+Paths that exist but not with the method get 405 with an Allow header, HEAD is answered by GET and OPTIONS with the allowed methods
+*/
+type Router struct {
+	root     *routeNode
+	routes   []Route
+	NotFound http.HandlerFunc // Used for paths that don't match any route, HandlerNotFound if not set
+}
+
+/*
+Route is a registered route
+*/
+type Route struct {
+	Method  string
+	Pattern string
+	Roles   MethodRoles // The roles the handler requires, nil for public routes
+}
+
+type routeNode struct {
+	children  map[string]*routeNode
+	param     *routeNode // The child matching any segment, there can only be one parameter at each position
+	paramName string
+	paramType string
+	pattern   string
+	methods   []string // In the order they were registered, for the Allow header
+	handlers  map[string]http.HandlerFunc
+}
+
+type pathParamsKey struct{}
+
+/*
+Handle registers the handler for the method and pattern. Registering the same method and pattern twice,
+or two parameters with different names at the same position, panics
+*/
+func (rt *Router) Handle(method, pattern string, handler http.HandlerFunc) {
+	rt.HandleRoles(method, pattern, nil, handler)
+}
+
+/*
+HandleRoles registers the handler like Handle, and records the roles it requires on its route.
+The router doesn't check the roles, the handler has to be wrapped in RequireRoles
+*/
+func (rt *Router) HandleRoles(method, pattern string, roles MethodRoles, handler http.HandlerFunc) {
+	if rt.root == nil {
+		rt.root = &routeNode{}
+	}
+
+	node := rt.root
+	for _, segment := range RemoveEmpty(strings.Split(pattern, "/")) {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			if node.children == nil {
+				node.children = make(map[string]*routeNode)
+			}
+			if node.children[segment] == nil {
+				node.children[segment] = &routeNode{}
+			}
+			node = node.children[segment]
+			continue
+		}
+
+		name, paramType := segment[1:len(segment)-1], ""
+		if i := strings.Index(name, ":"); i != -1 {
+			name, paramType = name[:i], name[i+1:]
+		}
+		if paramType != "" && paramType != "int" {
+			panic("router: unknown parameter type '" + paramType + "' in " + pattern)
+		}
+
+		if node.param == nil {
+			node.param = &routeNode{paramName: name, paramType: paramType}
+		} else if node.param.paramName != name || node.param.paramType != paramType {
+			panic("router: conflicting parameter '" + segment + "' in " + pattern)
+		}
+		node = node.param
+	}
+
+	if node.handlers == nil {
+		node.handlers = make(map[string]http.HandlerFunc)
+	}
+	if _, exists := node.handlers[method]; exists {
+		panic("router: " + method + " " + pattern + " is already registered")
+	}
+	node.handlers[method] = handler
+	node.methods = append(node.methods, method)
+	node.pattern = pattern
+
+	rt.routes = append(rt.routes, Route{Method: method, Pattern: pattern, Roles: roles})
+}
+
+/*
+Routes returns the registered routes, in the order they were registered
+*/
+func (rt *Router) Routes() []Route {
+	routes := make([]Route, len(rt.routes))
+	copy(routes, rt.routes)
+
+	return routes
+}
+
+/*
+ServeHTTP routes the request to its handler
+*/
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := make(map[string]string)
+	var node *routeNode
+	var invalid *routeNode
+	if rt.root != nil {
+		node, invalid = rt.root.match(RemoveEmpty(strings.Split(r.URL.Path, "/")), params)
+	}
+
+	if node == nil {
+		if rt.NotFound != nil {
+			rt.NotFound(w, r)
+		} else {
+			HandlerNotFound(w, r)
+		}
+		return
+	}
+
+	handler, ok := node.handlers[r.Method]
+	if !ok && r.Method == http.MethodHead {
+		if handler, ok = node.handlers[http.MethodGet]; ok {
+			w = headResponseWriter{w}
+		}
+	}
+	if !ok {
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", strings.Join(node.allowed(), ", "))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		methodNotAllowed(w, r, node.allowed()...)
+		return
+	}
+
+	if invalid != nil {
+		if invalid.paramName == "id" {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid ID type given")
+		} else {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "Invalid '"+invalid.paramName+"' given")
+		}
+		return
+	}
+
+	handler(w, r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, params)))
+}
+
+// match returns the node of the route matching the segments, and the parameter node whose value had the wrong
+// type if there was one. The paths of fixed segments are tried before parameters
+func (n *routeNode) match(segments []string, params map[string]string) (*routeNode, *routeNode) {
+	if len(segments) == 0 {
+		if len(n.handlers) == 0 {
+			return nil, nil
+		}
+		return n, nil
+	}
+
+	if child, ok := n.children[segments[0]]; ok {
+		if node, invalid := child.match(segments[1:], params); node != nil {
+			return node, invalid
+		}
+	}
+
+	if n.param == nil {
+		return nil, nil
+	}
+
+	params[n.param.paramName] = segments[0]
+	node, invalid := n.param.match(segments[1:], params)
+	if node == nil {
+		delete(params, n.param.paramName)
+		return nil, nil
+	}
+	if invalid == nil && !n.param.valid(segments[0]) {
+		invalid = n.param
+	}
+
+	return node, invalid
+}
+
+// valid returns if the value has the type of the parameter
+func (n *routeNode) valid(value string) bool {
+	if n.paramType == "int" {
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	}
+
+	return true
+}
+
+// allowed returns the methods the route supports
+func (n *routeNode) allowed() []string {
+	allowed := append([]string{}, n.methods...)
+	if _, ok := n.handlers[http.MethodGet]; ok {
+		if _, ok := n.handlers[http.MethodHead]; !ok {
+			allowed = append(allowed, http.MethodHead)
+		}
+	}
+	if _, ok := n.handlers[http.MethodOptions]; !ok {
+		allowed = append(allowed, http.MethodOptions)
+	}
+
+	return allowed
+}
+
+/*
+PathParam returns the value of the path parameter with the name, or an empty string if the route doesn't have it
+*/
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+
+	return params[name]
+}
+
+/*
+PathInt returns the value of an int path parameter. The router only calls the handler when the value is an integer
+*/
+func PathInt(r *http.Request, name string) int {
+	value, _ := strconv.Atoi(PathParam(r, name))
+
+	return value
+}
+
+/*
+PathInt64 returns the value of an int path parameter as an int64, used for timestamps
+*/
+func PathInt64(r *http.Request, name string) int64 {
+	value, _ := strconv.ParseInt(PathParam(r, name), 10, 64)
+
+	return value
+}
+
+// headResponseWriter drops the body, used when answering HEAD requests with the GET handler
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,97 @@
+package igcapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testRouter returns a router where every handler writes its name and the path parameters
+func testRouter() *Router {
+	router := &Router{}
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s id=%s field=%s", name, PathParam(r, "id"), PathParam(r, "field"))
+		}
+	}
+
+	router.Handle(http.MethodGet, "/api/ticker/{id:int}", handler("ticker"))
+	router.Handle(http.MethodGet, "/api/ticker/latest", handler("latest")) // Registered after the parameter on purpose
+	router.Handle(http.MethodGet, "/api/track/{id:int}", handler("track"))
+	router.Handle(http.MethodDelete, "/api/track/{id:int}", handler("delete"))
+	router.Handle(http.MethodGet, "/api/track/{id:int}/points", handler("points"))
+	router.Handle(http.MethodGet, "/api/track/{id:int}/{field}", handler("field"))
+
+	return router
+}
+
+// Tests that requests are routed to the right handler with the path parameters
+func Test_routerMatch(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		response string
+	}{
+		{http.MethodGet, "/api/ticker/latest", http.StatusOK, "latest id= field="},
+		{http.MethodGet, "/api/ticker/latest/", http.StatusOK, "latest id= field="},
+		{http.MethodGet, "/api/ticker/1540000000", http.StatusOK, "ticker id=1540000000 field="},
+		{http.MethodGet, "/api/track/5/", http.StatusOK, "track id=5 field="},
+		{http.MethodDelete, "/api/track/5", http.StatusOK, "delete id=5 field="},
+		{http.MethodGet, "/api/track/5/points", http.StatusOK, "points id=5 field="},
+		{http.MethodGet, "/api/track/5/pilot", http.StatusOK, "field id=5 field=pilot"},
+		{http.MethodGet, "/api/track/abc", http.StatusBadRequest, ""},
+		{http.MethodGet, "/api/ticker/abc", http.StatusBadRequest, ""},
+		{http.MethodGet, "/api/track/5/pilot/x", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/tracks", http.StatusNotFound, ""},
+	}
+
+	router := testRouter()
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+
+		if w.Code != test.status {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.path, test.status, w.Code)
+		}
+		if test.response != "" && w.Body.String() != test.response {
+			t.Errorf("%s %s: expected '%s', got '%s'", test.method, test.path, test.response, w.Body.String())
+		}
+	}
+}
+
+// Tests that other methods get 405 with Allow, that HEAD is answered without a body and OPTIONS with the methods
+func Test_routerMethods(t *testing.T) {
+	router := testRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/track/5", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, DELETE, HEAD, OPTIONS" {
+		t.Errorf("Expected 405 with Allow: GET, DELETE, HEAD, OPTIONS, got %d with '%s'", w.Code, w.Header().Get("Allow"))
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/api/track/5", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("Expected 200 without a body for HEAD, got %d with '%s'", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/api/ticker/latest", nil))
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Errorf("Expected 204 with Allow: GET, HEAD, OPTIONS, got %d with '%s'", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+// Tests that conflicting routes can't be registered
+func Test_routerConflict(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Registering a parameter with another name at the same position didn't panic")
+		}
+	}()
+
+	router := testRouter()
+	router.Handle(http.MethodGet, "/api/track/{trackID}", func(w http.ResponseWriter, r *http.Request) {})
+}
@@ -0,0 +1,96 @@
+package igcapi
+
+import (
+	"net/http"
+)
+
+// The path of the public API, v2 is under it
+const apiPrefix = "/paragliding/api"
+
+/*
+NewRouter returns the router with every route of the API, with the roles and rate limits of the routes.
+The routes of the public API are served both as v1 and v2, the admin routes aren't versioned
+*/
+func NewRouter() *Router {
+	router := &Router{NotFound: HandlerNotFound}
+
+	admin := MethodRoles{"*": RoleAdmin}
+	reader := MethodRoles{"*": RoleReader}
+	uploader := MethodRoles{"*": RoleUploader}
+
+	reads := MethodBudgets{"*": BudgetRead}
+	uploads := MethodBudgets{"*": BudgetUpload}
+	webhooks := MethodBudgets{"*": BudgetWebhook}
+
+	handle := func(method, pattern string, budgets MethodBudgets, roles MethodRoles, handler http.HandlerFunc) {
+		if roles != nil {
+			handler = RequireRoles(roles, handler)
+		}
+		handler = RateLimited(budgets, handler)
+
+		if v2, ok := v2Pattern(pattern); ok {
+			router.HandleRoles(method, pattern, roles, WithVersion(Version1, handler))
+			router.HandleRoles(method, v2, roles, WithVersion(Version2, handler))
+		} else {
+			router.HandleRoles(method, pattern, roles, handler)
+		}
+	}
+
+	router.Handle(http.MethodGet, "/paragliding", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/paragliding/api/", http.StatusMovedPermanently)
+	})
+	handle(http.MethodGet, "/paragliding/api", reads, nil, HandlerAPI)
+	handle(http.MethodGet, "/paragliding/api/openapi.json", reads, nil, HandlerOpenAPI)
+
+	handle(http.MethodGet, "/paragliding/api/track", reads, nil, HandlerTracks)
+	handle(http.MethodPost, "/paragliding/api/track", uploads, uploader, HandlerTrackAdd)
+	handle(http.MethodGet, "/paragliding/api/track/jobs/{id}", reads, uploader, HandlerTrackJob)
+	handle(http.MethodGet, "/paragliding/api/track/{id:int}", reads, nil, HandlerTrack)
+	handle(http.MethodPatch, "/paragliding/api/track/{id:int}", reads, uploader, HandlerTrackEdit)
+	handle(http.MethodDelete, "/paragliding/api/track/{id:int}", reads, admin, HandlerTrackDelete)
+	handle(http.MethodGet, "/paragliding/api/track/{id:int}/revisions", reads, nil, HandlerTrackRevisions)
+	handle(http.MethodGet, "/paragliding/api/track/{id:int}/points", reads, nil, HandlerTrackPoints)
+	handle(http.MethodGet, "/paragliding/api/track/{id:int}/audit", reads, nil, HandlerTrackAudit)
+	handle(http.MethodGet, "/paragliding/api/track/{id:int}/{field}", reads, nil, HandlerTrackField)
+
+	handle(http.MethodGet, "/paragliding/api/ticker", reads, nil, HandlerTicker)
+	handle(http.MethodGet, "/paragliding/api/ticker/latest", reads, nil, HandlerTickerLatest)
+	handle(http.MethodGet, "/paragliding/api/ticker/stream", reads, nil, HandlerTickerStream)
+	handle(http.MethodGet, "/paragliding/api/live", reads, nil, HandlerLive)
+	handle(http.MethodGet, "/paragliding/api/ticker/{timestamp:int}", reads, nil, HandlerTicker)
+	handle(http.MethodGet, "/paragliding/api/feed.atom", reads, nil, HandlerFeedAtom)
+	handle(http.MethodGet, "/paragliding/api/feed.rss", reads, nil, HandlerFeedRSS)
+
+	handle(http.MethodPost, "/paragliding/api/webhook/new_track", webhooks, uploader, HandlerWebhookAdd)
+	handle(http.MethodGet, "/paragliding/api/webhook/new_track/{id:int}", reads, reader, HandlerWebhook)
+	handle(http.MethodDelete, "/paragliding/api/webhook/new_track/{id:int}", reads, uploader, HandlerWebhookDelete)
+
+	handle(http.MethodGet, "/paragliding/api/sites", reads, nil, HandlerSites)
+	handle(http.MethodPost, "/paragliding/api/sites", reads, uploader, HandlerSiteAdd)
+	handle(http.MethodPost, "/paragliding/api/sites/import", reads, uploader, HandlerSitesImport)
+	handle(http.MethodGet, "/paragliding/api/sites/{id:int}", reads, nil, HandlerSite)
+	handle(http.MethodGet, "/paragliding/api/sites/{id:int}/tracks", reads, nil, HandlerSiteTracks)
+
+	handle(http.MethodGet, "/paragliding/api/pilots", reads, nil, HandlerPilots)
+	handle(http.MethodGet, "/paragliding/api/pilots/{id}", reads, nil, HandlerPilot)
+	handle(http.MethodGet, "/paragliding/api/pilots/{id}/tracks", reads, nil, HandlerPilotTracks)
+
+	handle(http.MethodGet, "/paragliding/api/gliders", reads, nil, HandlerGliders)
+	handle(http.MethodGet, "/paragliding/api/gliders/{id}", reads, nil, HandlerGlider)
+	handle(http.MethodPut, "/paragliding/api/gliders/{id}", reads, uploader, HandlerGliderRegister) // Changing the class needs admin
+
+	handle(http.MethodGet, "/paragliding/api/leaderboard", reads, nil, HandlerLeaderboard)
+	handle(http.MethodPost, "/paragliding/api/validate", uploads, nil, HandlerValidate)
+
+	handle(http.MethodGet, "/paragliding/admin/api/tracks_count", reads, admin, HandlerAdminTrackCount)
+	handle(http.MethodDelete, "/paragliding/admin/api/tracks", reads, admin, HandlerAdminTrack)
+	handle(http.MethodGet, "/paragliding/admin/api/trash", reads, admin, HandlerAdminTrash)
+	handle(http.MethodDelete, "/paragliding/admin/api/trash", reads, admin, HandlerAdminTrashEmpty)
+	handle(http.MethodGet, "/paragliding/admin/api/trash/{id:int}", reads, admin, HandlerAdminTrashTrack)
+	handle(http.MethodPost, "/paragliding/admin/api/trash/{id:int}/restore", reads, admin, HandlerAdminTrashRestore)
+	handle(http.MethodGet, "/paragliding/admin/api/keys", reads, admin, HandlerAdminKeys)
+	handle(http.MethodPost, "/paragliding/admin/api/keys", reads, admin, HandlerAdminKeyAdd)
+	handle(http.MethodDelete, "/paragliding/admin/api/keys/{id}", reads, admin, HandlerAdminKeyRevoke)
+
+	return router
+}
@@ -0,0 +1,72 @@
+package igcapi
+
+const (
+	scoreTurnpoints   = 3      // Free distance is scored via up to three turnpoints
+	scoreMaxPoints    = 300    // The path is simplified to at most this many points before scoring
+	scoreMinTolerance = 25.0   // Meters, the first tolerance tried when simplifying
+	scoreMaxTolerance = 5000.0 // Meters, the simplification gives up here
+)
+
+/*
+ScoreTrack returns the free distance score of a track in km: the longest distance through a start,
+up to three turnpoints and a finish, all taken from the track in the order they were flown.
+The path is simplified first, so the score can be slightly lower than the exact optimum
+*/
+func ScoreTrack(points []TrackPoint) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+
+	path := points
+	for tolerance := scoreMinTolerance; len(path) > scoreMaxPoints && tolerance <= scoreMaxTolerance; tolerance *= 2 {
+		path = SimplifyPoints(points, tolerance)
+	}
+	if len(path) > scoreMaxPoints { // Very long and winding tracks are thinned out evenly instead
+		step := len(path)/scoreMaxPoints + 1
+		thinned := []TrackPoint{}
+		for i := 0; i < len(path); i += step {
+			thinned = append(thinned, path[i])
+		}
+		path = append(thinned, path[len(path)-1])
+	}
+
+	// best[k][i] is the longest distance ending at point i using k legs
+	legs := scoreTurnpoints + 1
+	best := make([][]float64, legs+1)
+	for k := range best {
+		best[k] = make([]float64, len(path))
+	}
+
+	for k := 1; k <= legs; k++ {
+		for i := range path {
+			for j := 0; j < i; j++ {
+				d := best[k-1][j] + HaversineDistance(path[j].Lat, path[j].Lng, path[i].Lat, path[i].Lng)
+				if d > best[k][i] {
+					best[k][i] = d
+				}
+			}
+		}
+	}
+
+	score := 0.0
+	for k := 1; k <= legs; k++ {
+		for _, d := range best[k] {
+			if d > score {
+				score = d
+			}
+		}
+	}
+
+	return score / 1000
+}
+
+/*
+Airtime returns the time in seconds between the first and last fix
+*/
+func Airtime(points []TrackPoint) int64 {
+	if len(points) < 2 {
+		return 0
+	}
+
+	return int64(points[len(points)-1].Time.Sub(points[0].Time).Seconds())
+}
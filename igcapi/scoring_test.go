@@ -0,0 +1,52 @@
+package igcapi
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that an out-and-return flight is scored by its turnpoint, not by the distance from start to finish
+func Test_scoreTrack(t *testing.T) {
+	points := []TrackPoint{}
+	for i := 0; i <= 20; i++ { // 0.1 degrees north and back, about 11 km each way
+		lat := 60.0 + 0.01*float64(i)
+		if i > 10 {
+			lat = 60.0 + 0.01*float64(20-i)
+		}
+		points = append(points, TrackPoint{Time: time.Unix(int64(i*60), 0), Lat: lat, Lng: 8.0})
+	}
+
+	expected := 2 * HaversineDistance(60.0, 8.0, 60.1, 8.0) / 1000
+	if score := ScoreTrack(points); score < expected-0.01 || score > expected+0.01 {
+		t.Errorf("Expected a score of %.2f km, got %.2f km", expected, score)
+	}
+
+	if score := ScoreTrack(points[:1]); score != 0 {
+		t.Errorf("Expected a single point to score 0, got %f", score)
+	}
+}
+
+// Tests that long tracks are simplified before scoring without losing much of the score
+func Test_scoreTrack_long(t *testing.T) {
+	points := []TrackPoint{}
+	for i := 0; i < 5000; i++ { // A straight line north with a small zigzag
+		lng := 8.0
+		if i%2 == 0 {
+			lng += 0.0001
+		}
+		points = append(points, TrackPoint{Time: time.Unix(int64(i), 0), Lat: 60.0 + 0.0001*float64(i), Lng: lng})
+	}
+
+	expected := HaversineDistance(60.0, 8.0, 60.4999, 8.0) / 1000
+	if score := ScoreTrack(points); score < expected*0.99 || score > expected*1.01 {
+		t.Errorf("Expected a score of about %.2f km, got %.2f km", expected, score)
+	}
+}
+
+// Tests that the airtime is the time between the first and last fix
+func Test_airtime(t *testing.T) {
+	points := []TrackPoint{{Time: time.Unix(1000, 0)}, {Time: time.Unix(1500, 0)}, {Time: time.Unix(4600, 0)}}
+	if airtime := Airtime(points); airtime != 3600 {
+		t.Errorf("Expected 3600 seconds, got %d", airtime)
+	}
+}
@@ -0,0 +1,128 @@
+package igcapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// SignatureValid means the G record matches the content of the file
+	SignatureValid = "valid"
+	// SignatureInvalid means the G record doesn't match, the file has been changed after it was recorded
+	SignatureInvalid = "invalid"
+	// SignatureAbsent means the file has no G record
+	SignatureAbsent = "absent"
+	// SignatureUnsupported means no verifier knows the signature scheme of the flight recorder
+	SignatureUnsupported = "unsupported"
+)
+
+/*
+SignatureVerifier verifies the security record (G record) of IGC files from the flight recorders it supports
+*/
+type SignatureVerifier interface {
+	// Supports returns if the verifier knows the scheme used by the manufacturer (the three letter code of the A record)
+	Supports(manufacturer string) bool
+	// Verify returns if the signature matches the content of the file
+	Verify(content string, signature string) bool
+}
+
+var signatureVerifiers []SignatureVerifier
+
+/*
+RegisterSignatureVerifier adds a verifier used when tracks are ingested
+*/
+func RegisterSignatureVerifier(v SignatureVerifier) {
+	signatureVerifiers = append(signatureVerifiers, v)
+}
+
+/*
+VerifySignature returns the signature status of an IGC file, using the first registered verifier
+supporting the flight recorder
+*/
+func VerifySignature(content string) string {
+	manufacturer, signature := "", ""
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		switch line[0] {
+		case 'A':
+			if len(line) >= 4 {
+				manufacturer = line[1:4]
+			}
+		case 'G':
+			signature += line[1:]
+		}
+	}
+
+	if signature == "" {
+		return SignatureAbsent
+	}
+
+	for _, v := range signatureVerifiers {
+		if v.Supports(manufacturer) {
+			if v.Verify(content, signature) {
+				return SignatureValid
+			}
+			return SignatureInvalid
+		}
+	}
+
+	return SignatureUnsupported
+}
+
+/*
+TestKeyVerifier implements the test key scheme, used for testing competition setups without real
+flight recorders. Files using the scheme have the manufacturer code given by Manufacturer in the
+A record. The G record is the lowercase hex encoded HMAC-SHA256 of every other non-empty line of
+the file, with surrounding whitespace removed and each line ended by "\r\n", using Key as the key.
+The signature can be split over several G records
+*/
+type TestKeyVerifier struct {
+	Manufacturer string
+	Key          []byte
+}
+
+/*
+Supports returns true for the manufacturer code of the test key scheme
+*/
+func (v TestKeyVerifier) Supports(manufacturer string) bool {
+	return strings.EqualFold(manufacturer, v.Manufacturer)
+}
+
+/*
+Verify checks the signature against the HMAC of the content
+*/
+func (v TestKeyVerifier) Verify(content string, signature string) bool {
+	expected, err := hex.DecodeString(strings.ToLower(signature))
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(expected, v.mac(content))
+}
+
+/*
+Sign returns the G records signing the content with the test key
+*/
+func (v TestKeyVerifier) Sign(content string) string {
+	return "G" + hex.EncodeToString(v.mac(content)) + "\r\n"
+}
+
+// mac computes the HMAC of every line of the content except the G records
+func (v TestKeyVerifier) mac(content string) []byte {
+	mac := hmac.New(sha256.New, v.Key)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == 'G' {
+			continue
+		}
+		mac.Write([]byte(line + "\r\n"))
+	}
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,47 @@
+package igcapi
+
+import (
+	"strings"
+	"testing"
+)
+
+// Tests the signature status of signed, tampered, unsigned and unsupported files
+func Test_verifySignature(t *testing.T) {
+	verifier := TestKeyVerifier{Manufacturer: "XTK", Key: []byte("secret")}
+	signatureVerifiers = []SignatureVerifier{verifier}
+	defer func() { signatureVerifiers = nil }()
+
+	content := "AXTK001\r\nHFDTE190216\r\nHFPLTPILOT:Test Pilot\r\nB1101355206343N00006198WA0058700558\r\n"
+	signed := content + verifier.Sign(content)
+
+	if status := VerifySignature(signed); status != SignatureValid {
+		t.Errorf("Expected '%s', got '%s'", SignatureValid, status)
+	}
+
+	tampered := strings.Replace(signed, "Test Pilot", "Other Pilot", 1)
+	if status := VerifySignature(tampered); status != SignatureInvalid {
+		t.Errorf("Expected '%s', got '%s'", SignatureInvalid, status)
+	}
+
+	if status := VerifySignature(content); status != SignatureAbsent {
+		t.Errorf("Expected '%s', got '%s'", SignatureAbsent, status)
+	}
+
+	otherRecorder := strings.Replace(signed, "AXTK001", "ALXN001", 1)
+	if status := VerifySignature(otherRecorder); status != SignatureUnsupported {
+		t.Errorf("Expected '%s', got '%s'", SignatureUnsupported, status)
+	}
+}
+
+// Tests that a signature split over several G records is verified
+func Test_verifySignature_multipleLines(t *testing.T) {
+	verifier := TestKeyVerifier{Manufacturer: "XTK", Key: []byte("secret")}
+
+	content := "AXTK001\nHFDTE190216\n"
+	signature := strings.TrimSpace(verifier.Sign(content))[1:]
+	signed := content + "G" + signature[:32] + "\nG" + signature[32:] + "\n"
+
+	if !verifier.Verify(signed, signature) {
+		t.Error("Split signature was not verified")
+	}
+}
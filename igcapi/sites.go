@@ -0,0 +1,264 @@
+package igcapi
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSiteRadius = 500.0 // Meters, used for imported sites without a radius and for new unnamed sites
+)
+
+var (
+	nextSiteID int
+	sitesMutex sync.Mutex // Assigning a site can create a new one, so it's done by one ingestion at a time
+)
+
+/*
+Site is a launch site. Sites without a name are made from clustering takeoffs which didn't match any known site
+*/
+type Site struct {
+	ID       int     `json:"id"`
+	Name     string  `json:"name"`
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+	Radius   float64 `json:"radius"` // Meters
+	Takeoffs int     `json:"-"`      // The amount of takeoffs the center of an unnamed site is the mean of
+}
+
+/*
+SiteStats contains the statistics of the flights from a site
+*/
+type SiteStats struct {
+	Flights       int       `json:"flights"`
+	Pilots        int       `json:"pilots"`
+	TotalDistance float64   `json:"total_distance"`
+	LongestFlight float64   `json:"longest_flight"`
+	LastFlight    time.Time `json:"last_flight"`
+}
+
+/*
+SiteDetails is a site with the statistics of its flights
+*/
+type SiteDetails struct {
+	Site
+	Stats SiteStats `json:"stats"`
+}
+
+/*
+NearestSite returns the nearest site whose radius contains the coordinate, and if one was found
+*/
+func NearestSite(sites []Site, lat, lng float64) (Site, bool) {
+	nearest, found := Site{}, false
+	shortest := math.Inf(1)
+
+	for _, site := range sites {
+		distance := HaversineDistance(site.Lat, site.Lng, lat, lng)
+		if distance <= site.Radius && distance < shortest {
+			nearest, found, shortest = site, true, distance
+		}
+	}
+
+	return nearest, found
+}
+
+/*
+AssignSite sets the site of a track from its takeoff point. If no site matches, a new unnamed
+site is created at the takeoff. Takeoffs matching an unnamed site move its center towards them
+*/
+func AssignSite(track *TrackInfo) {
+	if track.Start == nil {
+		return
+	}
+	lat, lng := track.Start.Coordinates[1], track.Start.Coordinates[0]
+
+	sitesMutex.Lock()
+	defer sitesMutex.Unlock()
+
+	sites, err := siteDB.GetAll()
+	if err != nil {
+		fmt.Println("Couldn't retrieve the sites:", err.Error())
+		return
+	}
+
+	if site, found := NearestSite(sites, lat, lng); found {
+		track.SiteID = site.ID
+
+		if site.Name == "" { // The center of a cluster is the mean of its takeoffs
+			site.Lat = (site.Lat*float64(site.Takeoffs) + lat) / float64(site.Takeoffs+1)
+			site.Lng = (site.Lng*float64(site.Takeoffs) + lng) / float64(site.Takeoffs+1)
+			site.Takeoffs++
+			siteDB.Update(site)
+		}
+		return
+	}
+
+	site := Site{ID: nextSiteID, Lat: lat, Lng: lng, Radius: defaultSiteRadius, Takeoffs: 1}
+	if siteDB.Add(site) {
+		nextSiteID++
+		track.SiteID = site.ID
+	}
+}
+
+/*
+CalculateSiteStats calculates the statistics of the tracks from a site
+*/
+func CalculateSiteStats(tracks []TrackInfo) SiteStats {
+	stats := SiteStats{Flights: len(tracks)}
+
+	pilots := make(map[string]bool)
+	for _, track := range tracks {
+		pilots[track.Pilot] = true
+		stats.TotalDistance += track.TrackLength
+		stats.LongestFlight = math.Max(stats.LongestFlight, track.TrackLength)
+		if track.HDate.After(stats.LastFlight) {
+			stats.LastFlight = track.HDate
+		}
+	}
+	stats.Pilots = len(pilots)
+
+	return stats
+}
+
+/*
+ParseSitesCSV parses sites from a CSV file with a header row. The columns name, lat and lng (or lon)
+are required, radius (in meters) is optional
+*/
+func ParseSitesCSV(r io.Reader) ([]Site, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("the file is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["lng"]; !ok {
+		columns["lng"] = columnOr(columns, "lon", -1)
+	}
+	for _, required := range []string{"name", "lat", "lng"} {
+		if i, ok := columns[required]; !ok || i < 0 {
+			return nil, fmt.Errorf("missing the column '%s'", required)
+		}
+	}
+
+	sites := []Site{}
+	for n, row := range rows[1:] {
+		site := Site{Name: strings.TrimSpace(row[columns["name"]]), Radius: defaultSiteRadius}
+
+		site.Lat, err = strconv.ParseFloat(strings.TrimSpace(row[columns["lat"]]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lat on row %d", n+2)
+		}
+		site.Lng, err = strconv.ParseFloat(strings.TrimSpace(row[columns["lng"]]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lng on row %d", n+2)
+		}
+		if i := columnOr(columns, "radius", -1); i >= 0 && strings.TrimSpace(row[i]) != "" {
+			if site.Radius, err = strconv.ParseFloat(strings.TrimSpace(row[i]), 64); err != nil || site.Radius <= 0 {
+				return nil, fmt.Errorf("invalid radius on row %d", n+2)
+			}
+		}
+
+		if site.Name == "" || !validLatLng(site.Lat, site.Lng) {
+			return nil, fmt.Errorf("invalid site on row %d", n+2)
+		}
+		sites = append(sites, site)
+	}
+
+	return sites, nil
+}
+
+/*
+ParseSitesCUP parses sites from a SeeYou CUP file. Only the waypoints are read, the tasks after
+the "-----Related Tasks-----" line are ignored
+*/
+func ParseSitesCUP(r io.Reader) ([]Site, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	waypoints := strings.Split(string(content), "-----Related Tasks-----")[0]
+	reader := csv.NewReader(strings.NewReader(waypoints))
+	reader.FieldsPerRecord = -1 // The amount of columns differs between versions of the format
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	sites := []Site{}
+	for n, row := range rows {
+		if n == 0 && len(row) > 0 && strings.EqualFold(strings.TrimSpace(row[0]), "name") {
+			continue // The header
+		}
+		if len(row) < 5 {
+			return nil, fmt.Errorf("too few columns on row %d", n+1)
+		}
+
+		site := Site{Name: strings.TrimSpace(row[0]), Radius: defaultSiteRadius}
+		if site.Lat, err = parseCUPCoordinate(row[3]); err != nil {
+			return nil, fmt.Errorf("invalid latitude on row %d", n+1)
+		}
+		if site.Lng, err = parseCUPCoordinate(row[4]); err != nil {
+			return nil, fmt.Errorf("invalid longitude on row %d", n+1)
+		}
+
+		if site.Name == "" || !validLatLng(site.Lat, site.Lng) {
+			return nil, fmt.Errorf("invalid site on row %d", n+1)
+		}
+		sites = append(sites, site)
+	}
+
+	return sites, nil
+}
+
+// parseCUPCoordinate parses a DDMM.mmmN latitude or a DDDMM.mmmE longitude
+func parseCUPCoordinate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 8 {
+		return 0, fmt.Errorf("coordinate too short")
+	}
+
+	hemisphere := s[len(s)-1]
+	degreeDigits := 2
+	if hemisphere == 'E' || hemisphere == 'W' {
+		degreeDigits = 3
+	} else if hemisphere != 'N' && hemisphere != 'S' {
+		return 0, fmt.Errorf("invalid hemisphere")
+	}
+
+	degrees, err := strconv.ParseFloat(s[:degreeDigits], 64)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseFloat(s[degreeDigits:len(s)-1], 64)
+	if err != nil || minutes >= 60 {
+		return 0, fmt.Errorf("invalid minutes")
+	}
+
+	value := degrees + minutes/60
+	if hemisphere == 'S' || hemisphere == 'W' {
+		value = -value
+	}
+
+	return value, nil
+}
+
+func columnOr(columns map[string]int, name string, fallback int) int {
+	if i, ok := columns[name]; ok {
+		return i
+	}
+	return fallback
+}
@@ -0,0 +1,137 @@
+package igcapi
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that the nearest site containing the point is used
+func Test_nearestSite(t *testing.T) {
+	sites := []Site{
+		{ID: 1, Name: "Hangurstoppen", Lat: 60.6360, Lng: 6.4090, Radius: 500},
+		{ID: 2, Name: "Large area", Lat: 60.6400, Lng: 6.4200, Radius: 5000},
+		{ID: 3, Name: "Skogshorn", Lat: 60.9000, Lng: 8.7000, Radius: 500},
+	}
+
+	if site, found := NearestSite(sites, 60.6362, 6.4095); !found || site.ID != 1 {
+		t.Errorf("Expected site 1, got %d (found: %v)", site.ID, found)
+	}
+	if site, found := NearestSite(sites, 60.6500, 6.4500); !found || site.ID != 2 {
+		t.Errorf("Expected site 2, got %d (found: %v)", site.ID, found)
+	}
+	if _, found := NearestSite(sites, 61.5, 7.0); found {
+		t.Error("A site was found far away from every site")
+	}
+}
+
+// Tests importing sites from a CSV file
+func Test_parseSitesCSV(t *testing.T) {
+	content := "name,lat,lon,radius\nHangurstoppen,60.636,6.409,300\nSkogshorn,60.9,8.7,\n"
+
+	sites, err := ParseSitesCSV(strings.NewReader(content))
+	if err != nil {
+		t.Errorf("Couldn't parse the sites: %s", err)
+		return
+	}
+
+	if len(sites) != 2 || sites[0].Name != "Hangurstoppen" || sites[0].Radius != 300 || sites[1].Radius != defaultSiteRadius {
+		t.Errorf("Unexpected sites: %+v", sites)
+	}
+
+	if _, err = ParseSitesCSV(strings.NewReader("name,lat\nNo longitude,60\n")); err == nil {
+		t.Error("A file without longitudes was accepted")
+	}
+}
+
+// Tests importing sites from a SeeYou CUP file
+func Test_parseSitesCUP(t *testing.T) {
+	content := `name,code,country,lat,lon,elev,style,rwdir,rwlen,freq,desc
+"Hangurstoppen","HANG",NO,6038.160N,00624.540E,660.0m,1,,,,"Launch"
+"Southwest","SW",AR,3430.000S,05830.000W,10.0m,1,,,,""
+-----Related Tasks-----
+"Task","HANG","HANG"
+`
+	sites, err := ParseSitesCUP(strings.NewReader(content))
+	if err != nil {
+		t.Errorf("Couldn't parse the sites: %s", err)
+		return
+	}
+	if len(sites) != 2 {
+		t.Errorf("Expected 2 sites, got %d", len(sites))
+		return
+	}
+
+	if sites[0].Name != "Hangurstoppen" || math.Abs(sites[0].Lat-60.636) > 1e-9 || math.Abs(sites[0].Lng-6.409) > 1e-9 {
+		t.Errorf("Unexpected site: %+v", sites[0])
+	}
+	if math.Abs(sites[1].Lat+34.5) > 1e-9 || math.Abs(sites[1].Lng+58.5) > 1e-9 {
+		t.Errorf("Unexpected site in the southern and western hemisphere: %+v", sites[1])
+	}
+}
+
+// Tests that CUP waypoints outside the valid coordinates are refused with their row
+func Test_parseSitesCUP_invalid(t *testing.T) {
+	tests := map[string]string{
+		"\"Too far north\",\"N\",NO,9530.000N,00624.540E,660.0m,1\n":  "invalid site on row 1",
+		"\"Too far east\",\"E\",NO,6038.160N,18130.000E,660.0m,1\n":   "invalid site on row 1",
+		"name,code,country,lat,lon\n,\"X\",NO,6038.160N,00624.540E\n": "invalid site on row 2",
+	}
+
+	for content, expected := range tests {
+		if _, err := ParseSitesCUP(strings.NewReader(content)); err == nil || err.Error() != expected {
+			t.Errorf("%q: expected '%s', got %v", content, expected, err)
+		}
+	}
+}
+
+// Tests the statistics of the flights from a site
+func Test_calculateSiteStats(t *testing.T) {
+	tracks := []TrackInfo{
+		{Pilot: "Anna", TrackLength: 40, HDate: time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{Pilot: "Bob", TrackLength: 120, HDate: time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{Pilot: "Anna", TrackLength: 80, HDate: time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	stats := CalculateSiteStats(tracks)
+	if stats.Flights != 3 || stats.Pilots != 2 || stats.TotalDistance != 240 || stats.LongestFlight != 120 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if !stats.LastFlight.Equal(tracks[1].HDate) {
+		t.Errorf("Expected the last flight to be %v, got %v", tracks[1].HDate, stats.LastFlight)
+	}
+}
+
+// Tests that a track is given a site when it's added, and that adding a duplicate doesn't change the sites
+func Test_handlerTrackAdd_site(t *testing.T) {
+	defer func(tracks TrackStorage, sites SiteStorage, f Fetcher) { db, siteDB, fetcher = tracks, sites, f }(db, siteDB, fetcher)
+	db = &TrackMemoryDB{}
+	siteDB = &SiteMemoryDB{}
+	fetcher = *newTestFetcher()
+	fetcher.MaxBodySize = 1 << 20
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testIGCPoints)
+	}))
+	defer server.Close()
+
+	for _, status := range []int{http.StatusOK, http.StatusConflict} {
+		w := httptest.NewRecorder()
+		HandlerTrackAdd(w, httptest.NewRequest(http.MethodPost, "/paragliding/api/track", strings.NewReader(`{"url": "`+server.URL+`"}`)))
+		if w.Code != status {
+			t.Fatalf("Expected %d, got %d (%s)", status, w.Code, w.Body.String())
+		}
+	}
+
+	sites, _ := siteDB.GetAll()
+	if len(sites) != 1 || sites[0].Takeoffs != 1 {
+		t.Errorf("Expected a site with 1 takeoff, got %+v", sites)
+	}
+	if track, _ := db.GetLast(); track.SiteID != sites[0].ID {
+		t.Errorf("Expected the track to be from the site %d, got %d", sites[0].ID, track.SiteID)
+	}
+}
@@ -0,0 +1,152 @@
+package igcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	streamHeartbeat = 15 * time.Second // How often a comment is sent on idle streams, so proxies keep them open
+	streamBuffer    = 64               // The events a stream can be behind before it's closed
+)
+
+/*
+TickerEvent is the data of the events of the ticker stream
+*/
+type TickerEvent struct {
+	TrackID   int   `json:"track_id"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+/*
+TickerEventV2 is the data of the events of the ticker stream in v2
+*/
+type TickerEventV2 struct {
+	TrackID int       `json:"track_id"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+/*
+V2 returns the event in v2
+*/
+func (event TickerEvent) V2() interface{} {
+	return TickerEventV2{TrackID: event.TrackID, AddedAt: unixTime(event.Timestamp)}
+}
+
+/*
+HandlerTickerStream handles GET /paragliding/api/ticker/stream, sends the ID and timestamp of every added track as
+Server-Sent Events. The ID of the events is "<timestamp>-<track ID>", with Last-Event-ID the tracks added after it
+are sent first, including the later tracks of the same second. Streams that fall behind are closed, the client
+reconnects and gets the missed tracks that way
+*/
+func HandlerTickerStream(w http.ResponseWriter, r *http.Request) {
+	resume := false
+	var lastTimestamp int64
+	var lastID int
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		var err error
+		if lastTimestamp, lastID, err = parseTickerEventID(header); err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "Invalid Last-Event-ID given, has to be <timestamp>-<track ID>")
+			return
+		}
+		resume = true
+	}
+
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-cache")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		internalError(w, r, "Streaming isn't supported")
+		return
+	}
+
+	subscription := events.Subscribe(streamBuffer) // Before the missed tracks are read, so no track is lost in between
+	defer subscription.Close()
+
+	sent := make(map[int]bool) // The missed tracks, they might be published after subscribing too
+	if resume {
+		missed, err := db.Find(TrackFilter{AddedSince: lastTimestamp})
+		if err != nil {
+			internalError(w, r, "Couldn't retrieve the missed tracks")
+			return
+		}
+		sort.SliceStable(missed, func(i, j int) bool {
+			if missed[i].Timestamp != missed[j].Timestamp {
+				return missed[i].Timestamp < missed[j].Timestamp
+			}
+			return missed[i].ID < missed[j].ID
+		})
+
+		for _, track := range missed {
+			if track.Timestamp == lastTimestamp && track.ID <= lastID {
+				continue // The client has it already
+			}
+			writeTickerEvent(w, r, track)
+			sent[track.ID] = true
+		}
+	}
+
+	fmt.Fprint(w, "retry: 3000\n\n") // Milliseconds before reconnecting
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case event, open := <-subscription.Events:
+			if !open || subscription.Dropped() > 0 {
+				return
+			}
+			added, ok := event.(TrackAdded)
+			if !ok || sent[added.Track.ID] {
+				continue
+			}
+			writeTickerEvent(w, r, added.Track)
+			flusher.Flush()
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// writeTickerEvent writes the event of an added track, in the version of the request
+func writeTickerEvent(w io.Writer, r *http.Request, track TrackInfo) {
+	data, _ := json.Marshal(Represent(RequestVersion(r), TickerEvent{TrackID: track.ID, Timestamp: track.Timestamp}))
+	fmt.Fprintf(w, "id: %d-%d\nevent: %s\ndata: %s\n\n", track.Timestamp, track.ID, EventTrackAdded, data)
+}
+
+// parseTickerEventID parses the ID of a ticker event. IDs from before the track ID was added are only a timestamp,
+// the client has every track of that second then
+func parseTickerEventID(eventID string) (int64, int, error) {
+	timestampPart, idPart, hasID := strings.Cut(eventID, "-")
+	timestamp, err := strconv.ParseInt(timestampPart, 10, 64)
+	if err != nil || timestamp < 0 {
+		return 0, 0, fmt.Errorf("invalid timestamp %q", timestampPart)
+	}
+	if !hasID {
+		return timestamp, math.MaxInt32, nil
+	}
+
+	id, err := strconv.Atoi(idPart)
+	if err != nil || id < 0 {
+		return 0, 0, fmt.Errorf("invalid track ID %q", idPart)
+	}
+	return timestamp, id, nil
+}
@@ -0,0 +1,101 @@
+package igcapi
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readEvent returns the lines of the next event of the stream, skipping comments
+func readEvent(t *testing.T, reader *bufio.Reader) []string {
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Couldn't read the stream: %s", err.Error())
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && len(lines) > 0:
+			return lines
+		case line == "", strings.HasPrefix(line, ":"):
+		default:
+			lines = append(lines, line)
+		}
+	}
+}
+
+// Tests that the missed tracks are sent after Last-Event-ID, followed by the tracks published on the bus
+func Test_tickerStream(t *testing.T) {
+	defer func(storage TrackStorage) { db = storage }(db)
+
+	memoryDB := &TrackMemoryDB{}
+	memoryDB.Add(TrackInfo{ID: 1, Timestamp: 100, TrackSourceURL: "a"})
+	memoryDB.Add(TrackInfo{ID: 2, Timestamp: 200, TrackSourceURL: "b"})
+	memoryDB.Add(TrackInfo{ID: 3, Timestamp: 200, TrackSourceURL: "c"}) // The same second as track 2
+	memoryDB.Add(TrackInfo{ID: 4, Timestamp: 300, TrackSourceURL: "d"})
+	db = memoryDB
+
+	server := httptest.NewServer(NewRouter())
+	defer server.Close()
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/paragliding/api/ticker/stream", nil)
+	request.Header.Set("Last-Event-ID", "200-2")
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Couldn't connect to the stream: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("content-type") != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got '%s'", resp.Header.Get("content-type"))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	expected := [][]string{
+		{"id: 200-3", "event: track_added", `data: {"track_id":3,"timestamp":200}`},
+		{"id: 300-4", "event: track_added", `data: {"track_id":4,"timestamp":300}`},
+		{"retry: 3000"}, // Sent after the missed tracks, so the stream is subscribed now
+	}
+	for _, want := range expected {
+		if got := readEvent(t, reader); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	}
+
+	events.Publish(TrackAdded{Track: TrackInfo{ID: 4, Timestamp: 300}}) // Already sent
+	events.Publish(TrackAdded{Track: TrackInfo{ID: 5, Timestamp: 400}})
+
+	want := []string{"id: 400-5", "event: track_added", `data: {"track_id":5,"timestamp":400}`}
+	if got := readEvent(t, reader); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+// Tests that Last-Event-ID has to be <timestamp>-<track ID>
+func Test_tickerStreamInvalidID(t *testing.T) {
+	for _, eventID := range []string{"abc", "200-abc", "-200", "200-"} {
+		r := httptest.NewRequest(http.MethodGet, "/paragliding/api/v2/ticker/stream", nil)
+		r.Header.Set("Last-Event-ID", eventID)
+		w := httptest.NewRecorder()
+		NewRouter().ServeHTTP(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", eventID, w.Code)
+		}
+	}
+}
+
+// Tests that the IDs from before the track ID was added skip every track of their second
+func Test_parseTickerEventID(t *testing.T) {
+	if timestamp, id, err := parseTickerEventID("200-3"); err != nil || timestamp != 200 || id != 3 {
+		t.Errorf("Expected 200 and 3, got %d and %d (%v)", timestamp, id, err)
+	}
+	if timestamp, id, err := parseTickerEventID("200"); err != nil || timestamp != 200 || id != math.MaxInt32 {
+		t.Errorf("Expected 200 and every track, got %d and %d (%v)", timestamp, id, err)
+	}
+}
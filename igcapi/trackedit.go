@@ -0,0 +1,170 @@
+package igcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+/*
+The actions recorded in the audit trail
+*/
+const (
+	AuditEdit    = "edit"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+/*
+AuditEntry records a change to a track. Edits have the changed fields, the other actions have no changes
+*/
+type AuditEntry struct {
+	TrackID   int                    `json:"track_id"`
+	Action    string                 `json:"action"`
+	Changes   map[string]AuditChange `json:"changes,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+}
+
+/*
+AuditChange is the value of a field before and after an edit
+*/
+type AuditChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+/*
+TrackEdit contains the corrected metadata of a track, fields that aren't given are left as they are
+*/
+type TrackEdit struct {
+	Pilot    *string `json:"pilot,omitempty"`
+	Glider   *string `json:"glider,omitempty"`
+	GliderID *string `json:"glider_id,omitempty"`
+}
+
+/*
+ParseTrackEdit parses an edit from JSON. Only pilot, glider and glider_id can be edited, other fields are refused
+*/
+func ParseTrackEdit(r io.Reader) (TrackEdit, error) {
+	var edit TrackEdit
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&edit); err != nil {
+		return edit, fmt.Errorf("invalid edit given, only pilot, glider and glider_id can be edited")
+	}
+	if edit.Pilot == nil && edit.Glider == nil && edit.GliderID == nil {
+		return edit, fmt.Errorf("no fields to edit given")
+	}
+	if edit.Pilot != nil && strings.TrimSpace(*edit.Pilot) == "" {
+		return edit, fmt.Errorf("the pilot can't be empty")
+	}
+
+	return edit, nil
+}
+
+/*
+Apply returns the track with the edit applied, and the fields that were changed
+*/
+func (e TrackEdit) Apply(t TrackInfo) (TrackInfo, map[string]AuditChange) {
+	changes := make(map[string]AuditChange)
+
+	set := func(field string, value *string, current *string) {
+		if value != nil && *value != *current {
+			changes[field] = AuditChange{From: *current, To: *value}
+			*current = *value
+		}
+	}
+	set("pilot", e.Pilot, &t.Pilot)
+	set("glider", e.Glider, &t.Glider)
+	set("glider_id", e.GliderID, &t.GliderID)
+
+	t.PilotID = PilotID(t.Pilot)
+	t.GliderKey = NormalizeGliderID(t.GliderID)
+
+	return t, changes
+}
+
+/*
+TrackEdits returns the edits of the track in the audit trail as one edit, with the latest value of every edited field.
+Used to keep the corrections when a new revision of the file is fetched
+*/
+func TrackEdits(trackID int) (TrackEdit, error) {
+	var edit TrackEdit
+	entries, err := auditDB.GetAll(trackID)
+	if err != nil {
+		return edit, err
+	}
+
+	for _, entry := range entries { // Oldest first
+		if entry.Action != AuditEdit {
+			continue
+		}
+		for field, change := range entry.Changes {
+			value := change.To
+			switch field {
+			case "pilot":
+				edit.Pilot = &value
+			case "glider":
+				edit.Glider = &value
+			case "glider_id":
+				edit.GliderID = &value
+			}
+		}
+	}
+
+	return edit, nil
+}
+
+/*
+NewAuditEntry creates an audit entry of the action on the track, timestamped now
+*/
+func NewAuditEntry(trackID int, action string, changes map[string]AuditChange) AuditEntry {
+	return AuditEntry{TrackID: trackID, Action: action, Changes: changes, Timestamp: time.Now().Unix()}
+}
+
+/*
+RecalculateAggregates updates the totals of the pilots and gliders of the tracks and the leaderboards,
+used after tracks are changed, deleted or restored. Changed tracks are given both as they were and as they are
+*/
+func RecalculateAggregates(tracks ...TrackInfo) {
+	pilots := make(map[string]bool)
+	gliders := make(map[string]bool)
+	for _, track := range tracks {
+		pilots[track.PilotID] = true
+		gliders[NormalizeGliderID(track.GliderID)] = true
+	}
+
+	for id := range pilots {
+		RecalculatePilot(id)
+	}
+	for id := range gliders {
+		RecalculateGlider(id)
+	}
+
+	InvalidateLeaderboards()
+}
+
+/*
+UpdateAggregates is the listener that keeps the totals of the pilots and gliders and the leaderboards
+up to date with the tracks published on the event bus
+*/
+func UpdateAggregates(event Event) {
+	switch e := event.(type) {
+	case TrackAdded:
+		pilotDB.AddTrack(e.Track)
+		gliderDB.AddTrack(e.Track)
+		InvalidateLeaderboards()
+	case TrackUpdated:
+		RecalculateAggregates(e.Before, e.After)
+	case TrackDeleted:
+		RecalculateAggregates(e.Track)
+	case TracksDeleted:
+		RecalculateAggregates(e.Tracks...)
+	case TrackRestored:
+		RecalculateAggregates(e.Track)
+	}
+}
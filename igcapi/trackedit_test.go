@@ -0,0 +1,50 @@
+package igcapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Tests that only the given fields are edited, and that the changes are recorded
+func Test_trackEdit(t *testing.T) {
+	track := TrackInfo{ID: 1, Pilot: "Jon Doe", PilotID: "jon-doe", Glider: "Rush", GliderID: "EC-XLL"}
+
+	edit, err := ParseTrackEdit(strings.NewReader(`{"pilot": "John Doe", "glider_id": "EC-XLL"}`))
+	if err != nil {
+		t.Errorf("Couldn't parse the edit: %s", err)
+		return
+	}
+
+	edited, changes := edit.Apply(track)
+	expected := TrackInfo{ID: 1, Pilot: "John Doe", PilotID: "john-doe", Glider: "Rush", GliderID: "EC-XLL", GliderKey: "EC-XLL"}
+	if edited != expected {
+		t.Errorf("Expected %+v, got %+v", expected, edited)
+	}
+	if !reflect.DeepEqual(changes, map[string]AuditChange{"pilot": {From: "Jon Doe", To: "John Doe"}}) {
+		t.Errorf("Unexpected changes: %+v", changes)
+	}
+}
+
+// Tests that edits of other fields, empty edits and empty pilots are refused
+func Test_parseTrackEdit_invalid(t *testing.T) {
+	for _, body := range []string{`{"track_length": 1000}`, `{}`, `{"pilot": "  "}`, `not json`} {
+		if _, err := ParseTrackEdit(strings.NewReader(body)); err == nil {
+			t.Errorf("'%s' was accepted", body)
+		}
+	}
+}
+
+// Tests deleting a single track from the memory DB
+func Test_memoryDB_delete(t *testing.T) {
+	memoryDB := &TrackMemoryDB{}
+	memoryDB.Add(TrackInfo{ID: 1, TrackSourceURL: "a"})
+	memoryDB.Add(TrackInfo{ID: 2, TrackSourceURL: "b"})
+
+	if !memoryDB.Delete(1, 1000) || memoryDB.Delete(1, 1000) {
+		t.Error("Expected track 1 to be deleted once")
+	}
+	if IDs, _ := memoryDB.GetAllIDs(); !reflect.DeepEqual(IDs, []int{2}) {
+		t.Errorf("Expected [2], got %v", IDs)
+	}
+}
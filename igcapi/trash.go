@@ -0,0 +1,66 @@
+package igcapi
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	defaultTrashRetention = 30 * 24 * time.Hour
+)
+
+/*
+TrashedTrack is a deleted track in the trash, with its ID
+*/
+type TrashedTrack struct {
+	ID int `json:"id"`
+	TrackInfo
+}
+
+/*
+TrashPurger permanently removes the tracks that have been in the trash longer than the retention
+period. The retention can be set with the environment variable TRASH_RETENTION (e.g "168h"), the default is 30 days
+*/
+func TrashPurger() {
+	retention := defaultTrashRetention
+	if param, ok := os.LookupEnv("TRASH_RETENTION"); ok {
+		if d, err := time.ParseDuration(param); err == nil && d > 0 {
+			retention = d
+		} else {
+			fmt.Println("Invalid TRASH_RETENTION, using the default:", retention)
+		}
+	}
+
+	delay := time.Hour
+	if retention < delay {
+		delay = retention
+	}
+
+	for {
+		time.Sleep(delay)
+		if purged := PurgeTrash(time.Now().Add(-retention).Unix()); purged > 0 {
+			fmt.Println("Purged tracks from the trash:", purged)
+		}
+	}
+}
+
+/*
+PurgeTrash permanently removes the tracks deleted at or before the given unix time, along with
+their points and revisions, and returns how many tracks were removed. The audit trail is kept
+*/
+func PurgeTrash(deletedBefore int64) int {
+	tracks, err := db.Purge(deletedBefore)
+	if err != nil {
+		fmt.Println("Couldn't purge the trash:", err.Error())
+		return 0
+	}
+
+	for _, track := range tracks {
+		pointsDB.Delete(track.ID)
+		revisionDB.DeleteAll(track.ID)
+		auditDB.Add(NewAuditEntry(track.ID, AuditPurge, nil))
+	}
+
+	return len(tracks)
+}
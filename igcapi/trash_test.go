@@ -0,0 +1,131 @@
+package igcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// trashTestTracks are three tracks, where track 2 was deleted at 1000 and track 3 at 2000
+var trashTestTracks = []TrackInfo{
+	{ID: 1, Timestamp: 10},
+	{ID: 2, Timestamp: 20, DeletedAt: 1000},
+	{ID: 3, Timestamp: 30, DeletedAt: 2000},
+}
+
+// Tests that deleted tracks are hidden from lookups, listings and counts, but not from the trash
+func Test_softDelete(t *testing.T) {
+	memoryDB := testTrackDB(trashTestTracks...)
+
+	if _, found := memoryDB.Get(2); found {
+		t.Error("A deleted track was found")
+	}
+	if count := memoryDB.Count(); count != 1 {
+		t.Errorf("Expected a count of 1, got %d", count)
+	}
+	if IDs, _ := memoryDB.GetAllIDs(); !reflect.DeepEqual(IDs, []int{1}) {
+		t.Errorf("Expected [1], got %v", IDs)
+	}
+	if IDs, _ := memoryDB.FindIDs(TrackFilter{AddedAfter: 5}); !reflect.DeepEqual(IDs, []int{1}) {
+		t.Errorf("Expected the ticker to only find [1], got %v", IDs)
+	}
+	if last, _ := memoryDB.GetLast(); last.ID != 1 {
+		t.Errorf("Expected the last track to be 1, got %d", last.ID)
+	}
+	if lastID := memoryDB.GetLastID(); lastID != 3 {
+		t.Errorf("Expected the last used ID to be 3 so it isn't reused, got %d", lastID)
+	}
+	if IDs, _ := memoryDB.FindIDs(TrackFilter{Deleted: true}); !reflect.DeepEqual(IDs, []int{2, 3}) {
+		t.Errorf("Expected the trash to have [2 3], got %v", IDs)
+	}
+}
+
+// Tests restoring a deleted track
+func Test_restore(t *testing.T) {
+	memoryDB := testTrackDB(trashTestTracks...)
+
+	if !memoryDB.Restore(2) || memoryDB.Restore(2) || memoryDB.Restore(1) {
+		t.Error("Expected only the deleted track 2 to be restored, once")
+	}
+	if track, found := memoryDB.Get(2); !found || track.DeletedAt != 0 {
+		t.Errorf("The restored track wasn't found, or is still deleted: %+v", track)
+	}
+}
+
+// Tests that only tracks deleted before the retention period are purged
+func Test_purge(t *testing.T) {
+	memoryDB := testTrackDB(trashTestTracks...)
+
+	purged, _ := memoryDB.Purge(1500)
+	if len(purged) != 1 || purged[0].ID != 2 {
+		t.Errorf("Expected track 2 to be purged, got %+v", purged)
+	}
+	if IDs, _ := memoryDB.FindIDs(TrackFilter{Deleted: true}); !reflect.DeepEqual(IDs, []int{3}) {
+		t.Errorf("Expected the trash to have [3], got %v", IDs)
+	}
+	if memoryDB.Restore(2) {
+		t.Error("A purged track was restored")
+	}
+
+	memoryDB.Purge(3000)
+	if lastID := memoryDB.GetLastID(); lastID != 3 {
+		t.Errorf("Expected the last used ID to stay 3 after purging every deleted track, got %d", lastID)
+	}
+}
+
+// Tests that track 0, the first track added, is deleted and restored without touching the other trashed tracks
+func Test_handlerTrash_trackZero(t *testing.T) {
+	defer func(tracks TrackStorage, keys APIKeyStorage) { db, keyDB = tracks, keys }(db, keyDB)
+	memoryDB, keys := authTestKeys(t)
+	keyDB = memoryDB
+	db = testTrackDB(TrackInfo{ID: 1, DeletedAt: 1000}, TrackInfo{ID: 0}) // Track 1 is found first
+
+	for _, request := range []struct{ method, path string }{
+		{http.MethodDelete, "/paragliding/api/track/0"},
+		{http.MethodPost, "/paragliding/admin/api/trash/0/restore"},
+	} {
+		r := httptest.NewRequest(request.method, request.path, nil)
+		r.Header.Set("Authorization", "Bearer "+keys[RoleAdmin])
+		w := httptest.NewRecorder()
+		NewRouter().ServeHTTP(w, r)
+
+		var track TrackInfo
+		json.NewDecoder(w.Body).Decode(&track)
+		if w.Code != http.StatusOK || track.ID != 0 {
+			t.Errorf("%s %s: expected track 0, got %d with %+v", request.method, request.path, w.Code, track)
+		}
+	}
+
+	if _, found := db.Get(0); !found {
+		t.Error("Track 0 wasn't restored")
+	}
+	if IDs, _ := db.FindIDs(TrackFilter{Deleted: true}); !reflect.DeepEqual(IDs, []int{1}) {
+		t.Errorf("Expected track 1 to stay in the trash, got %v", IDs)
+	}
+}
+
+// Tests that adding the URL of a track in the trash says the track has to be restored
+func Test_handlerTrackAdd_trashed(t *testing.T) {
+	defer func(tracks TrackStorage, f Fetcher) { db, fetcher = tracks, f }(db, fetcher)
+	fetcher = *newTestFetcher()
+	fetcher.MaxBodySize = 1 << 20
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testIGCPoints)
+	}))
+	defer server.Close()
+	db = testTrackDB(TrackInfo{ID: 5, TrackSourceURL: server.URL, DeletedAt: 1000})
+
+	w := httptest.NewRecorder()
+	HandlerTrackAdd(w, httptest.NewRequest(http.MethodPost, "/paragliding/api/track", strings.NewReader(`{"url": "`+server.URL+`"}`)))
+
+	var problem APIError
+	json.NewDecoder(w.Body).Decode(&problem)
+	if w.Code != http.StatusConflict || !strings.Contains(problem.Detail, "in the trash as track 5") {
+		t.Errorf("Expected 409 pointing to the trashed track 5, got %d with %+v", w.Code, problem)
+	}
+}
@@ -0,0 +1,234 @@
+package igcapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	igc "github.com/marni/goigc"
+)
+
+const (
+	maxFixGap         = 30 * time.Second // Fixes further apart than this are reported as a gap
+	maxClimbRate      = 50               // Altitude changes faster than this (m/s) are reported as a spike
+	minBRecordLength  = 35               // B HHMMSS DDMMmmmN DDDMMmmmE V PPPPP GGGGG
+	secondsInADay     = 24 * 60 * 60
+	midnightThreshold = secondsInADay / 2 // A time going back more than this is treated as passing midnight
+)
+
+// mandatoryHeaders are the H records required by the IGC specification (A3.3). CM2, the second crew member,
+// is only in the files of two-seater flights
+var mandatoryHeaders = []string{"DTE", "FXA", "PLT", "GTY", "GID", "DTM", "RFW", "RHW", "FTY", "GPS", "PRS"}
+
+/*
+ValidationIssue describes a problem found on a line of an IGC file
+*/
+type ValidationIssue struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+/*
+GRecordReport describes the security record (G record) of an IGC file
+*/
+type GRecordReport struct {
+	Present     bool `json:"present"`
+	Lines       int  `json:"lines"`
+	ValidFormat bool `json:"valid_format"`
+}
+
+/*
+ValidationReport is the result of validating an IGC file
+*/
+type ValidationReport struct {
+	Valid              bool              `json:"valid"`
+	ParseError         string            `json:"parse_error,omitempty"`
+	MissingHeaders     []string          `json:"missing_h_records"`
+	NonMonotonicTimes  []ValidationIssue `json:"non_monotonic_times"`
+	FixGaps            []ValidationIssue `json:"fix_gaps"`
+	AltitudeSpikes     []ValidationIssue `json:"altitude_spikes"`
+	InvalidCoordinates []ValidationIssue `json:"invalid_coordinates"`
+	GRecord            GRecordReport     `json:"g_record"`
+}
+
+// bRecord is the part of a B record needed for validation
+type bRecord struct {
+	line     int
+	seconds  int // Seconds since midnight, with days added when passing midnight
+	altitude int64
+}
+
+/*
+ValidateIGC checks the content of an IGC file and reports everything that is wrong with it
+*/
+func ValidateIGC(content string) ValidationReport {
+	report := ValidationReport{
+		MissingHeaders:     []string{},
+		NonMonotonicTimes:  []ValidationIssue{},
+		FixGaps:            []ValidationIssue{},
+		AltitudeSpikes:     []ValidationIssue{},
+		InvalidCoordinates: []ValidationIssue{},
+	}
+
+	if _, err := igc.Parse(content); err != nil {
+		report.ParseError = err.Error()
+	}
+
+	headers := make(map[string]bool)
+	gFormatValid := true
+	var previous *bRecord
+	days := 0
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		lineNum := i + 1
+		if line == "" {
+			continue
+		}
+
+		switch line[0] {
+		case 'H':
+			if len(line) >= 5 {
+				headers[line[2:5]] = true
+			}
+
+		case 'G':
+			report.GRecord.Lines++
+			if !isSignatureFormat(line[1:]) {
+				gFormatValid = false
+			}
+
+		case 'B':
+			if len(line) < minBRecordLength {
+				report.InvalidCoordinates = append(report.InvalidCoordinates, ValidationIssue{lineNum, "B record is too short"})
+				continue
+			}
+
+			if msg := checkCoordinates(line[7:15], line[15:24]); msg != "" {
+				report.InvalidCoordinates = append(report.InvalidCoordinates, ValidationIssue{lineNum, msg})
+			}
+
+			seconds, err := parseIGCTime(line[1:7])
+			if err != nil {
+				report.NonMonotonicTimes = append(report.NonMonotonicTimes, ValidationIssue{lineNum, err.Error()})
+				continue
+			}
+
+			current := bRecord{line: lineNum, altitude: fixAltitude(line)}
+			if previous != nil {
+				if seconds+days*secondsInADay < previous.seconds-midnightThreshold {
+					days++ // The flight passed midnight (UTC)
+				}
+				current.seconds = seconds + days*secondsInADay
+				diff := current.seconds - previous.seconds
+
+				if diff <= 0 {
+					report.NonMonotonicTimes = append(report.NonMonotonicTimes, ValidationIssue{lineNum,
+						fmt.Sprintf("fix time %s is not after the fix on line %d", line[1:7], previous.line)})
+				} else {
+					if time.Duration(diff)*time.Second > maxFixGap {
+						report.FixGaps = append(report.FixGaps, ValidationIssue{lineNum,
+							fmt.Sprintf("%d seconds since the fix on line %d", diff, previous.line)})
+					}
+
+					rate := (current.altitude - previous.altitude) / int64(diff)
+					if rate > maxClimbRate || rate < -maxClimbRate {
+						report.AltitudeSpikes = append(report.AltitudeSpikes, ValidationIssue{lineNum,
+							fmt.Sprintf("altitude changed %d m in %d seconds", current.altitude-previous.altitude, diff)})
+					}
+				}
+			} else {
+				current.seconds = seconds
+			}
+
+			previous = &current
+		}
+	}
+
+	for _, header := range mandatoryHeaders {
+		if !headers[header] {
+			report.MissingHeaders = append(report.MissingHeaders, "H"+header)
+		}
+	}
+
+	report.GRecord.Present = report.GRecord.Lines > 0
+	report.GRecord.ValidFormat = report.GRecord.Present && gFormatValid
+
+	report.Valid = report.ParseError == "" &&
+		len(report.MissingHeaders) == 0 &&
+		len(report.NonMonotonicTimes) == 0 &&
+		len(report.FixGaps) == 0 &&
+		len(report.AltitudeSpikes) == 0 &&
+		len(report.InvalidCoordinates) == 0 &&
+		(!report.GRecord.Present || report.GRecord.ValidFormat)
+
+	return report
+}
+
+// parseIGCTime returns the seconds since midnight of a HHMMSS time
+func parseIGCTime(hhmmss string) (int, error) {
+	t, err := time.Parse(igc.TimeFormat, hhmmss)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fix time %s", hhmmss)
+	}
+
+	return t.Hour()*3600 + t.Minute()*60 + t.Second(), nil
+}
+
+// fixAltitude returns the pressure altitude of a B record, or the GNSS altitude if there is no pressure altitude
+func fixAltitude(line string) int64 {
+	pressure, _ := strconv.ParseInt(line[25:30], 10, 64)
+	if pressure != 0 {
+		return pressure
+	}
+
+	gnss, _ := strconv.ParseInt(line[30:35], 10, 64)
+	return gnss
+}
+
+// checkCoordinates validates a DDMMmmmN latitude and a DDDMMmmmE longitude, returns an empty string if they are valid
+func checkCoordinates(lat, lng string) string {
+	if lat[7] != 'N' && lat[7] != 'S' {
+		return fmt.Sprintf("invalid latitude hemisphere '%c'", lat[7])
+	}
+	if lng[8] != 'E' && lng[8] != 'W' {
+		return fmt.Sprintf("invalid longitude hemisphere '%c'", lng[8])
+	}
+
+	latDeg, err1 := strconv.Atoi(lat[0:2])
+	latMin, err2 := strconv.Atoi(lat[2:7]) // Minutes with three decimals
+	lngDeg, err3 := strconv.Atoi(lng[0:3])
+	lngMin, err4 := strconv.Atoi(lng[3:8])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return fmt.Sprintf("coordinates %s %s are not numeric", lat, lng)
+	}
+
+	if latMin >= 60000 || lngMin >= 60000 {
+		return fmt.Sprintf("minutes out of range in %s %s", lat, lng)
+	}
+	if latDeg*60000+latMin > 90*60000 {
+		return fmt.Sprintf("latitude %s is out of range", lat)
+	}
+	if lngDeg*60000+lngMin > 180*60000 {
+		return fmt.Sprintf("longitude %s is out of range", lng)
+	}
+
+	return ""
+}
+
+// isSignatureFormat checks that a G record line only contains the characters used by recorders (hex or base64)
+func isSignatureFormat(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		isAlphaNum := (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isAlphaNum && c != '+' && c != '/' && c != '=' {
+			return false
+		}
+	}
+
+	return true
+}
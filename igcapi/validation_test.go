@@ -0,0 +1,159 @@
+package igcapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const validIGC = `AXXXABCFLIGHT:1
+HFDTE190216
+HFFXA035
+HFPLTPILOTINCHARGE:Test Pilot
+HFCM2CREW2:NIL
+HFGTYGLIDERTYPE:RV8
+HFGIDGLIDERID:EC-XLL
+HFDTM100GPSDATUM:WGS-1984
+HFRFWFIRMWAREVERSION:1.0
+HFRHWHARDWAREVERSION:1.0
+HFFTYFRTYPE:Test
+HFGPSuBLOX
+HFPRSPRESSALTSENSOR:Test
+B1101355206343N00006198WA0058700558
+B1101455206353N00006208WA0058800559
+B1101555206363N00006218WA0058900560
+G0A1B2C3D4E5F
+`
+
+// Tests that a correct file gives a valid report
+func Test_validateIGC_valid(t *testing.T) {
+	report := ValidateIGC(validIGC)
+
+	if !report.Valid {
+		t.Errorf("Valid file reported as invalid: %+v", report)
+	}
+	if !report.GRecord.Present || !report.GRecord.ValidFormat || report.GRecord.Lines != 1 {
+		t.Errorf("Unexpected G record report: %+v", report.GRecord)
+	}
+}
+
+// Tests that solo flights without a second crew member aren't missing any headers
+func Test_validateIGC_solo(t *testing.T) {
+	report := ValidateIGC(strings.Replace(validIGC, "HFCM2CREW2:NIL\n", "", 1))
+
+	if !report.Valid || len(report.MissingHeaders) != 0 {
+		t.Errorf("Solo flight reported as missing headers: %+v", report)
+	}
+}
+
+// Tests that every kind of problem is reported on the right line
+func Test_validateIGC_problems(t *testing.T) {
+	content := `AXXXABCFLIGHT:1
+HFDTE190216
+B1101355206343N00006198WA0058700558
+B1101255206353N00006208WA0058800559
+B1103055206363N00006218WA0058900560
+B1103105206363N00006218WA0150001500
+B1103209506363N00006218WA0150001500
+G-not-a-signature-
+`
+	report := ValidateIGC(content)
+
+	if report.Valid {
+		t.Error("Invalid file reported as valid")
+	}
+	if len(report.MissingHeaders) != len(mandatoryHeaders)-1 { // Only HFDTE is given
+		t.Errorf("Expected %d missing headers, got %v", len(mandatoryHeaders)-1, report.MissingHeaders)
+	}
+	if len(report.NonMonotonicTimes) != 1 || report.NonMonotonicTimes[0].Line != 4 {
+		t.Errorf("Unexpected non-monotonic times: %+v", report.NonMonotonicTimes)
+	}
+	if len(report.FixGaps) != 1 || report.FixGaps[0].Line != 5 {
+		t.Errorf("Unexpected fix gaps: %+v", report.FixGaps)
+	}
+	if len(report.AltitudeSpikes) != 1 || report.AltitudeSpikes[0].Line != 6 {
+		t.Errorf("Unexpected altitude spikes: %+v", report.AltitudeSpikes)
+	}
+	if len(report.InvalidCoordinates) != 1 || report.InvalidCoordinates[0].Line != 7 {
+		t.Errorf("Unexpected invalid coordinates: %+v", report.InvalidCoordinates)
+	}
+	if !report.GRecord.Present || report.GRecord.ValidFormat {
+		t.Errorf("Unexpected G record report: %+v", report.GRecord)
+	}
+}
+
+// Tests that passing midnight is not reported as non-monotonic times
+func Test_validateIGC_midnight(t *testing.T) {
+	content := "HFDTE190216\nB2359595206343N00006198WA0058700558\nB0000045206353N00006208WA0058800559\n"
+	report := ValidateIGC(content)
+
+	if len(report.NonMonotonicTimes) != 0 || len(report.FixGaps) != 0 {
+		t.Errorf("Passing midnight was reported as a problem: %+v", report)
+	}
+}
+
+// Tests that /paragliding/api/validate returns a report for a posted file
+func Test_handlerValidate(t *testing.T) {
+	testServer := httptest.NewServer(NewRouter())
+	defer testServer.Close()
+
+	response, err := http.Post(testServer.URL+"/paragliding/api/validate", "text/plain", strings.NewReader(validIGC))
+	if err != nil {
+		t.Errorf("Error making POST request %s", err)
+		return
+	}
+
+	var report ValidationReport
+	if err = json.NewDecoder(response.Body).Decode(&report); err != nil {
+		t.Errorf("Couldn't decode the report: %s", err)
+	}
+	if !report.Valid {
+		t.Errorf("Valid file reported as invalid: %+v", report)
+	}
+}
+
+// Tests that adding a track with a body over the size limit gets 413
+func Test_handlerTrackAdd_tooLarge(t *testing.T) {
+	body := `{"url": "http://example.com/` + strings.Repeat("a", maxIGCSize) + `"}`
+	w := httptest.NewRecorder()
+	HandlerTrackAdd(w, httptest.NewRequest(http.MethodPost, "/paragliding/api/track", strings.NewReader(body)))
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d", w.Code)
+	}
+}
+
+// Tests that bodies over the size limit get 413, whether they're JSON, a multipart form or the file
+func Test_handlerValidate_tooLarge(t *testing.T) {
+	large := strings.Repeat("B1101355206343N00006198WA0058700558\n", maxIGCSize/36+1)
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, _ := writer.CreateFormFile("file", "large.igc")
+	io.WriteString(part, large)
+	writer.Close()
+
+	bodies := []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `{"url": "http://example.com/` + strings.Repeat("a", maxIGCSize) + `"}`},
+		{writer.FormDataContentType(), form.String()},
+		{"text/plain", large},
+	}
+	for _, test := range bodies {
+		r := httptest.NewRequest(http.MethodPost, "/paragliding/api/validate", strings.NewReader(test.body))
+		r.Header.Set("content-type", test.contentType)
+		w := httptest.NewRecorder()
+		NewRouter().ServeHTTP(w, r)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected 413, got %d", test.contentType, w.Code)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package igcapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+The versions of the API. Both are served by the same handlers, v1 under /paragliding/api/ and
+v2 under /paragliding/api/v2/, the version only changes how the bodies are encoded and decoded
+*/
+const (
+	Version1 = "v1"
+	Version2 = "v2"
+)
+
+var (
+	v1Deprecated = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	v1Sunset     = time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+
+	versionedType = reflect.TypeOf((*Versioned)(nil)).Elem()
+)
+
+type versionKey struct{}
+
+/*
+Versioned is implemented by the types with another representation in v2
+*/
+type Versioned interface {
+	V2() interface{}
+}
+
+// v2Decoder is implemented by the request bodies with other fields in v2
+type v2Decoder interface {
+	decodeV2(data []byte) error
+}
+
+/*
+WithVersion serves the handler as the given version of the API. Responses from v1 have the
+Deprecation and Sunset headers
+*/
+func WithVersion(version string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if version == Version1 {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", v1Deprecated.Unix()))
+			w.Header().Set("Sunset", v1Sunset.Format(http.TimeFormat))
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), versionKey{}, version)))
+	}
+}
+
+/*
+RequestVersion returns the version of the API the request was made to, v1 if it isn't set
+*/
+func RequestVersion(r *http.Request) string {
+	if version, ok := r.Context().Value(versionKey{}).(string); ok {
+		return version
+	}
+
+	return Version1
+}
+
+/*
+Represent returns the value as it's encoded in the version. Values, and slices of values,
+implementing Versioned are converted for v2, everything else is encoded as it is
+*/
+func Represent(version string, value interface{}) interface{} {
+	if version != Version2 {
+		return value
+	}
+	if versioned, ok := value.(Versioned); ok {
+		return versioned.V2()
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice || !v.Type().Elem().Implements(versionedType) {
+		return value
+	}
+
+	elem := reflect.TypeOf(reflect.Zero(v.Type().Elem()).Interface().(Versioned).V2())
+	items := reflect.MakeSlice(reflect.SliceOf(elem), v.Len(), v.Len()) // Never nil, so v2 encodes empty lists as []
+	for i := 0; i < v.Len(); i++ {
+		items.Index(i).Set(reflect.ValueOf(v.Index(i).Interface().(Versioned).V2()))
+	}
+
+	return items.Interface()
+}
+
+// writeJSON writes the value as JSON in the version of the request
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, value interface{}) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Represent(RequestVersion(r), value))
+}
+
+// decodeJSON decodes the body of the request, with the fields of v2 for bodies implementing v2Decoder
+func decodeJSON(r *http.Request, value interface{}) error {
+	decoder, ok := value.(v2Decoder)
+	if !ok || RequestVersion(r) != Version2 {
+		return json.NewDecoder(r.Body).Decode(value)
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	return decoder.decodeV2(data)
+}
+
+// unixTime returns the unix time (in seconds) as UTC
+func unixTime(seconds int64) time.Time {
+	return time.Unix(seconds, 0).UTC()
+}
+
+// optionalTime returns the unix time as UTC, or nil for 0
+func optionalTime(seconds int64) *time.Time {
+	if seconds == 0 {
+		return nil
+	}
+
+	t := unixTime(seconds)
+	return &t
+}
+
+/*
+TrackV2 is a track in v2
+*/
+type TrackV2 struct {
+	ID              int        `json:"id"`
+	Date            time.Time  `json:"date"`
+	Pilot           string     `json:"pilot"`
+	PilotID         string     `json:"pilot_id"`
+	Glider          string     `json:"glider"`
+	GliderID        string     `json:"glider_id"`
+	SourceURL       string     `json:"source_url"`
+	SignatureStatus string     `json:"signature_status"`
+	SiteID          int        `json:"site_id"`
+	Revision        int        `json:"revision"`
+	AddedAt         time.Time  `json:"added_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+	Stats           TrackStats `json:"stats"`
+}
+
+/*
+TrackStats are the numbers calculated from the points of a track
+*/
+type TrackStats struct {
+	Length  float64 `json:"length"`  // km
+	Airtime int64   `json:"airtime"` // Seconds
+	Score   float64 `json:"score"`   // Free distance in km, see ScoreTrack
+}
+
+/*
+V2 returns the track in v2
+*/
+func (track TrackInfo) V2() interface{} {
+	return TrackV2{
+		ID:              track.ID,
+		Date:            track.HDate,
+		Pilot:           track.Pilot,
+		PilotID:         track.PilotID,
+		Glider:          track.Glider,
+		GliderID:        track.GliderID,
+		SourceURL:       track.TrackSourceURL,
+		SignatureStatus: track.SignatureStatus,
+		SiteID:          track.SiteID,
+		Revision:        track.Revision,
+		AddedAt:         unixTime(track.Timestamp),
+		DeletedAt:       optionalTime(track.DeletedAt),
+		Stats:           TrackStats{Length: track.TrackLength, Airtime: track.Airtime, Score: track.Score},
+	}
+}
+
+/*
+TrackRevisionV2 is a revision of a track in v2
+*/
+type TrackRevisionV2 struct {
+	TrackID     int       `json:"track_id"`
+	Revision    int       `json:"revision"`
+	ContentHash string    `json:"content_hash"`
+	CreatedAt   time.Time `json:"created_at"`
+	Track       TrackV2   `json:"track"`
+}
+
+/*
+V2 returns the revision in v2
+*/
+func (revision TrackRevision) V2() interface{} {
+	return TrackRevisionV2{
+		TrackID:     revision.TrackID,
+		Revision:    revision.Revision,
+		ContentHash: revision.ContentHash,
+		CreatedAt:   unixTime(revision.Timestamp),
+		Track:       revision.Track.V2().(TrackV2),
+	}
+}
+
+/*
+AuditEntryV2 is an entry of the audit trail in v2
+*/
+type AuditEntryV2 struct {
+	TrackID   int                    `json:"track_id"`
+	Action    string                 `json:"action"`
+	Changes   map[string]AuditChange `json:"changes,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+/*
+V2 returns the entry in v2
+*/
+func (entry AuditEntry) V2() interface{} {
+	return AuditEntryV2{
+		TrackID:   entry.TrackID,
+		Action:    entry.Action,
+		Changes:   entry.Changes,
+		CreatedAt: unixTime(entry.Timestamp),
+	}
+}
+
+/*
+TickerV2 is a page of the ticker in v2, the times are null when there are no tracks
+*/
+type TickerV2 struct {
+	Latest     *time.Time `json:"latest"`
+	Start      *time.Time `json:"start"`
+	Stop       *time.Time `json:"stop"`
+	Tracks     []int      `json:"tracks"`
+	Processing int64      `json:"processing"` // Seconds
+}
+
+/*
+V2 returns the ticker in v2
+*/
+func (ticker Ticker) V2() interface{} {
+	return TickerV2{
+		Latest:     optionalTime(ticker.TLatest),
+		Start:      optionalTime(ticker.TStart),
+		Stop:       optionalTime(ticker.TStop),
+		Tracks:     ticker.Tracks,
+		Processing: ticker.Processing,
+	}
+}
+
+/*
+WebhookV2 is a webhook in v2
+*/
+type WebhookV2 struct {
+	ID              int       `json:"id"`
+	URL             string    `json:"url"`
+	MinTriggerValue int       `json:"min_trigger_value"`
+	Events          []string  `json:"events"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+/*
+WebhookRequestV2 is the body of requests registering a webhook in v2
+*/
+type WebhookRequestV2 struct {
+	URL             string   `json:"url"`
+	MinTriggerValue int      `json:"min_trigger_value"`
+	Events          []string `json:"events,omitempty"`
+}
+
+/*
+V2 returns the webhook in v2
+*/
+func (wh Webhook) V2() interface{} {
+	events := wh.Events
+	if events == nil {
+		events = []string{}
+	}
+
+	return WebhookV2{ID: wh.ID, URL: wh.URL, MinTriggerValue: wh.MinTriggerValue, Events: events, CreatedAt: unixTime(wh.Timestamp)}
+}
+
+func (wh *Webhook) decodeV2(data []byte) error {
+	var request WebhookRequestV2
+	if err := json.Unmarshal(data, &request); err != nil {
+		return err
+	}
+
+	wh.URL = request.URL
+	wh.MinTriggerValue = request.MinTriggerValue
+	wh.Events = request.Events
+	return nil
+}
+
+/*
+PilotV2 is the profile of a pilot in v2
+*/
+type PilotV2 struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	Gliders []string   `json:"gliders"`
+	Stats   PilotStats `json:"stats"`
+}
+
+/*
+PilotStats are the totals of a pilot's flights
+*/
+type PilotStats struct {
+	Flights   int     `json:"flights"`
+	Airtime   int64   `json:"airtime"`  // Seconds
+	Distance  float64 `json:"distance"` // km
+	BestScore float64 `json:"best_score"`
+}
+
+/*
+V2 returns the pilot in v2
+*/
+func (pilot Pilot) V2() interface{} {
+	gliders := pilot.Gliders
+	if gliders == nil {
+		gliders = []string{}
+	}
+
+	return PilotV2{
+		ID:      pilot.ID,
+		Name:    pilot.Name,
+		Gliders: gliders,
+		Stats:   PilotStats{Flights: pilot.Flights, Airtime: pilot.Airtime, Distance: pilot.Distance, BestScore: pilot.BestScore},
+	}
+}
+
+/*
+GliderV2 is a glider of the registry in v2
+*/
+type GliderV2 struct {
+	ID    string      `json:"id"`
+	Model string      `json:"model"`
+	Class string      `json:"class"`
+	Owner string      `json:"owner"`
+	Stats GliderStats `json:"stats"`
+}
+
+/*
+GliderStats are the totals of the flights with a glider
+*/
+type GliderStats struct {
+	Flights  int     `json:"flights"`
+	Airtime  int64   `json:"airtime"`  // Seconds
+	Distance float64 `json:"distance"` // km
+}
+
+/*
+V2 returns the glider in v2
+*/
+func (glider Glider) V2() interface{} {
+	return GliderV2{
+		ID:    glider.ID,
+		Model: glider.Model,
+		Class: glider.Class,
+		Owner: glider.Owner,
+		Stats: GliderStats{Flights: glider.Flights, Airtime: glider.Airtime, Distance: glider.Distance},
+	}
+}
+
+/*
+LeaderboardV2 is a leaderboard in v2
+*/
+type LeaderboardV2 struct {
+	Season      int                `json:"season"`
+	SiteID      int                `json:"site_id"`
+	Class       string             `json:"class"`
+	Metric      string             `json:"metric"`
+	BestFlights int                `json:"best_flights"`
+	Entries     []LeaderboardEntry `json:"entries"`
+}
+
+/*
+V2 returns the leaderboard in v2
+*/
+func (leaderboard Leaderboard) V2() interface{} {
+	entries := leaderboard.Entries
+	if entries == nil {
+		entries = []LeaderboardEntry{}
+	}
+
+	return LeaderboardV2{
+		Season:      leaderboard.Season,
+		SiteID:      leaderboard.SiteID,
+		Class:       leaderboard.Class,
+		Metric:      leaderboard.Metric,
+		BestFlights: leaderboard.BestFlights,
+		Entries:     entries,
+	}
+}
+
+// v2Pattern returns the pattern of a route of the public API under /paragliding/api/v2/, and false for other routes
+func v2Pattern(pattern string) (string, bool) {
+	if pattern != apiPrefix && !strings.HasPrefix(pattern, apiPrefix+"/") {
+		return "", false
+	}
+
+	return apiPrefix + "/" + Version2 + strings.TrimPrefix(pattern, apiPrefix), true
+}
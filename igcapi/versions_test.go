@@ -0,0 +1,112 @@
+package igcapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that values and slices of values are converted for v2, and left as they are for v1
+func Test_represent(t *testing.T) {
+	track := TrackInfo{ID: 4, Pilot: "John Doe", TrackLength: 12.5, Timestamp: 1540000000}
+
+	if _, ok := Represent(Version1, track).(TrackInfo); !ok {
+		t.Error("The track was converted for v1")
+	}
+
+	v2, ok := Represent(Version2, track).(TrackV2)
+	if !ok {
+		t.Fatal("The track wasn't converted for v2")
+	}
+	if v2.ID != 4 || v2.Stats.Length != 12.5 || !v2.AddedAt.Equal(time.Unix(1540000000, 0)) || v2.DeletedAt != nil {
+		t.Errorf("The track was converted wrong: %+v", v2)
+	}
+
+	tracks, ok := Represent(Version2, []TrackInfo{track, track}).([]TrackV2)
+	if !ok || len(tracks) != 2 {
+		t.Errorf("The slice of tracks wasn't converted, got %v", Represent(Version2, []TrackInfo{track, track}))
+	}
+
+	var none []Pilot
+	if pilots, ok := Represent(Version2, none).([]PilotV2); !ok || pilots == nil {
+		t.Error("A nil slice should be an empty slice in v2")
+	}
+
+	if IDs, ok := Represent(Version2, []int{1, 2}).([]int); !ok || len(IDs) != 2 {
+		t.Error("Values without a v2 representation should be left as they are")
+	}
+}
+
+// Tests that the same track is served by both versions, with the deprecation headers only on v1
+func Test_versionedRoutes(t *testing.T) {
+	defer func(storage TrackStorage) { db = storage }(db)
+
+	memoryDB := &TrackMemoryDB{}
+	memoryDB.Add(TrackInfo{ID: 1, Pilot: "John Doe", HDate: time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC), Timestamp: 1540000000, TrackLength: 20})
+	db = memoryDB
+
+	router := NewRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/paragliding/api/track/1", nil))
+	if w.Header().Get("Deprecation") == "" || w.Header().Get("Sunset") == "" {
+		t.Errorf("Expected Deprecation and Sunset on v1, got '%s' and '%s'", w.Header().Get("Deprecation"), w.Header().Get("Sunset"))
+	}
+	var v1 map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&v1)
+	if v1["H_date"] != "2018-10-01T00:00:00Z" || v1["track_length"] != 20.0 {
+		t.Errorf("Expected the v1 track, got %v", v1)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/paragliding/api/v2/track/1", nil))
+	if w.Header().Get("Deprecation") != "" || w.Header().Get("Sunset") != "" {
+		t.Error("v2 shouldn't be deprecated")
+	}
+	var v2 struct {
+		ID      int                `json:"id"`
+		Date    string             `json:"date"`
+		AddedAt string             `json:"added_at"`
+		Stats   map[string]float64 `json:"stats"`
+	}
+	json.NewDecoder(w.Body).Decode(&v2)
+	if v2.ID != 1 || v2.Date != "2018-10-01T00:00:00Z" || v2.AddedAt != "2018-10-20T01:46:40Z" || v2.Stats["length"] != 20 {
+		t.Errorf("Expected the v2 track, got %+v", v2)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/paragliding/api/v2/", nil))
+	var info APIInfo
+	json.NewDecoder(w.Body).Decode(&info)
+	if info.Version != "V2" {
+		t.Errorf("Expected the version V2, got '%s'", info.Version)
+	}
+}
+
+// Tests that webhooks are given with the fields of the version
+func Test_decodeWebhook(t *testing.T) {
+	tests := []struct {
+		version string
+		body    string
+	}{
+		{Version1, `{"webhookURL": "http://example.com", "minTriggerValue": 3}`},
+		{Version2, `{"url": "http://example.com", "min_trigger_value": 3}`},
+	}
+
+	for _, test := range tests {
+		var wh Webhook
+		handler := WithVersion(test.version, func(w http.ResponseWriter, r *http.Request) {
+			if err := decodeJSON(r, &wh); err != nil {
+				t.Errorf("%s: couldn't decode the webhook: %s", test.version, err.Error())
+			}
+		})
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body)))
+
+		if wh.URL != "http://example.com" || wh.MinTriggerValue != 3 {
+			t.Errorf("%s: expected the webhook, got %+v", test.version, wh)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package igcapi
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The part of RFC 6455 the live feed needs: the handshake, text messages, ping/pong and closing
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// The opcodes of the frames
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// The status codes of close frames
+const (
+	wsCloseNormal        = 1000
+	wsClosePolicy        = 1008 // Used for clients that can't keep up
+	wsCloseTooLarge      = 1009
+	wsCloseProtocolError = 1002
+)
+
+var (
+	errWebSocketClosed = errors.New("the connection was closed")
+	errWebSocketFrame  = errors.New("invalid frame")
+)
+
+// wsConn is the server side of a WebSocket connection. Messages are read by one goroutine,
+// and can be written by any
+type wsConn struct {
+	conn         net.Conn
+	reader       *bufio.Reader
+	writeMutex   sync.Mutex
+	readTimeout  time.Duration // The longest time between frames from the client, pings are answered by pongs
+	writeTimeout time.Duration
+	maxMessage   int
+}
+
+// upgradeWebSocket does the handshake, and writes 400 if the request isn't a WebSocket handshake
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, bool) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "A WebSocket handshake is needed")
+		return nil, false
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "Only version 13 of WebSocket is supported")
+		return nil, false
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		internalError(w, r, "WebSocket isn't supported")
+		return nil, false
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		internalError(w, r, "WebSocket isn't supported")
+		return nil, false
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(buffer, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(hash[:]))
+	if err := buffer.Flush(); err != nil {
+		conn.Close()
+		return nil, false
+	}
+
+	return &wsConn{
+		conn:         conn,
+		reader:       buffer.Reader,
+		readTimeout:  time.Minute,
+		writeTimeout: 10 * time.Second,
+		maxMessage:   4096,
+	}, true
+}
+
+// headerContains returns true if the comma separated header has the token, ignoring case
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ReadMessage returns the next text or binary message, answering pings and closes on the way.
+// errWebSocketClosed is returned when the client has closed the connection
+func (c *wsConn) ReadMessage() (byte, []byte, error) {
+	var opcode byte
+	var message []byte
+
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+
+		fin, frameOpcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOpcode {
+		case wsPing:
+			if err := c.WriteMessage(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.CloseWith(wsCloseNormal, "")
+			return 0, nil, errWebSocketClosed
+		case wsText, wsBinary:
+			if message != nil {
+				c.CloseWith(wsCloseProtocolError, "Expected a continuation frame")
+				return 0, nil, errWebSocketFrame
+			}
+			opcode, message = frameOpcode, []byte{}
+		case wsContinuation:
+			if message == nil {
+				c.CloseWith(wsCloseProtocolError, "Unexpected continuation frame")
+				return 0, nil, errWebSocketFrame
+			}
+		default:
+			c.CloseWith(wsCloseProtocolError, "Unknown opcode")
+			return 0, nil, errWebSocketFrame
+		}
+
+		message = append(message, payload...)
+		if len(message) > c.maxMessage {
+			c.CloseWith(wsCloseTooLarge, "The message is too large")
+			return 0, nil, errWebSocketFrame
+		}
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame reads a frame from the client, the frames from clients have to be masked
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	if !masked || (opcode >= wsClose && (!fin || length > 125)) {
+		c.CloseWith(wsCloseProtocolError, "Invalid frame")
+		return false, 0, nil, errWebSocketFrame
+	}
+	if length > uint64(c.maxMessage) {
+		c.CloseWith(wsCloseTooLarge, "The message is too large")
+		return false, 0, nil, errWebSocketFrame
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage writes a frame, frames from the server aren't masked
+func (c *wsConn) WriteMessage(opcode byte, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, 127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(length))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)) // Slow clients can't block the server
+	_, err := c.conn.Write(append(frame, payload...))
+	return err
+}
+
+// CloseWith sends a close frame with the status and reason, and closes the connection
+func (c *wsConn) CloseWith(status uint16, reason string) {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, status)
+	c.WriteMessage(wsClose, append(payload, reason...))
+	c.conn.Close()
+}
@@ -0,0 +1,118 @@
+package igcapi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// writeClientFrame writes a masked frame, as clients do
+func writeClientFrame(w io.Writer, fin bool, opcode byte, payload []byte) error {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	mask := []byte{1, 2, 3, 4}
+
+	frame := []byte{first}
+	if len(payload) <= 125 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// readServerFrame reads an unmasked frame from the server
+func readServerFrame(r io.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var extended [2]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = int(binary.BigEndian.Uint16(extended[:]))
+	}
+
+	payload := make([]byte, length)
+	_, err := io.ReadFull(r, payload)
+	return header[0] & 0x0F, payload, err
+}
+
+// testWebSocket returns a connection to the server side of a pipe
+func testWebSocket() (*wsConn, net.Conn) {
+	server, client := net.Pipe()
+	return &wsConn{conn: server, reader: bufio.NewReader(server), readTimeout: time.Second, writeTimeout: time.Second, maxMessage: 16}, client
+}
+
+// Tests that fragmented messages are joined, and that pings in between are answered
+func Test_webSocketRead(t *testing.T) {
+	conn, client := testWebSocket()
+	defer client.Close()
+
+	go func() {
+		writeClientFrame(client, false, wsText, []byte("Hello, "))
+		writeClientFrame(client, true, wsPing, []byte("ping"))
+		writeClientFrame(client, true, wsContinuation, []byte("world"))
+	}()
+	go func() { // Only the pong is read
+		opcode, payload, err := readServerFrame(client)
+		if err != nil || opcode != wsPong || string(payload) != "ping" {
+			t.Errorf("Expected a pong with 'ping', got %d with '%s'", opcode, payload)
+		}
+	}()
+
+	opcode, message, err := conn.ReadMessage()
+	if err != nil || opcode != wsText || string(message) != "Hello, world" {
+		t.Errorf("Expected 'Hello, world', got '%s' (%v)", message, err)
+	}
+}
+
+// Tests that too large messages and unmasked frames close the connection
+func Test_webSocketInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		code  uint16
+	}{
+		{"too large", append([]byte{0x81, 0x80 | 20, 0, 0, 0, 0}, make([]byte, 20)...), wsCloseTooLarge},
+		{"unmasked", []byte{0x81, 0x02, 'h', 'i'}, wsCloseProtocolError},
+	}
+
+	for _, test := range tests {
+		conn, client := testWebSocket()
+
+		go client.Write(test.frame)
+		result := make(chan uint16)
+		go func() {
+			_, payload, _ := readServerFrame(client)
+			if len(payload) < 2 {
+				result <- 0
+				return
+			}
+			result <- binary.BigEndian.Uint16(payload)
+		}()
+
+		if _, _, err := conn.ReadMessage(); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if code := <-result; code != test.code {
+			t.Errorf("%s: expected the close code %d, got %d", test.name, test.code, code)
+		}
+		client.Close()
+	}
+}